@@ -0,0 +1,59 @@
+// Command informbot-import copies records from a JSON file, as used by earlier versions of informbot,
+// into a new database file, applying any migrations needed for records to match the current schema.
+package main
+
+import (
+	// Standard library
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
+	"go.deuill.org/informbot/pkg/joe-inform-handler"
+)
+
+func main() {
+	var from = flag.String("from", "store.json", "The JSON file to import records from")
+	var to = flag.String("to", "store.db", "The database file to import records into, which must be empty")
+	flag.Parse()
+
+	if err := run(*from, *to); err != nil {
+		fmt.Fprintf(os.Stderr, "Importing records failed: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(from, to string) error {
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	// Records are stored as a single JSON object, with values encoded as base64 strings.
+	var records map[string][]byte
+	if err := json.NewDecoder(f).Decode(&records); err != nil {
+		return fmt.Errorf("decoding '%s' failed: %w", from, err)
+	}
+
+	store, err := bolt.NewStore(to, bolt.WithMigrations(inform.Migrations...))
+	if err != nil {
+		return err
+	}
+
+	defer store.Close()
+	if err := store.Import(records); err != nil {
+		return err
+	}
+
+	version, err := store.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d record(s) from '%s' into '%s', at schema version %d.\n", len(records), from, to, version)
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	// Standard library
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
+	"go.deuill.org/informbot/pkg/joe-inform-handler"
+)
+
+// WriteRecords writes the records given to a JSON file, as used by earlier versions of informbot, and
+// returns its path.
+func writeRecords(t *testing.T, records map[string][]byte) string {
+	t.Helper()
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var path = filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	return path
+}
+
+func TestRun(t *testing.T) {
+	var from = writeRecords(t, map[string][]byte{
+		"org.deuill.informbot.author.someone@example.com": []byte(`{"ID":"someone@example.com","Stories":[]}`),
+		"org.deuill.informbot.other":                      []byte(`"kept"`),
+	})
+
+	var to = filepath.Join(t.TempDir(), "store.db")
+	if err := run(from, to); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	store, err := bolt.NewStore(to, bolt.WithMigrations(inform.Migrations...))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	defer store.Close()
+
+	// Imported records have all migrations applied.
+	var latest = inform.Migrations[len(inform.Migrations)-1].Version
+	if version, err := store.Version(); err != nil || version != latest {
+		t.Errorf("Version() = %d, %v, want %d", version, err, latest)
+	}
+
+	var author inform.Author
+	if value, ok, err := store.Get("org.deuill.informbot.author.someone@example.com"); err != nil || !ok {
+		t.Fatalf("Get() = %v, %v, want author record", ok, err)
+	} else if err = json.Unmarshal(value, &author); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	} else if author.ID != "someone@example.com" {
+		t.Errorf("author ID = %q, want %q", author.ID, "someone@example.com")
+	} else if author.Options.Prefix == "" || author.Options.Language == "" || author.Options.Output == "" {
+		t.Errorf("author options = %+v, want default options set", author.Options)
+	}
+
+	if value, ok, err := store.Get("org.deuill.informbot.other"); err != nil || !ok || string(value) != `"kept"` {
+		t.Errorf("Get() = %q, %v, %v, want record kept as-is", value, ok, err)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	var valid = writeRecords(t, map[string][]byte{"org.deuill.informbot.other": []byte(`"kept"`)})
+	var invalid = filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalid, []byte(`{"key": 123}`), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	// Records are not imported into non-empty databases.
+	var existing = filepath.Join(t.TempDir(), "store.db")
+	if err := run(valid, existing); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+
+	var tests = []struct {
+		name     string
+		from, to string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.json"), filepath.Join(t.TempDir(), "store.db")},
+		{"invalid records", invalid, filepath.Join(t.TempDir(), "store.db")},
+		{"non-empty database", valid, existing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := run(tt.from, tt.to); err == nil {
+				t.Errorf("run() error = nil, want error")
+			}
+		})
+	}
+}
@@ -5,17 +5,31 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"strings"
+	_ "time/tzdata" // Time zone data, for hosts without a system time zone database.
 
 	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
 	"go.deuill.org/informbot/pkg/joe-inform-handler"
 	"go.deuill.org/informbot/pkg/joe-xmpp-adapter"
+	"go.deuill.org/informbot/pkg/sandbox"
 
 	// Third-party packages
-	"github.com/go-joe/file-memory"
 	"github.com/go-joe/joe"
 )
 
 func main() {
+	// Set up sandbox, if running as a sandboxed process. This must happen before anything else.
+	sandbox.Init()
+
+	// Records are kept in the database file given, or 'store.db' by default. Records kept in JSON files
+	// by earlier versions can be imported with the 'informbot-import' command.
+	var store = os.Getenv("INFORMBOT_STORE")
+	if store == "" {
+		store = "store.db"
+	}
+
 	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	bot := joe.New(
 		"inform",
@@ -25,15 +39,53 @@ func main() {
 			NoTLS:       os.Getenv("INFORMBOT_NO_TLS") == "true",
 			UseStartTLS: os.Getenv("INFORMBOT_USE_STARTTLS") == "true",
 		}),
-		file.Memory("store.json"),
+		bolt.Memory(store, bolt.WithMigrations(inform.Migrations...)),
 	)
 
-	in, err := inform.New(inform.Config{Bot: bot})
+	// Keep story sources and builds in the directory given, or 'blobs' by default.
+	var blobDir = os.Getenv("INFORMBOT_BLOB_DIR")
+	if blobDir == "" {
+		blobDir = "blobs"
+	}
+
+	blobs, err := blob.NewFileStore(blobDir)
+	if err != nil {
+		bot.Logger.Fatal(err.Error())
+	}
+
+	// Sandboxed processes are kept from reading bot data, in addition to other restrictions.
+	conf := inform.Config{
+		Bot:    bot,
+		Admins: strings.FieldsFunc(os.Getenv("INFORMBOT_ADMINS"), func(r rune) bool { return r == ',' || r == ' ' }),
+		Blobs:  blobs,
+		Sandbox: sandbox.Policy{
+			Disabled: os.Getenv("INFORMBOT_NO_SANDBOX") == "true",
+			Hidden:   []string{store, blobDir},
+		},
+	}
+
+	// Load translations and overrides for messages from the directory given, if any.
+	conf.Templates = os.Getenv("INFORMBOT_TEMPLATE_DIR")
+
+	// Keep text styles for Glulx stories, where the Glulx interpreter is built against RemGlk. Styled
+	// output is rendered by the XMPP adapter with XEP-0393 message styling.
+	conf.RemGlk = os.Getenv("INFORMBOT_GLULXE_REMGLK") == "true"
+
+	// Use the built-in Z-machine interpreter in place of Frotz, if requested.
+	if os.Getenv("INFORMBOT_BUILTIN_ZMACHINE") == "true" {
+		conf.Interpreters = map[string]inform.Interpreter{
+			inform.FormatZ5: &inform.ZMachineInterpreter{},
+			inform.FormatZ8: &inform.ZMachineInterpreter{},
+		}
+	}
+
+	in, err := inform.New(conf)
 	if err != nil {
 		bot.Logger.Fatal(err.Error())
 	}
 
 	bot.Brain.RegisterHandler(in.Handle)
+	bot.Brain.RegisterHandler(in.Shutdown)
 	if err := bot.Run(); err != nil {
 		bot.Logger.Fatal(err.Error())
 	}
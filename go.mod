@@ -5,9 +5,9 @@ go 1.23.0
 toolchain go1.24.3
 
 require (
-	github.com/go-joe/file-memory v1.0.0
 	github.com/go-joe/joe v0.12.0
 	github.com/pkg/errors v0.9.1
+	go.etcd.io/bbolt v1.4.3
 	go.uber.org/zap v1.27.0
 	mellium.im/sasl v0.3.2
 	mellium.im/xmlstream v0.15.4
@@ -20,6 +20,7 @@ require (
 	golang.org/x/mod v0.24.0 // indirect
 	golang.org/x/net v0.40.0 // indirect
 	golang.org/x/sync v0.14.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 	golang.org/x/tools v0.33.0 // indirect
 	mellium.im/reader v0.1.0 // indirect
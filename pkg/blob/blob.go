@@ -0,0 +1,169 @@
+// Package blob implements content-addressed storage for opaque data, such as story sources and
+// compiled story files, where data is stored and retrieved by the hash of its contents.
+//
+// Storing identical data more than once has no effect, and data is never modified once stored, which
+// allows for references to data to be shared freely between records.
+package blob
+
+import (
+	// Standard library
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when requesting data for a key that has not been stored.
+var ErrNotFound = errors.New("blob not found")
+
+// Store represents a content-addressed store, holding data against keys derived from the data itself.
+type Store interface {
+	// Put stores the data given, if not already stored, and returns the key for the data.
+	Put(data []byte) (string, error)
+	// Get returns the data stored for the key given, or ErrNotFound if no data was found.
+	Get(key string) ([]byte, error)
+	// Has returns whether or not data has been stored for the key given.
+	Has(key string) (bool, error)
+	// Keys returns the keys for all data stored, in no particular order.
+	Keys() ([]string, error)
+	// Delete removes the data stored for the key given, if any.
+	Delete(key string) error
+}
+
+// Key returns the key for the data given, as a hex-encoded SHA-256 hash of its contents.
+func Key(data []byte) string {
+	var sum = sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FileStore is a Store that keeps data in files under a single directory, with each file named for its
+// key, and grouped in sub-directories by the first two characters of the key.
+type FileStore struct {
+	dir string
+}
+
+// Put stores the data given, if not already stored, and returns the key for the data. Data is
+// written to a temporary file and moved in place, so that partially written files are never seen.
+func (f *FileStore) Put(data []byte) (string, error) {
+	var key = Key(data)
+	var name = f.path(key)
+
+	if _, err := os.Stat(name); err == nil {
+		return key, nil
+	} else if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", errors.Wrap(err, "creating blob directory failed")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-"+key+"-*")
+	if err != nil {
+		return "", errors.Wrap(err, "creating blob file failed")
+	}
+
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", errors.Wrap(err, "writing blob file failed")
+	} else if err = tmp.Close(); err != nil {
+		return "", errors.Wrap(err, "writing blob file failed")
+	} else if err = os.Rename(tmp.Name(), name); err != nil {
+		return "", errors.Wrap(err, "moving blob file failed")
+	}
+
+	return key, nil
+}
+
+// Get returns the data stored for the key given, or ErrNotFound if no data was found. Data is
+// verified against its key, and corrupted data is reported as an error.
+func (f *FileStore) Get(key string) ([]byte, error) {
+	if !validKey(key) {
+		return nil, errors.Errorf("invalid blob key '%s'", key)
+	}
+
+	data, err := os.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "key '%s'", key)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "reading blob file failed")
+	} else if Key(data) != key {
+		return nil, errors.Errorf("blob for key '%s' is corrupted", key)
+	}
+
+	return data, nil
+}
+
+// Has returns whether or not data has been stored for the key given.
+func (f *FileStore) Has(key string) (bool, error) {
+	if !validKey(key) {
+		return false, errors.Errorf("invalid blob key '%s'", key)
+	}
+
+	if _, err := os.Stat(f.path(key)); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "checking blob file failed")
+	}
+
+	return true, nil
+}
+
+// Keys returns the keys for all data stored, as found in file names. Files not named for valid keys,
+// such as temporary files for data being stored, are skipped.
+func (f *FileStore) Keys() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(f.dir, "??", "*"))
+	if err != nil {
+		return nil, errors.Wrap(err, "listing blob files failed")
+	}
+
+	var keys []string
+	for _, name := range names {
+		if key := filepath.Base(name); validKey(key) && filepath.Base(filepath.Dir(name)) == key[:2] {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Delete removes the data stored for the key given, if any.
+func (f *FileStore) Delete(key string) error {
+	if !validKey(key) {
+		return errors.Errorf("invalid blob key '%s'", key)
+	}
+
+	if err := os.Remove(f.path(key)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "removing blob file failed")
+	}
+
+	return nil
+}
+
+// Path returns the file path for the key given, which is assumed to be valid.
+func (f *FileStore) path(key string) string {
+	return filepath.Join(f.dir, key[:2], key)
+}
+
+// ValidKey returns whether or not the key given is a well-formed hex-encoded SHA-256 hash, which
+// also ensures that keys cannot refer to paths outside the store directory.
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// NewFileStore returns a FileStore keeping data under the directory given, which is created if
+// needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("blob directory is empty")
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating blob directory failed")
+	}
+
+	return &FileStore{dir: dir}, nil
+}
@@ -0,0 +1,225 @@
+package blob
+
+import (
+	// Standard library
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// NewTestStore returns a FileStore under a temporary directory removed once the test completes.
+func newTestStore(t *testing.T) *FileStore {
+	t.Helper()
+	f, err := NewFileStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	return f
+}
+
+func TestPutGet(t *testing.T) {
+	var tests = []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"text", []byte("Hello, world.")},
+		{"binary", []byte{0x00, 0xFF, 0x1B, 0x0A}},
+	}
+
+	var f = newTestStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := f.Put(tt.data)
+			if err != nil {
+				t.Fatalf("Put() error = %v", err)
+			} else if key != Key(tt.data) {
+				t.Errorf("Put() = %s, want %s", key, Key(tt.data))
+			}
+
+			got, err := f.Get(key)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			} else if !bytes.Equal(got, tt.data) {
+				t.Errorf("Get() = %q, want %q", got, tt.data)
+			}
+
+			if ok, err := f.Has(key); err != nil || !ok {
+				t.Errorf("Has() = %v, %v, want true", ok, err)
+			}
+		})
+	}
+}
+
+func TestPutExisting(t *testing.T) {
+	var f = newTestStore(t)
+	var data = []byte("some data")
+
+	key, err := f.Put(data)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	info, err := os.Stat(f.path(key))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+
+	// Data stored again is left as-is, rather than being written anew.
+	if again, err := f.Put(data); err != nil || again != key {
+		t.Fatalf("Put() = %s, %v, want %s", again, err, key)
+	} else if info2, err := os.Stat(f.path(key)); err != nil || !os.SameFile(info, info2) {
+		t.Errorf("Put() replaced existing file for key %s", key)
+	}
+}
+
+func TestPutAtomic(t *testing.T) {
+	var f = newTestStore(t)
+	var data = []byte("some data")
+
+	key, err := f.Put(data)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	// No temporary files are left behind once data is stored.
+	names, err := os.ReadDir(filepath.Dir(f.path(key)))
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	} else if len(names) != 1 || names[0].Name() != key {
+		t.Errorf("ReadDir() = %v, want single file for key %s", names, key)
+	}
+
+	// Partially written temporary files are not seen as stored data.
+	var partial = []byte("other data")
+	var tmp = filepath.Join(filepath.Dir(f.path(Key(partial))), ".tmp-"+Key(partial)+"-1234")
+	if err := os.MkdirAll(filepath.Dir(tmp), 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	} else if err := os.WriteFile(tmp, partial[:3], 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if ok, err := f.Has(Key(partial)); err != nil || ok {
+		t.Errorf("Has() = %v, %v, want false", ok, err)
+	} else if _, err := f.Get(Key(partial)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	} else if keys, err := f.Keys(); err != nil || len(keys) != 1 || keys[0] != key {
+		t.Errorf("Keys() = %v, %v, want [%s]", keys, err, key)
+	}
+}
+
+func TestGetMissing(t *testing.T) {
+	var f = newTestStore(t)
+	if _, err := f.Get(Key([]byte("missing"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	} else if ok, err := f.Has(Key([]byte("missing"))); err != nil || ok {
+		t.Errorf("Has() = %v, %v, want false", ok, err)
+	}
+}
+
+func TestGetCorrupted(t *testing.T) {
+	var f = newTestStore(t)
+	key, err := f.Put([]byte("some data"))
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	} else if err = os.WriteFile(f.path(key), []byte("other data"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	if _, err := f.Get(key); err == nil || !strings.Contains(err.Error(), "corrupted") {
+		t.Errorf("Get() error = %v, want corrupted error", err)
+	}
+}
+
+func TestKeysDelete(t *testing.T) {
+	var f = newTestStore(t)
+	var want []string
+	for _, data := range []string{"one", "two", "three"} {
+		key, err := f.Put([]byte(data))
+		if err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+		want = append(want, key)
+	}
+
+	keys, err := f.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+
+	sort.Strings(keys)
+	sort.Strings(want)
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("Keys() = %v, want %v", keys, want)
+	}
+
+	if err := f.Delete(want[0]); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	} else if ok, err := f.Has(want[0]); err != nil || ok {
+		t.Errorf("Has() = %v, %v after Delete(), want false", ok, err)
+	} else if keys, err := f.Keys(); err != nil || len(keys) != 2 {
+		t.Errorf("Keys() = %v, %v after Delete(), want 2 keys", keys, err)
+	}
+
+	// Deleting data not stored is not an error.
+	if err := f.Delete(want[0]); err != nil {
+		t.Errorf("Delete() error = %v for missing key, want nil", err)
+	}
+}
+
+func TestValidKey(t *testing.T) {
+	var tests = []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{"valid", Key([]byte("data")), true},
+		{"upper-case", strings.ToUpper(Key([]byte("data"))), true},
+		{"empty", "", false},
+		{"short", Key([]byte("data"))[:62], false},
+		{"long", Key([]byte("data")) + "00", false},
+		{"not hex", strings.Repeat("zz", 32), false},
+		{"path traversal", "../" + Key([]byte("data"))[3:], false},
+		{"path separator", Key([]byte("data"))[:2] + "/" + Key([]byte("data"))[3:], false},
+	}
+
+	var f = newTestStore(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validKey(tt.key); got != tt.want {
+				t.Errorf("validKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+
+			// Invalid keys are rejected before the store directory is accessed.
+			if !tt.want {
+				if _, err := f.Get(tt.key); err == nil || errors.Is(err, ErrNotFound) {
+					t.Errorf("Get(%q) error = %v, want invalid key error", tt.key, err)
+				} else if _, err := f.Has(tt.key); err == nil {
+					t.Errorf("Has(%q) error = nil, want invalid key error", tt.key)
+				} else if err := f.Delete(tt.key); err == nil {
+					t.Errorf("Delete(%q) error = nil, want invalid key error", tt.key)
+				}
+			}
+		})
+	}
+}
+
+func TestNewFileStore(t *testing.T) {
+	if _, err := NewFileStore(""); err == nil {
+		t.Errorf("NewFileStore(\"\") error = nil, want error")
+	}
+
+	var dir = filepath.Join(t.TempDir(), "nested", "blobs")
+	if _, err := NewFileStore(dir); err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("NewFileStore() did not create directory %s", dir)
+	}
+}
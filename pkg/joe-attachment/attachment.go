@@ -0,0 +1,103 @@
+// Package attachment implements a generic representation of files attached to chat messages, as
+// passed from Joe adapters to handlers.
+//
+// Adapters supporting attachments set the Data field for joe.ReceiveMessageEvent values to a type
+// implementing the Carrier interface, and handlers retrieve attachments for these events with the
+// From function, regardless of the adapter used.
+package attachment
+
+import (
+	// Standard library
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+)
+
+// The default timeout for fetching attachments, used where the context given has no deadline set.
+const defaultFetchTimeout = 30 * time.Second
+
+// Attachment represents a file attached to a chat message, as made available at a remote URL.
+type Attachment struct {
+	URL         string // The HTTP(S) URL the attachment can be fetched from.
+	Name        string // The file name for the attachment, if known.
+	Description string // The description given for the attachment, if any.
+}
+
+// Fetch returns the contents of the attachment, failing if the attachment is larger than the size
+// limit given, in bytes.
+func (a Attachment) Fetch(ctx context.Context, limit int64) ([]byte, error) {
+	if u, err := url.Parse(a.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, errors.New("location given is not a valid HTTP URL")
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultFetchTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "preparing request failed")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching file failed")
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("fetching file failed with status '%s'", resp.Status)
+	} else if limit > 0 && resp.ContentLength > limit {
+		return nil, errors.Errorf("file is larger than %d bytes", limit)
+	}
+
+	// Read one byte past the limit, in case the content length was not reported correctly.
+	var body io.Reader = resp.Body
+	if limit > 0 {
+		body = io.LimitReader(resp.Body, limit+1)
+	}
+
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetching file failed")
+	} else if limit > 0 && int64(len(buf)) > limit {
+		return nil, errors.Errorf("file is larger than %d bytes", limit)
+	}
+
+	return buf, nil
+}
+
+// FileName returns the file name for the attachment, as given explicitly, or derived from its URL.
+func (a Attachment) FileName() string {
+	if a.Name != "" {
+		return a.Name
+	} else if u, err := url.Parse(a.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		return path.Base(u.Path)
+	}
+
+	return ""
+}
+
+// Carrier is implemented by event data carrying attachments.
+type Carrier interface {
+	Attachments() []Attachment
+}
+
+// From returns any attachments for the event given, as carried in its Data field.
+func From(ev joe.ReceiveMessageEvent) []Attachment {
+	if c, ok := ev.Data.(Carrier); ok {
+		return c.Attachments()
+	}
+
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package bolt implements a joe.Memory backed by an embedded, transactional key-value database, with
+// support for versioned schema migrations applied to stored records on startup.
+package bolt
+
+import (
+	// Standard library
+	"encoding/binary"
+	"time"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// Buckets used for stored records, and for metadata on the records themselves.
+var (
+	dataBucket = []byte("data")
+	metaBucket = []byte("meta")
+)
+
+// The metadata key the current schema version is stored under.
+var versionKey = []byte("version")
+
+// The time allowed for acquiring a lock on the database file, which is held by other processes using
+// the same database.
+const defaultOpenTimeout = 5 * time.Second
+
+// Tx represents a read-write transaction on stored records, as used by migrations.
+type Tx interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte) error
+	Delete(key string) (bool, error)
+	Keys() ([]string, error)
+}
+
+// Migration represents a change to the schema of stored records, identified by the schema version it
+// results in. Migrations are applied in order of their version, and in a single transaction, such
+// that a failing migration leaves stored records unchanged.
+type Migration struct {
+	Version     int               // The schema version resulting from this migration.
+	Description string            // A short description of the changes made.
+	Migrate     func(tx Tx) error // The function applying changes to stored records.
+}
+
+// Option represents a function that sets optional parameters for stores.
+type Option func(*Store) error
+
+// WithLogger sets the logger used for reporting on store operations.
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *Store) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// WithMigrations sets the migrations applied to stored records, which are required to be given in
+// order of increasing version.
+func WithMigrations(migrations ...Migration) Option {
+	return func(s *Store) error {
+		for i, m := range migrations {
+			if m.Version < 1 || (i > 0 && m.Version <= migrations[i-1].Version) {
+				return errors.Errorf("migration '%s' has invalid version %d", m.Description, m.Version)
+			} else if m.Migrate == nil {
+				return errors.Errorf("migration '%s' has no function set", m.Description)
+			}
+		}
+
+		s.migrations = migrations
+		return nil
+	}
+}
+
+// Store is a joe.Memory keeping records in an embedded database file. Each operation is run in its
+// own transaction, and records are written to disk before operations return.
+type Store struct {
+	db         *bbolt.DB
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+// Set assigns the value given to the key given.
+func (s *Store) Set(key string, value []byte) error {
+	return s.db.Update(func(btx *bbolt.Tx) error {
+		return (&tx{btx.Bucket(dataBucket)}).Set(key, value)
+	})
+}
+
+// Get returns the value assigned to the key given, and whether or not the key was found.
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	var value []byte
+	var ok bool
+
+	err := s.db.View(func(btx *bbolt.Tx) (err error) {
+		value, ok, err = (&tx{btx.Bucket(dataBucket)}).Get(key)
+		return err
+	})
+
+	return value, ok, err
+}
+
+// Delete removes the key given, and returns whether or not the key was found.
+func (s *Store) Delete(key string) (bool, error) {
+	var ok bool
+	err := s.db.Update(func(btx *bbolt.Tx) (err error) {
+		ok, err = (&tx{btx.Bucket(dataBucket)}).Delete(key)
+		return err
+	})
+
+	return ok, err
+}
+
+// Keys returns all keys stored, in lexical order.
+func (s *Store) Keys() ([]string, error) {
+	var keys []string
+	err := s.db.View(func(btx *bbolt.Tx) (err error) {
+		keys, err = (&tx{btx.Bucket(dataBucket)}).Keys()
+		return err
+	})
+
+	return keys, err
+}
+
+// Close closes the underlying database file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Version returns the schema version for stored records.
+func (s *Store) Version() (int, error) {
+	var version int
+	err := s.db.View(func(btx *bbolt.Tx) error {
+		version = getVersion(btx)
+		return nil
+	})
+
+	return version, err
+}
+
+// Import adds the records given to the store, which must be empty, and applies all migrations to
+// them, as records imported are assumed to predate any schema versioning.
+func (s *Store) Import(records map[string][]byte) error {
+	return s.db.Update(func(btx *bbolt.Tx) error {
+		var t = &tx{btx.Bucket(dataBucket)}
+		if k, _ := t.bucket.Cursor().First(); k != nil {
+			return errors.New("cannot import records into non-empty store")
+		}
+
+		for key, value := range records {
+			if err := t.Set(key, value); err != nil {
+				return err
+			}
+		}
+
+		return s.migrate(btx, 0)
+	})
+}
+
+// Migrate applies all migrations newer than the version given, in order, and stores the resulting
+// schema version.
+func (s *Store) migrate(btx *bbolt.Tx, version int) error {
+	var t = &tx{btx.Bucket(dataBucket)}
+	for _, m := range s.migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		s.logger.Info("Migrating stored records", zap.Int("version", m.Version), zap.String("description", m.Description))
+		if err := m.Migrate(t); err != nil {
+			return errors.Wrapf(err, "applying migration to version %d failed", m.Version)
+		}
+		version = m.Version
+	}
+
+	return setVersion(btx, version)
+}
+
+// Latest returns the schema version resulting from all migrations set for the store.
+func (s *Store) latest() int {
+	if len(s.migrations) == 0 {
+		return 0
+	}
+
+	return s.migrations[len(s.migrations)-1].Version
+}
+
+// Tx is a Tx for a single bucket in a read-write or read-only bbolt transaction.
+type tx struct {
+	bucket *bbolt.Bucket
+}
+
+// Get returns a copy of the value assigned to the key given, as values returned by bbolt are only
+// valid for the lifetime of the transaction.
+func (t *tx) Get(key string) ([]byte, bool, error) {
+	value := t.bucket.Get([]byte(key))
+	if value == nil {
+		return nil, false, nil
+	}
+
+	return append([]byte{}, value...), true, nil
+}
+
+func (t *tx) Set(key string, value []byte) error {
+	if err := t.bucket.Put([]byte(key), value); err != nil {
+		return errors.Wrap(err, "storing record failed")
+	}
+
+	return nil
+}
+
+func (t *tx) Delete(key string) (bool, error) {
+	if t.bucket.Get([]byte(key)) == nil {
+		return false, nil
+	} else if err := t.bucket.Delete([]byte(key)); err != nil {
+		return false, errors.Wrap(err, "removing record failed")
+	}
+
+	return true, nil
+}
+
+func (t *tx) Keys() ([]string, error) {
+	var keys []string
+	err := t.bucket.ForEach(func(k, _ []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+
+	return keys, err
+}
+
+// GetVersion returns the schema version stored in the transaction given, or zero if none is stored.
+func getVersion(btx *bbolt.Tx) int {
+	value := btx.Bucket(metaBucket).Get(versionKey)
+	if len(value) != 8 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint64(value))
+}
+
+// SetVersion stores the schema version given in the transaction given.
+func setVersion(btx *bbolt.Tx, version int) error {
+	var value = make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(version))
+
+	if err := btx.Bucket(metaBucket).Put(versionKey, value); err != nil {
+		return errors.Wrap(err, "storing schema version failed")
+	}
+
+	return nil
+}
+
+// Memory returns a joe.Module setting up a Store at the path given as the bot memory.
+func Memory(path string, opts ...Option) joe.Module {
+	return joe.ModuleFunc(func(conf *joe.Config) error {
+		store, err := NewStore(path, append([]Option{WithLogger(conf.Logger("memory"))}, opts...)...)
+		if err != nil {
+			return err
+		}
+
+		conf.SetMemory(store)
+		return nil
+	})
+}
+
+// NewStore opens or creates the database file at the path given, and applies any migrations newer
+// than the schema version stored. Newly created stores are set to the latest schema version, as
+// they hold no records to migrate.
+func NewStore(path string, opts ...Option) (*Store, error) {
+	var s = &Store{logger: zap.NewNop()}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: defaultOpenTimeout})
+	if err != nil {
+		return nil, errors.Wrap(err, "opening database failed")
+	}
+
+	err = db.Update(func(btx *bbolt.Tx) error {
+		var created = btx.Bucket(dataBucket) == nil
+		for _, name := range [][]byte{dataBucket, metaBucket} {
+			if _, err := btx.CreateBucketIfNotExists(name); err != nil {
+				return errors.Wrap(err, "creating bucket failed")
+			}
+		}
+
+		if version := getVersion(btx); created {
+			return setVersion(btx, s.latest())
+		} else if version > s.latest() {
+			return errors.Errorf("stored schema version %d is newer than supported version %d", version, s.latest())
+		} else if version < s.latest() {
+			return s.migrate(btx, version)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s.db = db
+	return s, nil
+}
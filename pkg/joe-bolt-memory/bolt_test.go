@@ -0,0 +1,224 @@
+package bolt
+
+import (
+	// Standard library
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// NewTestPath returns the path for a database file under a temporary directory, which is removed once
+// the test completes.
+func newTestPath(t *testing.T) string {
+	t.Helper()
+	return filepath.Join(t.TempDir(), "store.db")
+}
+
+// NewTestStore opens the store at the path given with the options given, closing it once the test
+// completes.
+func newTestStore(t *testing.T, path string, opts ...Option) *Store {
+	t.Helper()
+	s, err := NewStore(path, opts...)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// AppendMigration returns a migration appending its version to the value stored under key 'log',
+// so that the order migrations are applied in can be checked.
+func appendMigration(version int) Migration {
+	return Migration{
+		Version:     version,
+		Description: "append version to log",
+		Migrate: func(tx Tx) error {
+			value, _, err := tx.Get("log")
+			if err != nil {
+				return err
+			}
+			return tx.Set("log", append(value, byte('0'+version)))
+		},
+	}
+}
+
+// FailingMigration returns a migration that changes stored records, and then fails.
+func failingMigration(version int) Migration {
+	return Migration{
+		Version:     version,
+		Description: "fail after changes",
+		Migrate: func(tx Tx) error {
+			if err := tx.Set("log", []byte("changed")); err != nil {
+				return err
+			} else if _, err := tx.Delete("other"); err != nil {
+				return err
+			}
+			return errors.New("migration failed")
+		},
+	}
+}
+
+func TestStore(t *testing.T) {
+	var s = newTestStore(t, newTestPath(t))
+
+	if err := s.Set("b", []byte("two")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	} else if err := s.Set("a", []byte("one")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if value, ok, err := s.Get("a"); err != nil || !ok || string(value) != "one" {
+		t.Errorf("Get() = %q, %v, %v, want \"one\", true, nil", value, ok, err)
+	} else if value, ok, err := s.Get("missing"); err != nil || ok || value != nil {
+		t.Errorf("Get() = %q, %v, %v, want nil, false, nil", value, ok, err)
+	}
+
+	if keys, err := s.Keys(); err != nil || !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("Keys() = %v, %v, want [a b]", keys, err)
+	}
+
+	if ok, err := s.Delete("a"); err != nil || !ok {
+		t.Errorf("Delete() = %v, %v, want true, nil", ok, err)
+	} else if ok, err := s.Delete("a"); err != nil || ok {
+		t.Errorf("Delete() = %v, %v, want false, nil", ok, err)
+	} else if keys, err := s.Keys(); err != nil || !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("Keys() = %v, %v, want [b]", keys, err)
+	}
+}
+
+func TestNewStoreVersion(t *testing.T) {
+	var path = newTestPath(t)
+	var migrations = []Migration{appendMigration(1), appendMigration(2)}
+
+	// New stores are set to the latest version, without any migrations applied.
+	var s = newTestStore(t, path, WithMigrations(migrations...))
+	if version, err := s.Version(); err != nil || version != 2 {
+		t.Errorf("Version() = %d, %v, want 2", version, err)
+	} else if _, ok, _ := s.Get("log"); ok {
+		t.Errorf("Get() found record set by migrations for new store")
+	}
+
+	// Stores with newer versions than supported are not opened.
+	s.Close()
+	if _, err := NewStore(path, WithMigrations(migrations[0])); err == nil || !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("NewStore() error = %v, want newer version error", err)
+	}
+
+	// Stores opened again with the same migrations are left as-is.
+	s = newTestStore(t, path, WithMigrations(migrations...))
+	if version, err := s.Version(); err != nil || version != 2 {
+		t.Errorf("Version() = %d, %v, want 2", version, err)
+	} else if _, ok, _ := s.Get("log"); ok {
+		t.Errorf("Get() found record set by migrations for up-to-date store")
+	}
+}
+
+func TestNewStoreMigrate(t *testing.T) {
+	var path = newTestPath(t)
+
+	var s = newTestStore(t, path, WithMigrations(appendMigration(1)))
+	if err := s.Set("log", []byte("-")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Only migrations newer than the stored version are applied, in order of their version.
+	s.Close()
+	s = newTestStore(t, path, WithMigrations(appendMigration(1), appendMigration(2), appendMigration(3)))
+	if version, err := s.Version(); err != nil || version != 3 {
+		t.Errorf("Version() = %d, %v, want 3", version, err)
+	} else if value, _, err := s.Get("log"); err != nil || string(value) != "-23" {
+		t.Errorf("Get() = %q, %v, want \"-23\"", value, err)
+	}
+}
+
+func TestNewStoreMigrateFailure(t *testing.T) {
+	var path = newTestPath(t)
+
+	var s = newTestStore(t, path, WithMigrations(appendMigration(1)))
+	if err := s.Set("log", []byte("-")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	} else if err := s.Set("other", []byte("kept")); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// Failing migrations leave stored records and the stored version unchanged, including any
+	// changes made by earlier migrations.
+	s.Close()
+	_, err := NewStore(path, WithMigrations(appendMigration(1), appendMigration(2), failingMigration(3)))
+	if err == nil || !strings.Contains(err.Error(), "version 3") {
+		t.Fatalf("NewStore() error = %v, want migration error", err)
+	}
+
+	s = newTestStore(t, path, WithMigrations(appendMigration(1)))
+	if version, err := s.Version(); err != nil || version != 1 {
+		t.Errorf("Version() = %d, %v, want 1", version, err)
+	} else if value, _, err := s.Get("log"); err != nil || string(value) != "-" {
+		t.Errorf("Get() = %q, %v, want \"-\"", value, err)
+	} else if value, _, err := s.Get("other"); err != nil || string(value) != "kept" {
+		t.Errorf("Get() = %q, %v, want \"kept\"", value, err)
+	}
+}
+
+func TestWithMigrations(t *testing.T) {
+	var tests = []struct {
+		name       string
+		migrations []Migration
+		wantErr    bool
+	}{
+		{"none", nil, false},
+		{"ordered", []Migration{appendMigration(1), appendMigration(3)}, false},
+		{"zero version", []Migration{appendMigration(0)}, true},
+		{"unordered", []Migration{appendMigration(2), appendMigration(1)}, true},
+		{"duplicate", []Migration{appendMigration(1), appendMigration(1)}, true},
+		{"no function", []Migration{{Version: 1, Description: "empty"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStore(newTestPath(t), WithMigrations(tt.migrations...))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewStore() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	var records = map[string][]byte{"log": []byte("-"), "other": []byte("kept")}
+
+	// Imported records are assumed to predate versioning, and have all migrations applied.
+	var s = newTestStore(t, newTestPath(t), WithMigrations(appendMigration(1), appendMigration(2)))
+	if err := s.Import(records); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	} else if version, err := s.Version(); err != nil || version != 2 {
+		t.Errorf("Version() = %d, %v, want 2", version, err)
+	} else if value, _, err := s.Get("log"); err != nil || string(value) != "-12" {
+		t.Errorf("Get() = %q, %v, want \"-12\"", value, err)
+	} else if value, _, err := s.Get("other"); err != nil || string(value) != "kept" {
+		t.Errorf("Get() = %q, %v, want \"kept\"", value, err)
+	}
+
+	// Records cannot be imported into non-empty stores.
+	if err := s.Import(records); err == nil {
+		t.Errorf("Import() error = nil for non-empty store, want error")
+	}
+}
+
+func TestImportFailure(t *testing.T) {
+	var records = map[string][]byte{"log": []byte("-"), "other": []byte("kept")}
+
+	// Failing migrations leave the store empty, so that importing can be attempted again.
+	var s = newTestStore(t, newTestPath(t), WithMigrations(appendMigration(1), failingMigration(2)))
+	if err := s.Import(records); err == nil {
+		t.Fatalf("Import() error = nil, want migration error")
+	} else if keys, err := s.Keys(); err != nil || len(keys) != 0 {
+		t.Errorf("Keys() = %v, %v, want no keys", keys, err)
+	} else if version, err := s.Version(); err != nil || version != 2 {
+		t.Errorf("Version() = %d, %v, want 2", version, err)
+	}
+}
@@ -2,32 +2,27 @@ package inform
 
 import (
 	// Standard library
-	"io/ioutil"
-	"net/http"
-	"net/url"
 	"strings"
+	"unicode"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
 
 	// Third-party packages
+	"github.com/go-joe/joe"
 	"github.com/pkg/errors"
 )
 
-// Options represent user-configurable values, which are used in processing commands
-// and formatting output.
-type Options struct {
-	Prefix string
-}
-
-// Default values for options, as assigned to newly created Author instances.
-var defaultOptions = Options{
-	Prefix: "?",
-}
-
 type Author struct {
-	ID      string
-	Options Options
-	Stories []*Story
+	ID         string
+	Options    Options
+	Stories    []*Story
+	Extensions []*Extension // Extensions available to this author's stories alone.
+
+	blobs blob.Store // The blob store story data is loaded from.
 }
 
+// GetStory returns the story with the name given, with its source and compiled story file loaded.
 func (a *Author) GetStory(name string) (*Story, error) {
 	if name == "" {
 		return nil, errors.New("story name is empty")
@@ -35,6 +30,9 @@ func (a *Author) GetStory(name string) (*Story, error) {
 
 	for i := range a.Stories {
 		if a.Stories[i].Name == name {
+			if err := a.Stories[i].load(a.blobs); err != nil {
+				return nil, err
+			}
 			return a.Stories[i], nil
 		}
 	}
@@ -42,30 +40,19 @@ func (a *Author) GetStory(name string) (*Story, error) {
 	return nil, errors.New("no story found with name '" + name + "'")
 }
 
-func (a *Author) AddStory(name, path string) (*Story, error) {
-	var story *Story
-	if name == "" {
-		return nil, errors.New("story name is empty")
-	} else if s, _ := a.GetStory(name); s != nil {
-		story = s
-	} else if u, err := url.Parse(path); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
-		return nil, errors.New("location given is not a valid HTTP URL")
+// AddStory adds a story with the name and source given, or replaces the source for any existing
+// story with the same name.
+func (a *Author) AddStory(name string, source []byte) (*Story, error) {
+	if len(source) == 0 {
+		return nil, errors.New("story source is empty")
+	} else if story, _ := a.GetStory(name); story != nil {
+		return story.WithSource(source), nil
+	} else if err := validateStoryName(name); err != nil {
+		return nil, err
 	}
 
-	resp, err := http.Get(path)
-	if err != nil {
-		return nil, errors.New("could not fetch story file from URL given")
-	}
-
-	defer resp.Body.Close()
-	if body, err := ioutil.ReadAll(resp.Body); err != nil {
-		return nil, errors.New("could not fetch story file from URL given")
-	} else if story == nil {
-		story = NewStory(name, a.ID).WithSource(body)
-		a.Stories = append(a.Stories, story)
-	} else {
-		story.WithSource(body)
-	}
+	var story = NewStory(name, a.ID).WithSource(source)
+	a.Stories = append(a.Stories, story)
 
 	return story, nil
 }
@@ -86,20 +73,52 @@ func (a *Author) RemoveStory(name string) error {
 	return errors.New("no story found with name '" + name + "'")
 }
 
-func (a *Author) SetOption(name, value string) error {
-	switch strings.ToLower(name) {
-	case "prefix":
-		if value == "" {
-			return errors.New("cannot set empty prefix value")
-		}
-		a.Options.Prefix = value
-	default:
-		return errors.New("option name '" + name + "' is unknown")
+func NewAuthor(id string) *Author {
+	return &Author{ID: id, Options: defaultOptions}
+}
+
+// ValidateAuthorID returns an error if the author ID given is empty, or contains characters not
+// found in author IDs, i.e. white-space, control characters or the story reference separator.
+func validateAuthorID(id string) error {
+	if id == "" {
+		return errors.New("author ID is empty")
+	} else if strings.ContainsFunc(id, unicode.IsSpace) || strings.ContainsFunc(id, unicode.IsControl) {
+		return errors.New("author ID contains white-space or control characters")
+	} else if strings.Contains(id, storyRefSeparator) {
+		return errors.New("author ID contains '" + storyRefSeparator + "'")
 	}
 
 	return nil
 }
 
-func NewAuthor(id string) *Author {
-	return &Author{ID: id, Options: defaultOptions}
+// ValidateStoryName returns an error if the story name given is empty, or contains characters not
+// allowed in story names, i.e. white-space, control characters or the story reference separator.
+func validateStoryName(name string) error {
+	if name == "" {
+		return errors.New("story name is empty")
+	} else if strings.ContainsFunc(name, unicode.IsSpace) || strings.ContainsFunc(name, unicode.IsControl) {
+		return errors.New("story name contains white-space or control characters")
+	} else if strings.Contains(name, storyRefSeparator) {
+		return errors.New("story name contains '" + storyRefSeparator + "'")
+	}
+
+	return nil
+}
+
+// A Participant is implemented by event data for adapters relaying messages sent in shared channels,
+// and returns the name the author of the message is known by in the channel, e.g. the nickname for
+// occupants of group-chats. Adapters can leave the author ID for events empty where the identity of
+// the author is not known, in which case the author takes part as a guest.
+type Participant interface {
+	Nick() string
+}
+
+// ParticipantNick returns the name the author of the event given is known by in its channel, if the
+// adapter provides one.
+func participantNick(ev joe.ReceiveMessageEvent) string {
+	if p, ok := ev.Data.(Participant); ok {
+		return p.Nick()
+	}
+
+	return ""
 }
@@ -0,0 +1,324 @@
+package inform
+
+import (
+	// Standard library
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// The directory blobs are stored under, where no explicit blob store is set in configuration.
+const defaultBlobDir = "blobs"
+
+// The prefix for keys cached builds are stored under.
+const buildCachePrefix = keyPrefix + ".build."
+
+// CachedBuild represents a compiled story file kept for reuse by stories with identical sources,
+// formats and extensions. Cached builds are kept for as long as their story source is referenced.
+type cachedBuild struct {
+	SourceRef   string      // The reference to the story source compiled, as kept in the blob store.
+	BuildRef    string      // The reference to the compiled story file, as kept in the blob store.
+	BuildFormat string      // The format the story was compiled to.
+	Log         *CompileLog // The outcome of compilation.
+}
+
+// Load sets the blob store for the story, and loads the story source and compiled story file from the
+// blob store, if not already loaded. Sources for previous revisions are loaded separately, as needed.
+func (s *Story) load(blobs blob.Store) error {
+	s.blobs = blobs
+	s.migrate()
+
+	var err error
+	if s.Source == nil && s.SourceRef != "" {
+		if s.Source, err = s.get(s.SourceRef); err != nil {
+			return errors.Wrap(err, "loading story source failed")
+		}
+	}
+	if s.Build == nil && s.BuildRef != "" {
+		if s.Build, err = s.get(s.BuildRef); err != nil {
+			return errors.Wrap(err, "loading compiled story failed")
+		}
+	}
+
+	return nil
+}
+
+// Store moves the story source, compiled story file, and revision sources into the blob store given,
+// where these are loaded, and sets references to them.
+func (s *Story) store(blobs blob.Store) error {
+	s.migrate()
+
+	var err error
+	if s.Source != nil {
+		if s.SourceRef, err = blobs.Put(s.Source); err != nil {
+			return errors.Wrap(err, "storing story source failed")
+		}
+	}
+	if s.Build != nil {
+		if s.BuildRef, err = blobs.Put(s.Build); err != nil {
+			return errors.Wrap(err, "storing compiled story failed")
+		}
+	}
+	for _, r := range s.Revisions {
+		if r.Source == nil {
+			continue
+		} else if r.SourceRef, err = blobs.Put(r.Source); err != nil {
+			return errors.Wrap(err, "storing revision source failed")
+		}
+	}
+
+	return nil
+}
+
+// Migrate moves story data held inline, as stored before the blob store was used, into the fields
+// used for data loaded from the blob store, so that it is moved into the blob store when next stored.
+func (s *Story) migrate() {
+	if s.LegacySource != nil {
+		s.Source, s.LegacySource = s.LegacySource, nil
+	}
+	if s.LegacyBuild != nil {
+		s.Build, s.LegacyBuild = s.LegacyBuild, nil
+	}
+	for _, r := range s.Revisions {
+		if r.LegacySource != nil {
+			r.Source, r.SourceRef, r.Size, r.LegacySource = r.LegacySource, blob.Key(r.LegacySource), len(r.LegacySource), nil
+		}
+	}
+}
+
+// Migrate moves extension sources held inline, as stored before the blob store was used, into the
+// field used for sources loaded from the blob store, so that these are moved into the blob store
+// when next stored.
+func (e *Extension) migrate() {
+	if e.LegacySource != nil {
+		e.Source, e.LegacySource = e.LegacySource, nil
+	}
+}
+
+// RevisionSource returns the story source for the revision given, loading it from the blob store if
+// needed.
+func (s *Story) revisionSource(r *Revision) ([]byte, error) {
+	if r.Source == nil && r.SourceRef != "" {
+		src, err := s.get(r.SourceRef)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading source for revision %d failed", r.Number)
+		}
+		r.Source = src
+	}
+
+	return r.Source, nil
+}
+
+// Get returns the data for the blob reference given from the blob store set for the story.
+func (s *Story) get(ref string) ([]byte, error) {
+	if s.blobs == nil {
+		return nil, errors.New("no blob store set for story '" + s.Name + "'")
+	}
+
+	return s.blobs.Get(ref)
+}
+
+// LoadExtensions loads sources for the extensions given from the blob store given, if not already
+// loaded.
+func loadExtensions(blobs blob.Store, list []*Extension) error {
+	var err error
+	for _, e := range list {
+		e.migrate()
+		if e.Source == nil && e.SourceRef != "" {
+			if e.Source, err = blobs.Get(e.SourceRef); err != nil {
+				return errors.Wrapf(err, "loading source for extension '%s' failed", e.Name())
+			}
+		}
+	}
+
+	return nil
+}
+
+// StoreExtensions moves sources for the extensions given into the blob store given, where these are
+// loaded, and sets references to them.
+func storeExtensions(blobs blob.Store, list []*Extension) error {
+	var err error
+	for _, e := range list {
+		e.migrate()
+		if e.Source == nil {
+			continue
+		} else if e.SourceRef, err = blobs.Put(e.Source); err != nil {
+			return errors.Wrapf(err, "storing source for extension '%s' failed", e.Name())
+		}
+	}
+
+	return nil
+}
+
+// StoreAuthor stores the author given, moving any story sources, compiled story files, and extension
+// sources into the blob store beforehand, so that the stored author holds only references to these.
+func (n *Inform) storeAuthor(author *Author) error {
+	for _, s := range author.Stories {
+		if err := s.store(n.config.Blobs); err != nil {
+			return err
+		}
+	}
+	if err := storeExtensions(n.config.Blobs, author.Extensions); err != nil {
+		return err
+	}
+
+	return n.bot.Store.Set(keyPrefix+".author."+author.ID, author)
+}
+
+// CompileCached compiles the story given, reusing any build kept for a story with an identical source,
+// format, extensions and compiler version in place of compiling again. Successful builds are kept
+// for later reuse.
+func (n *Inform) compileCached(ctx context.Context, story *Story, extensions []*Extension) error {
+	var key = buildCacheKey(n.config.Compiler, story, extensions)
+	var cached cachedBuild
+
+	if ok, err := n.bot.Store.Get(key, &cached); err != nil {
+		n.bot.Logger.Warn("Loading cached build failed", zap.String("story", story.Ref()), zap.Error(err))
+	} else if ok && cached.Log != nil {
+		if build, err := n.config.Blobs.Get(cached.BuildRef); err != nil {
+			n.bot.Logger.Warn("Loading cached build failed", zap.String("story", story.Ref()), zap.Error(err))
+		} else {
+			story.setLog(cached.Log)
+			story.Build, story.BuildFormat, story.UpdatedAt = build, cached.BuildFormat, time.Now().UTC()
+			return nil
+		}
+	}
+
+	if err := story.Compile(ctx, n.config, extensions); err != nil {
+		return err
+	}
+
+	// Builds are stored under lock, so that these are not removed as unreferenced before the cached
+	// build referring to them is stored.
+	n.dataMu.Lock()
+	defer n.dataMu.Unlock()
+
+	ref, err := n.config.Blobs.Put(story.Build)
+	if err == nil {
+		err = n.bot.Store.Set(key, cachedBuild{
+			SourceRef:   blob.Key(story.Source),
+			BuildRef:    ref,
+			BuildFormat: story.BuildFormat,
+			Log:         story.Log,
+		})
+	}
+	if err != nil {
+		n.bot.Logger.Warn("Storing cached build failed", zap.String("story", story.Ref()), zap.Error(err))
+	}
+
+	return nil
+}
+
+// BuildCacheKey returns the key cached builds are stored under for the compiler, story and extensions
+// given, which is derived from the compiler type and version, if known, the story source, the format
+// requested, and the extensions given.
+func buildCacheKey(compiler Compiler, story *Story, extensions []*Extension) string {
+	var version = fmt.Sprintf("%T", compiler)
+	if c, ok := compiler.(VersionedCompiler); ok {
+		version += "\x00" + c.Version()
+	}
+
+	var h = sha256.New()
+	h.Write([]byte(version + "\x00" + story.Format + "\x00" + blob.Key(story.Source) + "\x00"))
+	for _, e := range extensions {
+		h.Write([]byte(e.Name() + "\x00" + blob.Key(e.Source) + "\x00"))
+	}
+
+	return buildCachePrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// CollectGarbage removes data no longer referenced by any story or extension, such as sources and
+// compiled story files left behind by removed stories, revisions, and extensions. Cached builds are
+// removed once their story source is no longer referenced, and blobs once referenced by neither
+// stories, extensions, nor cached builds.
+func (n *Inform) collectGarbage() {
+	n.dataMu.Lock()
+	defer n.dataMu.Unlock()
+
+	if err := n.removeUnreferenced(); err != nil {
+		n.bot.Logger.Warn("Removing unreferenced data failed", zap.Error(err))
+	}
+}
+
+// RemoveUnreferenced removes cached builds and blobs not referenced by any story or extension, as
+// described for collectGarbage, which is expected to be called with the data lock held.
+func (n *Inform) removeUnreferenced() error {
+	keys, err := n.bot.Store.Keys()
+	if err != nil {
+		return errors.Wrap(err, "listing keys failed")
+	}
+
+	// Collect references held by shared extensions, and by stories, their revisions, and extensions
+	// for all authors.
+	shared, err := n.sharedExtensions()
+	if err != nil {
+		return err
+	}
+
+	var refs, builds = make(map[string]bool), []string{}
+	for _, e := range shared {
+		refs[e.SourceRef] = true
+	}
+
+	for _, k := range keys {
+		if strings.HasPrefix(k, buildCachePrefix) {
+			builds = append(builds, k)
+			continue
+		} else if !strings.HasPrefix(k, keyPrefix+".author.") {
+			continue
+		}
+
+		author, err := n.loadAuthor(strings.TrimPrefix(k, keyPrefix+".author."))
+		if err != nil {
+			return err
+		}
+
+		for _, s := range author.Stories {
+			refs[s.SourceRef], refs[s.BuildRef] = true, true
+			for _, r := range s.Revisions {
+				refs[r.SourceRef] = true
+			}
+		}
+		for _, e := range author.Extensions {
+			refs[e.SourceRef] = true
+		}
+	}
+
+	// Remove cached builds for sources no longer referenced, and keep references for the remainder.
+	var cachedRefs = make(map[string]bool)
+	for _, k := range builds {
+		var cached cachedBuild
+		if ok, err := n.bot.Store.Get(k, &cached); err != nil {
+			return errors.Wrap(err, "loading cached build failed")
+		} else if ok && refs[cached.SourceRef] {
+			cachedRefs[cached.BuildRef] = true
+		} else if _, err := n.bot.Store.Delete(k); err != nil {
+			return errors.Wrap(err, "removing cached build failed")
+		}
+	}
+
+	blobs, err := n.config.Blobs.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range blobs {
+		if refs[k] || cachedRefs[k] {
+			continue
+		} else if err := n.config.Blobs.Delete(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// DefaultLanguage is the language messages and templates are defined in, and is used for anything not
+// translated to the language requested.
+const DefaultLanguage = "en"
+
+// Translations built into the bot, laid out as expected by loadCatalog.
+//
+//go:embed locale
+var localeFS embed.FS
+
+// CatalogNames lists the names of all messages and templates defined, which translations refer to.
+var catalogNames = make(map[string]bool)
+
+// Message represents a named message, as defined in the default language, and formatted with any
+// arguments given when sent.
+type message struct {
+	name string
+	text string
+}
+
+// NewMessage returns a message with the name and default text given, registering the name for use in
+// translations.
+func newMessage(name, text string) *message {
+	catalogNames[name] = true
+	return &message{name: name, text: text}
+}
+
+// ParseTemplate returns a template with the name and default content given, registering the name for
+// use in translations.
+func parseTemplate(name, content string) *template.Template {
+	catalogNames[name] = true
+	return template.Must(template.New(name).Funcs(templateFuncs(time.UTC)).Parse(content))
+}
+
+// TemplateFuncs returns the functions available to templates, where times are shown in the time zone
+// given, e.g. '{{(localtime .CreatedAt).Format "02 Jan 2006 15:04"}}'.
+func templateFuncs(loc *time.Location) template.FuncMap {
+	return template.FuncMap{
+		"localtime": func(t time.Time) time.Time { return t.In(loc) },
+	}
+}
+
+// Catalog represents translations for messages and templates, where each translation is a named
+// template, e.g. '{{define "added-story"}}...{{end}}', and the name refers to a message or template
+// defined in the default language. Anything not translated is sent as originally defined.
+type catalog struct {
+	languages map[string]*template.Template // Sets of translations, against their language.
+}
+
+// Lookup returns the translation with the name given, either for the language given, or for the
+// default language, where the default text has been overridden. A nil value is returned if neither
+// are found.
+func (c *catalog) lookup(lang, name string) *template.Template {
+	for _, l := range []string{lang, DefaultLanguage} {
+		if set, ok := c.languages[l]; ok {
+			if t := set.Lookup(name); t != nil {
+				return t
+			}
+		}
+	}
+
+	return nil
+}
+
+// Message returns the text for the message given in the language given, formatted with any
+// arguments given.
+func (c *catalog) message(lang string, msg *message, args ...interface{}) string {
+	var text = msg.text
+	if t := c.lookup(lang, msg.name); t != nil {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, nil); err == nil {
+			text = buf.String()
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+
+	return text
+}
+
+// Template returns the translation for the template given in the language given, or the template
+// itself, if no translation is found.
+func (c *catalog) template(lang string, t *template.Template) *template.Template {
+	if l := c.lookup(lang, t.Name()); l != nil {
+		return l
+	}
+
+	return t
+}
+
+// Supports returns whether or not the language given has any translations, or is the default
+// language.
+func (c *catalog) supports(lang string) bool {
+	_, ok := c.languages[lang]
+	return ok || lang == DefaultLanguage
+}
+
+// List returns all languages supported, in lexical order.
+func (c *catalog) list() []string {
+	var langs = []string{DefaultLanguage}
+	for l := range c.languages {
+		if l != DefaultLanguage {
+			langs = append(langs, l)
+		}
+	}
+
+	sort.Strings(langs)
+	return langs
+}
+
+// LoadCatalog returns a catalog of translations built into the bot, overridden by any translations
+// found in the directory given, if any. Translations are expected in a directory for each language,
+// e.g. 'fr', holding any number of '.tmpl' files, and may also override messages and templates for
+// the default language itself.
+func loadCatalog(dir string) (*catalog, error) {
+	builtin, err := fs.Sub(localeFS, "locale")
+	if err != nil {
+		return nil, errors.Wrap(err, "loading built-in translations failed")
+	}
+
+	var sources = []fs.FS{builtin}
+	if dir != "" {
+		sources = append(sources, os.DirFS(dir))
+	}
+
+	var c = &catalog{languages: make(map[string]*template.Template)}
+	for _, fsys := range sources {
+		if err := c.parse(fsys); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Parse adds translations found in the file system given to the catalog, replacing any existing
+// translations of the same name and language.
+func (c *catalog) parse(fsys fs.FS) error {
+	dirs, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return errors.Wrap(err, "reading translations failed")
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		files, err := fs.Glob(fsys, path.Join(d.Name(), "*.tmpl"))
+		if err != nil {
+			return errors.Wrap(err, "reading translations failed")
+		} else if len(files) == 0 {
+			continue
+		}
+
+		var lang = strings.ToLower(d.Name())
+		if c.languages[lang] == nil {
+			c.languages[lang] = template.New(lang).Funcs(templateFuncs(time.UTC))
+		}
+
+		for _, name := range files {
+			data, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return errors.Wrapf(err, "reading translation file '%s' failed", name)
+			} else if _, err = c.languages[lang].Parse(string(data)); err != nil {
+				return errors.Wrapf(err, "parsing translation file '%s' failed", name)
+			}
+		}
+
+		// Translations are checked against known names, so that typos aren't silently ignored.
+		for _, t := range c.languages[lang].Templates() {
+			if t.Name() != lang && !catalogNames[t.Name()] {
+				return errors.Errorf("translation '%s' for language '%s' does not match any known message", t.Name(), lang)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Message returns the text for the message given, in the language set for the channel given, and
+// formatted with any arguments given.
+func (n *Inform) message(channel string, msg *message, args ...interface{}) string {
+	return n.catalog.message(n.language(channel), msg, args...)
+}
+
+// Language returns the language set for the channel given, or the default language, if none is set.
+func (n *Inform) language(channel string) string {
+	return n.channelOptions(channel).language()
+}
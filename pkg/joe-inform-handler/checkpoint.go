@@ -0,0 +1,239 @@
+package inform
+
+import (
+	// Standard library
+	"context"
+	"strings"
+	"time"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Checkpoint represents the persisted state of an active session, which is updated after every
+// command and is used in resuming sessions across restarts.
+type Checkpoint struct {
+	AuthorID  string    // The author ID, corresponds to Author.ID.
+	Story     string    // The story name, corresponds to Story.Name.
+	Owner     string    // The author ID currently in control of the session.
+	Channel   string    // The channel the session is shared in, if any.
+	Notify    string    // The channel last used for interacting with the session.
+	StartedAt time.Time // The UTC timestamp the session was first started on.
+	UpdatedAt time.Time // The UTC timestamp this checkpoint was last updated on.
+
+	// The number of the transcript being recorded for the session, if any.
+	Transcript int `json:",omitempty"`
+
+	// The most recent save file produced by the interpreter, if any, and the list of commands given
+	// since that save was made.
+	Save []byte
+	Log  []string
+}
+
+// CheckpointKey returns the key used for storing the checkpoint for the given session.
+func checkpointKey(sess *Session) string {
+	return keyPrefix + ".session." + sess.key()
+}
+
+// Checkpoint intervals, in number of commands given since interpreter state was last saved, and in
+// time spent idle with commands given since.
+const (
+	checkpointSaveInterval = 10
+	checkpointIdleInterval = 2 * time.Minute
+)
+
+// Checkpoint stores the current state of the session, along with any commands given since the last
+// successful save. Interpreter state is only saved once every few commands, as the command log can be
+// replayed in between; use SaveCheckpoint where interpreter state needs to be saved immediately.
+func (n *Inform) Checkpoint(sess *Session) error {
+	return n.checkpoint(sess, len(sess.log) >= checkpointSaveInterval)
+}
+
+// SaveCheckpoint saves the current state of the session and stores it. This is required where state
+// changes in ways not reflected in the command log, e.g. when restoring from an explicit save.
+func (n *Inform) SaveCheckpoint(sess *Session) error {
+	return n.checkpoint(sess, true)
+}
+
+// Checkpoint stores the current state of the session, saving interpreter state if requested. Failing
+// to save interpreter state is not considered fatal, as the command log can be replayed instead.
+func (n *Inform) checkpoint(sess *Session, save bool) error {
+	var cp = &Checkpoint{
+		AuthorID:  sess.story.AuthorID,
+		Story:     sess.story.Name,
+		Owner:     sess.owner,
+		Channel:   sess.channel,
+		Notify:    sess.notify,
+		StartedAt: sess.startedAt.UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	if sess.transcript != nil {
+		cp.Transcript = sess.transcript.Number
+	}
+
+	if save && !sess.halted() {
+		if data, err := sess.Save(); err == nil {
+			sess.log, sess.checkpoint = nil, data
+		}
+	}
+
+	cp.Save, cp.Log = sess.checkpoint, sess.log
+	return n.bot.Store.Set(checkpointKey(sess), cp)
+}
+
+// RemoveCheckpoint removes any stored checkpoint for the given session.
+func (n *Inform) RemoveCheckpoint(sess *Session) error {
+	_, err := n.bot.Store.Delete(checkpointKey(sess))
+	return err
+}
+
+// Rehydrate starts sessions for all stored checkpoints, restoring interpreter state from saved data
+// and replaying any commands given since. Sessions that cannot be resumed (e.g. because the story
+// has since been removed) have their checkpoints removed.
+func (n *Inform) rehydrate(ctx context.Context) error {
+	keys, err := n.bot.Store.Keys()
+	if err != nil {
+		return errors.Wrap(err, "listing checkpoints failed")
+	}
+
+	var prefix = keyPrefix + ".session."
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		var cp = &Checkpoint{}
+		if ok, err := n.bot.Store.Get(k, cp); err != nil || !ok {
+			continue
+		}
+
+		sess, err := n.resume(ctx, cp)
+		if err != nil {
+			n.bot.Logger.Warn("Resuming session failed, removing checkpoint",
+				zap.String("author", cp.AuthorID), zap.Error(err))
+			if _, err := n.bot.Store.Delete(k); err != nil {
+				return errors.Wrap(err, "removing checkpoint failed")
+			}
+			continue
+		}
+
+		n.sessions[sess.key()] = sess
+	}
+
+	return nil
+}
+
+// Resume starts a new session for the given checkpoint, bringing it to the state it was in when the
+// checkpoint was last updated.
+func (n *Inform) resume(ctx context.Context, cp *Checkpoint) (*Session, error) {
+	author, err := n.loadAuthor(cp.AuthorID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions for stories shared by other authors are only resumed while the story is still shared.
+	story, err := author.GetStory(cp.Story)
+	if err != nil {
+		return nil, err
+	} else if !story.CanAccess(cp.Owner) {
+		return nil, errors.New("story '" + story.Ref() + "' is no longer shared with '" + cp.Owner + "'")
+	}
+
+	sess, err := NewSession(story)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.checkpoint, sess.log = cp.Save, cp.Log
+	if err = sess.restart(ctx, n.config); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+
+	sess.owner, sess.channel, sess.notify, sess.restored = cp.Owner, cp.Channel, cp.Notify, true
+
+	// Sessions for stories shared by other authors use the options set for the owner, where these can
+	// still be found.
+	if sess.options = author.Options; cp.Owner != cp.AuthorID {
+		if owner, err := n.loadAuthor(cp.Owner); err == nil {
+			sess.options = owner.Options
+		} else {
+			sess.options = defaultOptions
+		}
+	}
+
+	// Sessions keep their original start time, so that their maximum lifetime is not extended across
+	// restarts. Checkpoints stored by earlier versions have no start time set.
+	if !cp.StartedAt.IsZero() {
+		sess.startedAt = cp.StartedAt
+	}
+
+	// Transcripts being recorded continue being recorded, as long as they can still be found.
+	if cp.Transcript > 0 {
+		if sess.transcript, err = loadTranscript(n.bot.Store, sess.owner, sess.saveStory(), cp.Transcript); err != nil {
+			n.bot.Logger.Warn("Resuming transcript failed", zap.String("author", cp.AuthorID), zap.Error(err))
+		}
+	}
+
+	return sess, nil
+}
+
+// Restart starts the interpreter for the session, and brings it to the state it was in when the last
+// checkpoint was taken, replaying any commands given since. Any output produced is discarded.
+func (s *Session) restart(ctx context.Context, conf *Config) error {
+	if err := s.Start(ctx, conf); err != nil {
+		return err
+	}
+
+	if s.checkpoint != nil {
+		if err := s.Restore(s.checkpoint); err != nil {
+			s.halt()
+			return err
+		}
+	}
+
+	var log = s.log
+	for s.log = nil; len(log) > 0; log = log[1:] {
+		if err := s.Run(log[0]); err != nil {
+			s.halt()
+			return err
+		}
+	}
+
+	s.Output()
+	return nil
+}
+
+// Shutdown stops all active sessions, leaving their checkpoints in place for resuming the next time
+// the bot is started. Interpreter state is saved for any sessions with commands given since their
+// last checkpoint save, so that these need not be replayed.
+func (n *Inform) Shutdown(joe.ShutdownEvent) {
+	n.mu.Lock()
+	var sessions = make([]*Session, 0, len(n.sessions))
+	for id, sess := range n.sessions {
+		sessions = append(sessions, sess)
+		delete(n.sessions, id)
+	}
+	n.mu.Unlock()
+
+	for _, sess := range sessions {
+		if !sess.lock() {
+			continue
+		} else if len(sess.log) > 0 {
+			if err := n.SaveCheckpoint(sess); err != nil {
+				n.bot.Logger.Warn("Storing checkpoint failed", zap.Error(err))
+			}
+		}
+		if err := sess.Close(); err != nil {
+			n.bot.Logger.Warn("Stopping session failed", zap.Error(err))
+		}
+
+		sess.ended = true
+		sess.mu.Unlock()
+	}
+
+	n.cancel()
+}
@@ -0,0 +1,786 @@
+package inform
+
+import (
+	// Standard library
+	"strings"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-attachment"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Commands lists all meta-commands understood by the bot, grouped by topic, in the order they are
+// listed in help.
+var commands = newRouter([]*command{
+	{
+		Usage:   "help [<topic...>]",
+		Aliases: []string{"h"},
+		Summary: "Shows help on all commands, or on a topic or command given, e.g. 'help story' or 'help story add'.",
+		guest:   true,
+		run:     (*Inform).cmdHelp,
+	},
+	{
+		Usage:   "story list [<author>]",
+		Aliases: []string{"story", "stories", "stories list", "list stories", "s"},
+		Summary: "Lists your stories, or the stories shared with you by the author given.",
+		run:     (*Inform).cmdStoryList,
+	},
+	{
+		Usage:   "story add <name> [<url>]",
+		Aliases: []string{"stories add", "add stories"},
+		Summary: "Adds a story, or replaces the source for an existing story, and compiles it.",
+		Help: `The story source is fetched from the URL given, or taken from a file sent along with the command, or sent in the next message.
+Story names need to be one word (though they can contain hyphens or underscores), and not contain any spaces or other white-space characters.`,
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryAdd,
+	},
+	{
+		Usage:   "story new <name> <source...>",
+		Aliases: []string{"stories new"},
+		Summary: "Adds a story with the source given, and compiles it.",
+		Help: `The source can start on the line after the command, and span multiple lines, e.g.:
+story new some-name
+The Kitchen is a room.`,
+		missing: messageUnknownStorySource,
+		run:     (*Inform).cmdStoryNew,
+	},
+	{
+		Usage:   "story show <name> [<lines...>]",
+		Aliases: []string{"stories show"},
+		Summary: "Shows the story source, with line numbers, either from the start or for the lines given, e.g. '12-20'.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryShow,
+	},
+	{
+		Usage:   "story edit <name> <lines> <text...>",
+		Aliases: []string{"stories edit"},
+		Summary: "Replaces the line given, or range of lines, e.g. '12-14', with the text given.",
+		Help:    "The text can start on the line after the command, and span multiple lines. See the current story source, with line numbers, with 'story show <name>'.",
+		missing: messageUnknownEdit,
+		run:     (*Inform).cmdStoryEdit,
+	},
+	{
+		Usage:   "story insert <name> <line> <text...>",
+		Aliases: []string{"stories insert"},
+		Summary: "Adds the text given before the line given.",
+		Help:    "The text can start on the line after the command, and span multiple lines. See the current story source, with line numbers, with 'story show <name>'.",
+		missing: messageUnknownEdit,
+		run:     (*Inform).cmdStoryEdit,
+	},
+	{
+		Usage:   "story delete <name> <lines...>",
+		Aliases: []string{"stories delete"},
+		Summary: "Removes the line given, or range of lines, e.g. '12-14'.",
+		missing: messageUnknownEdit,
+		run:     (*Inform).cmdStoryEdit,
+	},
+	{
+		Usage:   "story append <name> <text...>",
+		Aliases: []string{"stories append"},
+		Summary: "Adds the text given as a new paragraph at the end of the story.",
+		Help:    "The text can start on the line after the command, and span multiple lines.",
+		missing: messageUnknownEdit,
+		run:     (*Inform).cmdStoryEdit,
+	},
+	{
+		Usage:   "story history <name>",
+		Aliases: []string{"stories history"},
+		Summary: "Lists previous revisions of the story source.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryHistory,
+	},
+	{
+		Usage:   "story diff <name> <from> [<to>]",
+		Aliases: []string{"stories diff"},
+		Summary: "Shows changes to the story source between two revisions, or between a revision and the current source.",
+		missing: messageUnknownRevision,
+		run:     (*Inform).cmdStoryDiff,
+	},
+	{
+		Usage:   "story rollback <name> <revision>",
+		Aliases: []string{"stories rollback"},
+		Summary: "Sets the story source to that of the revision given, saving it as a new revision.",
+		missing: messageUnknownRevision,
+		run:     (*Inform).cmdStoryRollback,
+	},
+	{
+		Usage:   "story share <name> <visibility>",
+		Aliases: []string{"stories share"},
+		Summary: "Sets who else can play and copy the story.",
+		Help:    "Supported visibilities are 'private', where only those you grant access to can play the story, 'unlisted', where anyone who knows the story name can play it, and 'public', where the story is also listed for everyone.",
+		missing: messageUnknownVisibility,
+		run:     (*Inform).cmdStoryShare,
+	},
+	{
+		Usage:   "story grant <name> <author>",
+		Aliases: []string{"stories grant"},
+		Summary: "Allows the author given to play and copy the story, e.g. 'story grant some-name someone@example.com'.",
+		missing: messageUnknownGrant,
+		run:     (*Inform).cmdStoryGrant,
+	},
+	{
+		Usage:   "story revoke <name> <author>",
+		Aliases: []string{"stories revoke"},
+		Summary: "Removes access to the story previously granted to the author given.",
+		missing: messageUnknownGrant,
+		run:     (*Inform).cmdStoryRevoke,
+	},
+	{
+		Usage:   "story fork <story> [<name>]",
+		Aliases: []string{"stories fork"},
+		Summary: "Copies a story shared with you to your own stories, optionally with a new name.",
+		Help:    "Stories shared by others are referred to by their author and name, e.g. 'story fork someone@example.com/some-name my-name'.",
+		missing: messageUnknownFork,
+		run:     (*Inform).cmdStoryFork,
+	},
+	{
+		Usage:   "story compile <name>",
+		Aliases: []string{"stories compile"},
+		Summary: "Compiles the story again.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryCompile,
+	},
+	{
+		Usage:   "story cancel <name>",
+		Aliases: []string{"stories cancel"},
+		Summary: "Stops compiling the story, whether queued or running.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryCancel,
+	},
+	{
+		Usage:   "story format <name> <format>",
+		Aliases: []string{"stories format"},
+		Summary: "Sets the story file format the story is compiled to, and compiles it again.",
+		Help:    "Supported formats are 'z5', 'z8', 'glulx', and 'auto', which compiles to 'z8' unless the story is too large, in which case 'glulx' is used.",
+		missing: messageUnknownFormat,
+		run:     (*Inform).cmdStoryFormat,
+	},
+	{
+		Usage:   "story problems <name>",
+		Aliases: []string{"stories problems"},
+		Summary: "Lists problems found when the story was last compiled.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryProblems,
+	},
+	{
+		Usage:   "story remove <name>",
+		Aliases: []string{"stories remove", "story rem", "stories rem"},
+		Summary: "Removes the story, along with any saves and transcripts for it.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryRemove,
+	},
+	{
+		Usage:   "story start <story>",
+		Aliases: []string{"stories start"},
+		Summary: "Starts playing the story, either one of your own, or one shared with you, e.g. 'someone@example.com/some-name'.",
+		Help:    "While playing, anything you send is passed to the story. Commands for the bot need to be given a prefix, e.g. '?story end', and progress can be kept with 'save' and 'restore', or recorded with 'script' and 'unscript'.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStoryStart,
+	},
+	{
+		Usage:   "story end",
+		Aliases: []string{"stories end"},
+		Summary: "Ends the story you're currently playing.",
+		run:     (*Inform).cmdStoryEnd,
+	},
+	{
+		Usage:   "story status",
+		Aliases: []string{"stories status", "status"},
+		Summary: "Shows the status line for the story you're currently playing, e.g. the current location and score.",
+		Help:    "The status line can also be shown with every response, with 'option set statusline on'.",
+		guest:   true,
+		run:     (*Inform).cmdStoryStatus,
+	},
+	{
+		Usage:   "story saves <story>",
+		Aliases: []string{"stories saves"},
+		Summary: "Lists your saves for the story.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdStorySaves,
+	},
+	{
+		Usage:   "story transcripts <story>",
+		Aliases: []string{"stories transcripts"},
+		Summary: "Lists transcripts recorded for the story.",
+		Help:    "Transcripts are recorded by using 'script' while playing a story, and 'unscript' to stop.",
+		missing: messageUnknownTranscript,
+		run:     (*Inform).cmdStoryTranscripts,
+	},
+	{
+		Usage:   "story transcript <story> [<number>] [<format>]",
+		Aliases: []string{"stories transcript"},
+		Summary: "Shows the transcript with the number given, or the latest transcript recorded for the story.",
+		Help:    "Supported formats are 'text', 'markdown' and 'html', e.g. 'story transcript some-name 2 markdown'.",
+		missing: messageUnknownTranscript,
+		run:     (*Inform).cmdStoryTranscript,
+	},
+	{
+		Usage:   "channel status",
+		Aliases: []string{"channel"},
+		Summary: "Shows the story being played in this channel, if any.",
+		guest:   true,
+		run:     (*Inform).cmdChannelStatus,
+	},
+	{
+		Usage:   "channel start <story>",
+		Summary: "Starts playing the story for everyone in this channel.",
+		Help:    "Anyone here can send commands to the story, but only the person in control can end the session or hand over control.",
+		missing: messageUnknownStory,
+		run:     (*Inform).cmdChannelStart,
+	},
+	{
+		Usage:   "channel end",
+		Summary: "Ends the story being played in this channel, if you're in control of it.",
+		run:     (*Inform).cmdChannelEnd,
+	},
+	{
+		Usage:   "channel control <author>",
+		Aliases: []string{"channel handover"},
+		Summary: "Hands over control of the story played in this channel, e.g. 'channel control someone@example.com'.",
+		missing: messageUnknownChannelOwner,
+		run:     (*Inform).cmdChannelControl,
+	},
+	{
+		Usage:   "extension list",
+		Aliases: []string{"extension", "extensions", "extensions list", "list extensions"},
+		Summary: "Lists extensions available to your stories.",
+		run:     (*Inform).cmdExtensionList,
+	},
+	{
+		Usage:   "extension add [shared] [<url>]",
+		Aliases: []string{"extensions add"},
+		Summary: "Adds an Inform 7 extension for your stories, or for everyone's stories, if 'shared' is given.",
+		Help:    "The extension is fetched from the URL given, or taken from a file sent along with the command, or sent in the next message. Only administrators can add shared extensions.",
+		run:     (*Inform).cmdExtensionAdd,
+	},
+	{
+		Usage:   "extension remove [shared] <name...>",
+		Aliases: []string{"extensions remove", "extension rem", "extensions rem"},
+		Summary: "Removes the extension with the full name given, e.g. 'extension remove Basic Screen Effects by Emily Short'.",
+		Help:    "Shared extensions are removed with 'extension remove shared <name>'.",
+		missing: messageUnknownExtension,
+		run:     (*Inform).cmdExtensionRemove,
+	},
+	{
+		Usage:   "option list",
+		Aliases: []string{"option", "options", "options list", "list options", "o"},
+		Summary: "Lists your options, along with a description of each.",
+		run:     (*Inform).cmdOptionList,
+	},
+	{
+		Usage:   "option set <name> <value>",
+		Aliases: []string{"options set", "set option", "set options"},
+		Summary: "Sets the option given, e.g. 'option set prefix ?' or 'option set language fr'.",
+		Help:    "See the options available, and the values each option takes, with 'option list'.",
+		missing: messageUnknownOption,
+		run:     (*Inform).cmdOptionSet,
+	},
+	{
+		Usage:   "option reset [<name>]",
+		Aliases: []string{"options reset", "reset option", "reset options"},
+		Summary: "Sets the option given back to its default value, or all options, if none is given.",
+		run:     (*Inform).cmdOptionReset,
+	},
+})
+
+// HelpTopic represents the data passed to the help templates, for a single topic.
+type helpTopic struct {
+	Name     string
+	Commands []*command
+}
+
+// CommandUsage represents the data passed to the command usage template.
+type commandUsage struct {
+	Command *command
+	Error   string
+}
+
+// UnknownCommand represents the data passed to the unknown command template.
+type unknownCommand struct {
+	Command    string
+	Suggestion string // The most similar command name, if any.
+	Topic      string // The topic the command was given under, if any.
+}
+
+// LocalCommand returns a copy of the command given, with its summary and help text translated to the
+// language set for the channel given.
+func (n *Inform) localCommand(channel string, c *command) *command {
+	var local = *c
+	local.Summary, local.Help = n.message(channel, c.summary()), n.message(channel, c.help())
+	return &local
+}
+
+// LocalCommands returns copies of the commands given, as translated by localCommand.
+func (n *Inform) localCommands(channel string, list []*command) []*command {
+	var local = make([]*command, len(list))
+	for i := range list {
+		local[i] = n.localCommand(channel, list[i])
+	}
+
+	return local
+}
+
+func (n *Inform) cmdHelp(req *request) error {
+	var rt, topic = req.router, strings.ToLower(strings.Join(strings.Fields(req.arg("topic")), " "))
+	if topic == "" {
+		var topics []helpTopic
+		for _, name := range rt.topicNames() {
+			topics = append(topics, helpTopic{Name: name, Commands: n.localCommands(req.channel, rt.topic(name))})
+		}
+		return n.SayTemplate(req.channel, templateHelp, topics)
+	} else if list := rt.topic(topic); len(list) > 0 && rt.topics[topic] {
+		return n.SayTemplate(req.channel, templateHelpTopic, helpTopic{Name: topic, Commands: n.localCommands(req.channel, list)})
+	} else if cmd := rt.find(topic); cmd != nil {
+		return n.SayTemplate(req.channel, templateCommandUsage, commandUsage{Command: n.localCommand(req.channel, cmd)})
+	}
+
+	return n.SayTemplate(req.channel, templateUnknownHelp, unknownCommand{
+		Command:    topic,
+		Suggestion: rt.suggest(strings.Fields(topic)),
+	})
+}
+
+func (n *Inform) cmdStoryList(req *request) error {
+	// Stories shared by other authors are listed when an author ID is given.
+	if id := req.arg("author"); id == "" || id == req.author.ID {
+		return n.SayTemplate(req.channel, templateStoryList, req.author)
+	} else if list, err := n.SharedStories(id, req.author.ID); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.SayTemplate(req.channel, templateSharedStoryList, list)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryAdd(req *request) error {
+	// Story sources are either fetched from the URL given, taken from files attached to the command
+	// itself, or expected in a follow-up message.
+	var u = &upload{story: req.arg("name")}
+	if _, err := req.author.GetStory(u.story); err != nil {
+		if err = validateStoryName(u.story); err != nil {
+			n.Say(req.channel, messageInvalidStory, err)
+			return nil
+		}
+	}
+
+	if url := req.arg("url"); url != "" {
+		return n.FetchUpload(req.ctx, req.channel, req.author, u, attachment.Attachment{URL: url})
+	} else if files := attachment.From(req.event); len(files) > 0 {
+		return n.FetchUpload(req.ctx, req.channel, req.author, u, files[0])
+	}
+
+	n.expectUpload(req.author.ID, u, time.Now())
+	n.Say(req.channel, messageExpectingUpload, u.story, n.config.UploadTimeout)
+	return nil
+}
+
+func (n *Inform) cmdStoryNew(req *request) error {
+	if _, err := req.author.GetStory(req.arg("name")); err == nil {
+		n.Say(req.channel, messageInvalidStory, "a story named '"+req.arg("name")+"' already exists")
+		return nil
+	}
+
+	return n.AddStory(req.channel, req.author, req.arg("name"), []byte(req.arg("source")))
+}
+
+func (n *Inform) cmdStoryShow(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		// Line ranges may be given with spaces, e.g. '12 - 20'.
+		return n.ShowStory(req.channel, story, strings.Join(strings.Fields(req.arg("lines")), ""))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryEdit(req *request) error {
+	var op = strings.Fields(req.command.Name())[1]
+	var lines = strings.Join(strings.Fields(req.arg("lines")+req.arg("line")), "")
+
+	return n.EditStory(req.channel, req.author, op, req.arg("name"), lines, req.arg("text"))
+}
+
+func (n *Inform) cmdStoryHistory(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.SayTemplate(req.channel, templateStoryHistory, story)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryDiff(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.DiffStory(req.channel, story, req.arg("from"), req.arg("to"))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryRollback(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if num, err := parseRevision(req.arg("revision")); err != nil {
+		n.Say(req.channel, messageInvalidRevision, err)
+	} else if err = story.Rollback(num); err != nil {
+		n.Say(req.channel, messageInvalidRevision, err)
+	} else {
+		return n.CompileStory(req.channel, req.author, story, n.message(req.channel, messageRolledBackStory, story.Name, num, story.Current().Number))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryShare(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err := story.SetVisibility(req.arg("visibility")); err != nil {
+		n.Say(req.channel, messageInvalidSharing, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.Say(req.channel, messageSharedStory, story.Name, strings.ToLower(req.arg("visibility")), story.Ref())
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryGrant(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err = story.Grant(req.arg("author")); err != nil {
+		n.Say(req.channel, messageInvalidSharing, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.Say(req.channel, messageGrantedStory, req.arg("author"), story.Name, story.Ref())
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryRevoke(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err = story.Revoke(req.arg("author")); err != nil {
+		n.Say(req.channel, messageInvalidSharing, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.Say(req.channel, messageRevokedStory, req.arg("author"), story.Name)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryFork(req *request) error {
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if fork, err := req.author.ForkStory(story, req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.CompileStory(req.channel, req.author, fork, n.message(req.channel, messageForkedStory, story.Ref(), fork.Name))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryCompile(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.CompileStory(req.channel, req.author, story, n.message(req.channel, messageCompiledStory, story.Name))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryCancel(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err = n.CancelCompile(story); err != nil {
+		n.Say(req.channel, messageInvalidCancel, err)
+	} else {
+		n.Say(req.channel, messageCancelledCompile, story.Name)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryFormat(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err := story.SetFormat(req.arg("format")); err != nil {
+		n.Say(req.channel, messageInvalidFormat, err)
+	} else {
+		return n.CompileStory(req.channel, req.author, story, n.message(req.channel, messageSetFormat, story.Name, strings.ToLower(req.arg("format"))))
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryProblems(req *request) error {
+	if story, err := req.author.GetStory(req.arg("name")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.SayTemplate(req.channel, templateStoryProblems, story)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryRemove(req *request) error {
+	var name = req.arg("name")
+	var ref = (&Story{AuthorID: req.author.ID, Name: name}).Ref() // Used by other authors for shared stories.
+	if count := n.storySessions(req.author.ID, name); count > 0 {
+		n.Say(req.channel, messageStoryInUse, name, count)
+	} else if err := req.author.RemoveStory(name); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else if err = removeSaves(n.bot.Store, req.author.ID, name); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else if err = removeTranscripts(n.bot.Store, req.author.ID, name); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else if err = removeStorySaves(n.bot.Store, ref); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else if err = removeStoryTranscripts(n.bot.Store, ref); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.Say(req.channel, messageRemovedStory, name)
+		go n.collectGarbage()
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryStart(req *request) error {
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if sess := n.session(sessionKey(req.author.ID, "")); sess != nil {
+		n.Say(req.channel, messageActiveSession, sess.story.Name)
+	} else {
+		return n.StartSession(req.channel, req.author, story, "")
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryEnd(req *request) error {
+	var sess = n.session(sessionKey(req.author.ID, ""))
+	if sess == nil || !sess.lock() {
+		n.Say(req.channel, messageNoSession)
+		return nil
+	}
+
+	defer sess.mu.Unlock()
+	if err := n.EndSession(sess); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	}
+
+	n.Say(req.channel, messageEndedSession, sess.story.Name)
+	return nil
+}
+
+func (n *Inform) cmdStoryStatus(req *request) error {
+	var sess = n.session(sessionKey("", req.channel))
+	if sess == nil {
+		sess = n.session(sessionKey(req.author.ID, ""))
+	}
+
+	if sess == nil || !sess.lock() {
+		n.Say(req.channel, messageNoSession)
+		return nil
+	}
+
+	defer sess.mu.Unlock()
+	if status := n.showStatus(req.channel, sess); status == "" {
+		n.Say(req.channel, messageNoStatus, sess.story.Name)
+	} else {
+		n.bot.Say(req.channel, status)
+	}
+	return nil
+}
+
+func (n *Inform) cmdStorySaves(req *request) error {
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if saves, err := listSaves(n.bot.Store, req.author.ID, saveStoryName(story, req.author.ID)); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		return n.SayTemplate(req.channel, templateSaveList, saveList{Story: story.Name, Saves: saves})
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryTranscripts(req *request) error {
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if list, err := listTranscripts(n.bot.Store, req.author.ID, saveStoryName(story, req.author.ID)); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		return n.SayTemplate(req.channel, templateTranscriptList, transcriptList{Story: saveStoryName(story, req.author.ID), Transcripts: list})
+	}
+	return nil
+}
+
+func (n *Inform) cmdStoryTranscript(req *request) error {
+	var args []string
+	for _, a := range []string{req.arg("number"), req.arg("format")} {
+		if a != "" {
+			args = append(args, a)
+		}
+	}
+
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else {
+		return n.ShowTranscript(req.channel, req.author, story, args)
+	}
+	return nil
+}
+
+func (n *Inform) cmdChannelStatus(req *request) error {
+	if sess := n.session(sessionKey("", req.channel)); sess == nil || !sess.lock() {
+		n.Say(req.channel, messageNoChannelSession)
+	} else {
+		defer sess.mu.Unlock()
+		n.Say(req.channel, messageChannelSession, sess.story.Name, sess.owner)
+	}
+	return nil
+}
+
+func (n *Inform) cmdChannelStart(req *request) error {
+	if story, err := n.FindStory(req.author, req.arg("story")); err != nil {
+		n.Say(req.channel, messageInvalidStory, err)
+	} else if sess := n.session(sessionKey("", req.channel)); sess != nil && sess.lock() {
+		defer sess.mu.Unlock()
+		n.Say(req.channel, messageChannelSession, sess.story.Name, sess.owner)
+	} else {
+		return n.StartSession(req.channel, req.author, story, req.channel)
+	}
+	return nil
+}
+
+func (n *Inform) cmdChannelEnd(req *request) error {
+	var sess = n.session(sessionKey("", req.channel))
+	if sess == nil || !sess.lock() {
+		n.Say(req.channel, messageNoChannelSession)
+		return nil
+	}
+
+	defer sess.mu.Unlock()
+	if sess.owner != req.author.ID {
+		n.Say(req.channel, messageNotChannelOwner, sess.owner)
+	} else if err := n.EndSession(sess); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.Say(req.channel, messageEndedChannelSession, sess.story.Name)
+	}
+	return nil
+}
+
+func (n *Inform) cmdChannelControl(req *request) error {
+	var sess = n.session(sessionKey("", req.channel))
+	if sess == nil || !sess.lock() {
+		n.Say(req.channel, messageNoChannelSession)
+		return nil
+	}
+
+	defer sess.mu.Unlock()
+	if sess.owner != req.author.ID {
+		n.Say(req.channel, messageNotChannelOwner, sess.owner)
+	} else if err := validateAuthorID(req.arg("author")); err != nil {
+		n.Say(req.channel, messageInvalidChannelOwner, err)
+	} else if _, err := n.loadAuthor(req.arg("author")); err != nil {
+		n.Say(req.channel, messageInvalidChannelOwner, err)
+	} else {
+		// Owners are changed with both locks held, as these are read holding either.
+		n.mu.Lock()
+		sess.owner = req.arg("author")
+		n.mu.Unlock()
+
+		n.Say(req.channel, messageChannelOwner, sess.owner)
+		return n.Checkpoint(sess)
+	}
+	return nil
+}
+
+func (n *Inform) cmdExtensionList(req *request) error {
+	shared, err := n.sharedExtensions()
+	if err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	}
+
+	return n.SayTemplate(req.channel, templateExtensionList, extensionList{Shared: shared, Own: req.author.Extensions})
+}
+
+func (n *Inform) cmdExtensionAdd(req *request) error {
+	// Extensions are shared with all authors if requested, and are otherwise added for the author
+	// alone. As with stories, extensions are either fetched from the URL given, taken from files
+	// attached to the command itself, or expected in a follow-up message.
+	var u = &upload{extension: true, shared: req.arg("shared") != ""}
+	if u.shared && !n.isAdmin(req.author.ID) {
+		n.Say(req.channel, messageNotAdmin)
+	} else if url := req.arg("url"); url != "" {
+		return n.FetchUpload(req.ctx, req.channel, req.author, u, attachment.Attachment{URL: url})
+	} else if files := attachment.From(req.event); len(files) > 0 {
+		return n.FetchUpload(req.ctx, req.channel, req.author, u, files[0])
+	} else {
+		n.expectUpload(req.author.ID, u, time.Now())
+		n.Say(req.channel, messageExpectingExtension, n.config.UploadTimeout)
+	}
+	return nil
+}
+
+func (n *Inform) cmdExtensionRemove(req *request) error {
+	// Extension names may be quoted, as they contain spaces.
+	var name = strings.Trim(strings.TrimSpace(req.arg("name")), `"'`)
+	return n.RemoveExtension(req.channel, req.author, name, req.arg("shared") != "")
+}
+
+func (n *Inform) cmdOptionList(req *request) error {
+	return n.SayTemplate(req.channel, templateOptionList, n.optionList(req.channel, req.author))
+}
+
+func (n *Inform) cmdOptionSet(req *request) error {
+	// Languages are checked against those supported, which the author cannot know of otherwise.
+	var name, value = req.arg("name"), req.arg("value")
+	if strings.EqualFold(name, "language") && !n.catalog.supports(strings.ToLower(value)) {
+		n.Say(req.channel, messageInvalidOption, errors.Errorf("language '%s' is not supported, try one of '%s'", value, strings.Join(n.catalog.list(), "', '")))
+	} else if err := req.author.SetOption(name, value); err != nil {
+		n.Say(req.channel, messageInvalidOption, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		opt, _ := findOption(name)
+		n.setAuthorOptions(req.channel, req.author.ID, req.author.Options)
+		n.Say(req.channel, messageSetOption, opt.name, opt.get(&req.author.Options))
+	}
+	return nil
+}
+
+func (n *Inform) cmdOptionReset(req *request) error {
+	var name = req.arg("name")
+	if err := req.author.ResetOption(name); err != nil {
+		n.Say(req.channel, messageInvalidOption, err)
+	} else if err = n.storeAuthor(req.author); err != nil {
+		n.Say(req.channel, messageUnknownError)
+		return err
+	} else {
+		n.setAuthorOptions(req.channel, req.author.ID, req.author.Options)
+		if opt, _ := findOption(name); opt != nil {
+			n.Say(req.channel, messageResetOption, opt.name, opt.get(&req.author.Options))
+		} else {
+			n.Say(req.channel, messageResetOptions)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/sandbox"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// ErrStoryTooLarge is returned by compilers when the story given exceeds the limits of the format
+// targeted, and may succeed if compiled for a different format.
+var ErrStoryTooLarge = errors.New("story too large for format")
+
+// A Compiler builds story source into runnable story files.
+type Compiler interface {
+	// Compile builds the given source for the format given, using the sandbox policy given for any
+	// external processes, and returns the compiled story file. Any extensions given are made
+	// available for inclusion by the story. A CompileLog is returned whenever compilation was
+	// attempted, regardless of whether or not it succeeded.
+	Compile(ctx context.Context, policy sandbox.Policy, source []byte, extensions []*Extension, format string) ([]byte, *CompileLog, error)
+}
+
+// A VersionedCompiler is a Compiler able to identify the version it compiles stories with, so that
+// stories compiled by different versions are not mixed up, e.g. in cached builds.
+type VersionedCompiler interface {
+	Compiler
+
+	// Version returns text identifying the compiler and its version, which is expected to change
+	// whenever the compiler is upgraded.
+	Version() string
+}
+
+// Default path for Inform 7 data.
+const defaultInform7DataDir = "/usr/share/inform7/Internal"
+
+// Default arguments for Inform 6 and 7 compilers.
+var (
+	defaultInform7Args = []string{"--noprogress"}
+	defaultInform6Args = []string{"-E2wSDF0Cud2"}
+)
+
+// Format-specific arguments for Inform 6 and 7 compilers.
+var inform7FormatArgs = map[string]struct{ inform7, inform6 string }{
+	FormatZ5:    {inform7: "--format=z5", inform6: "-v5"},
+	FormatZ8:    {inform7: "--format=z8", inform6: "-v8"},
+	FormatGlulx: {inform7: "--format=ulx", inform6: "-G"},
+}
+
+// Matches errors in Inform 6 output indicating that the story is too large for the Z-machine.
+var zmachineLimitPattern = regexp.MustCompile(`(?i)exceeds (the )?version.?\d+ limit|too large for the z-machine|maximum readable-memory size`)
+
+// Inform7Compiler compiles stories with the Inform 7 'ni' compiler, which produces Inform 6 code,
+// which is in turn compiled with the 'inform6' compiler.
+type Inform7Compiler struct {
+	Inform7 string // The path to the 'ni' Inform 7 compiler.
+	Inform6 string // The path to the 'inform6' Inform 6 compiler.
+	DataDir string // The path to internal data used by the Inform 7 compiler.
+
+	// Additional arguments given to each compiler.
+	Inform7Args []string
+	Inform6Args []string
+}
+
+// Compile builds the source given in a temporary Inform 7 project directory, with any extensions given
+// placed in the external extensions directory used by the compiler.
+func (c *Inform7Compiler) Compile(ctx context.Context, policy sandbox.Policy, source []byte, extensions []*Extension, format string) ([]byte, *CompileLog, error) {
+	f, ok := inform7FormatArgs[format]
+	if !ok {
+		return nil, nil, errors.New("story format '" + format + "' is unknown")
+	}
+
+	dir, err := ioutil.TempDir(os.TempDir(), keyPrefix+"-compile-*")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating temporary directory failed")
+	}
+
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(path.Join(dir, "Source"), 0755); err != nil {
+		return nil, nil, errors.Wrap(err, "creating temporary directory failed")
+	} else if err := ioutil.WriteFile(path.Join(dir, "Source", "story.ni"), source, 0644); err != nil {
+		return nil, nil, errors.Wrap(err, "writing file for story failed")
+	}
+
+	var external = path.Join(dir, "External")
+	if err := os.MkdirAll(path.Join(external, "Extensions"), 0755); err != nil {
+		return nil, nil, errors.Wrap(err, "creating temporary directory failed")
+	}
+
+	for _, e := range extensions {
+		var extDir = path.Join(external, "Extensions", e.Author)
+		if err := os.MkdirAll(extDir, 0755); err != nil {
+			return nil, nil, errors.Wrap(err, "creating temporary directory failed")
+		} else if err := ioutil.WriteFile(path.Join(extDir, e.Title+".i7x"), e.Source, 0644); err != nil {
+			return nil, nil, errors.Wrap(err, "writing file for extension failed")
+		}
+	}
+
+	var out bytes.Buffer
+	var log = &CompileLog{CreatedAt: time.Now().UTC()}
+
+	var args = append(append([]string{}, c.Inform7Args...), "--internal", c.DataDir, "--external", external, f.inform7, "--project", dir)
+	cmd, err := policy.Command(ctx, dir, c.Inform7, args...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "preparing compiler failed")
+	}
+
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err = cmd.Run(); err != nil {
+		log.Output = out.String()
+		if report, err := ioutil.ReadFile(path.Join(dir, "Build", "Problems.html")); err == nil {
+			log.Problems = parseProblemsReport(report, source)
+		}
+		if len(log.Problems) == 0 {
+			log.Problems = parseProblemsOutput(out.Bytes(), source)
+		}
+		return nil, log, errors.Wrap(err, "compilation failed")
+	}
+
+	var output = path.Join(dir, "Build", "output."+storyFormats[format].extension)
+	args = append(append([]string{}, c.Inform6Args...), f.inform6, path.Join(dir, "Build", "auto.inf"), output)
+	if cmd, err = policy.Command(ctx, dir, c.Inform6, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "preparing compiler failed")
+	}
+
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err = cmd.Run(); err != nil {
+		log.Output, log.Problems = out.String(), parseProblemsOutput(out.Bytes(), source)
+		if zmachineLimitPattern.Match(out.Bytes()) && format != FormatGlulx {
+			err = ErrStoryTooLarge
+		}
+		return nil, log, errors.Wrap(err, "compilation failed")
+	}
+
+	buf, err := ioutil.ReadFile(output)
+	if err != nil {
+		log.Output = out.String()
+		return nil, log, errors.Wrap(err, "compilation failed")
+	}
+
+	log.Output, log.Success = out.String(), true
+	return buf, log, nil
+}
+
+// Version returns the paths and arguments for the Inform 7 and Inform 6 compilers, along with the
+// size and modification time for each executable, which change whenever either is upgraded.
+func (c *Inform7Compiler) Version() string {
+	var version []string
+	for _, name := range []string{c.Inform7, c.Inform6, c.DataDir} {
+		if info, err := os.Stat(name); err != nil {
+			version = append(version, name)
+		} else {
+			version = append(version, name+":"+strconv.FormatInt(info.Size(), 10)+":"+info.ModTime().UTC().Format(time.RFC3339Nano))
+		}
+	}
+
+	version = append(version, strings.Join(c.Inform7Args, " "), strings.Join(c.Inform6Args, " "))
+	return strings.Join(version, "\n")
+}
+
+// NewInform7Compiler returns a Compiler using the Inform 7 and Inform 6 compilers at the paths
+// given, with default arguments and data directory.
+func NewInform7Compiler(inform7, inform6 string) *Inform7Compiler {
+	return &Inform7Compiler{
+		Inform7:     inform7,
+		Inform6:     inform6,
+		DataDir:     defaultInform7DataDir,
+		Inform7Args: defaultInform7Args,
+		Inform6Args: defaultInform6Args,
+	}
+}
@@ -0,0 +1,133 @@
+package inform
+
+import (
+	// Standard library
+	"strconv"
+)
+
+// Limits for computing and showing differences between story sources.
+const (
+	maxDiffCells = 1 << 22 // The maximum size of the table used in matching lines.
+	maxDiffLines = 100     // The maximum number of lines shown for a difference.
+	diffContext  = 2       // The number of unchanged lines shown around changed lines.
+)
+
+// Markers used in showing differences between story sources.
+const (
+	diffUnchanged  = ' '
+	diffRemoved    = '-'
+	diffAdded      = '+'
+	diffSeparation = "..."
+)
+
+// DiffLine represents a single line in the difference between two story sources.
+type diffLine struct {
+	kind byte   // The kind of change, one of diffUnchanged, diffRemoved, or diffAdded.
+	line int    // The line number, in the old source for removed lines, and the new source otherwise.
+	text string // The line text.
+}
+
+// DiffLines returns the difference between the lists of lines given, as the list of lines removed
+// from the first list, added in the second list, and unchanged between the two. Differences between
+// very large sources may not be minimal.
+func diffLines(a, b []string) []diffLine {
+	var result []diffLine
+
+	// Lines common to the start and end of both sources are always unchanged.
+	var prefix, suffix = 0, 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		result = append(result, diffLine{kind: diffUnchanged, line: prefix + 1, text: a[prefix]})
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var am, bm = a[prefix : len(a)-suffix], b[prefix : len(b)-suffix]
+	var i, j = 0, 0
+
+	// Find the longest common subsequence for the remaining lines, where the table required is not too
+	// large; otherwise, all remaining lines are taken as changed.
+	if len(am) > 0 && len(bm) > 0 && len(am)*len(bm) <= maxDiffCells {
+		var width = len(bm) + 1
+		var table = make([]int32, (len(am)+1)*width)
+		for x := len(am) - 1; x >= 0; x-- {
+			for y := len(bm) - 1; y >= 0; y-- {
+				if am[x] == bm[y] {
+					table[x*width+y] = table[(x+1)*width+y+1] + 1
+				} else if table[(x+1)*width+y] >= table[x*width+y+1] {
+					table[x*width+y] = table[(x+1)*width+y]
+				} else {
+					table[x*width+y] = table[x*width+y+1]
+				}
+			}
+		}
+
+		for i < len(am) && j < len(bm) {
+			if am[i] == bm[j] {
+				result = append(result, diffLine{kind: diffUnchanged, line: prefix + j + 1, text: bm[j]})
+				i, j = i+1, j+1
+			} else if table[(i+1)*width+j] >= table[i*width+j+1] {
+				result = append(result, diffLine{kind: diffRemoved, line: prefix + i + 1, text: am[i]})
+				i++
+			} else {
+				result = append(result, diffLine{kind: diffAdded, line: prefix + j + 1, text: bm[j]})
+				j++
+			}
+		}
+	}
+
+	for ; i < len(am); i++ {
+		result = append(result, diffLine{kind: diffRemoved, line: prefix + i + 1, text: am[i]})
+	}
+	for ; j < len(bm); j++ {
+		result = append(result, diffLine{kind: diffAdded, line: prefix + j + 1, text: bm[j]})
+	}
+	for k := len(b) - suffix; k < len(b); k++ {
+		result = append(result, diffLine{kind: diffUnchanged, line: k + 1, text: b[k]})
+	}
+
+	return result
+}
+
+// FormatDiff returns the changed lines in the difference given, along with any unchanged lines close
+// to them, as formatted for display. Unchanged lines not shown are replaced with a separator. The
+// number of lines shown is limited, and the number of changed lines not shown is also returned.
+func formatDiff(diff []diffLine) ([]string, int) {
+	var show = make([]bool, len(diff))
+	for i, d := range diff {
+		if d.kind == diffUnchanged {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(diff) {
+				show[j] = true
+			}
+		}
+	}
+
+	var result []string
+	var hidden = 0
+	for i, d := range diff {
+		if !show[i] {
+			if len(result) > 0 && len(result) < maxDiffLines && i > 0 && show[i-1] {
+				result = append(result, diffSeparation)
+			}
+			continue
+		} else if len(result) >= maxDiffLines {
+			if d.kind != diffUnchanged {
+				hidden++
+			}
+			continue
+		}
+
+		result = append(result, string(d.kind)+" "+strconv.Itoa(d.line)+": "+d.text)
+	}
+
+	// Remove any trailing separator, as no further lines are shown.
+	if len(result) > 0 && result[len(result)-1] == diffSeparation {
+		result = result[:len(result)-1]
+	}
+
+	return result, hidden
+}
@@ -0,0 +1,231 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// The key used for storing extensions shared between all authors.
+const sharedExtensionsKey = keyPrefix + ".extensions"
+
+// Matches the opening line for Inform 7 extensions, e.g. 'Version 2 of Basic Screen Effects by
+// Emily Short begins here.', with any parenthesized notes following the author name ignored.
+var extensionHeaderPattern = regexp.MustCompile(`(?i)^\s*(?:Version \S+ of\s+)?(?:the\s+)?(.+?)\s+by\s+(.+?)\s*(?:\(.*\)\s*)?begins here\.`)
+
+// Valid extension titles and author names cannot contain path separators, and cannot start with a
+// dot, as they are used for file names when compiling.
+var extensionNamePattern = regexp.MustCompile(`^[^./\\\x00][^/\\\x00]*$`)
+
+// Extension represents an Inform 7 extension, as made available to stories when compiling, either
+// for all authors or for a single author.
+type Extension struct {
+	Title     string    // The extension title, as used in 'Include <Title> by <Author>'.
+	Author    string    // The extension author, as used in 'Include <Title> by <Author>'.
+	CreatedAt time.Time // The UTC timestamp the extension was added on.
+
+	// Reference to the extension source, as kept in the blob store.
+	SourceRef string `json:",omitempty"`
+
+	// Extension source, as loaded from the blob store when stories are compiled.
+	Source []byte `json:"-"`
+
+	// Extension source for extensions stored before the blob store was used, which is moved into the
+	// blob store the next time the extension is stored.
+	LegacySource []byte `json:"Source,omitempty"`
+}
+
+// Name returns the full name for the extension, as used in 'Include' statements.
+func (e *Extension) Name() string {
+	return e.Title + " by " + e.Author
+}
+
+// Matches returns whether or not the extension has the full name given, ignoring case, as is the
+// case for 'Include' statements.
+func (e *Extension) Matches(name string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(name), " "), e.Name())
+}
+
+// NewExtension returns an Extension for the source given, with its title and author taken from the
+// opening line of the source.
+func NewExtension(source []byte) (*Extension, error) {
+	var line = source
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	m := extensionHeaderPattern.FindSubmatch(bytes.TrimPrefix(line, []byte("\xef\xbb\xbf")))
+	if m == nil {
+		return nil, errors.New("extension needs to start with a line like 'Some Title by Some Author begins here.'")
+	}
+
+	var title, author = string(m[1]), string(m[2])
+	if !extensionNamePattern.MatchString(title) || !extensionNamePattern.MatchString(author) {
+		return nil, errors.New("extension title or author name contains invalid characters")
+	}
+
+	return &Extension{Title: title, Author: author, CreatedAt: time.Now().UTC(), Source: source}, nil
+}
+
+// AddExtension adds the extension given to the list given, replacing any extension with the same
+// name, and returns the updated list.
+func addExtension(list []*Extension, ext *Extension) []*Extension {
+	for i := range list {
+		if list[i].Matches(ext.Name()) {
+			list[i] = ext
+			return list
+		}
+	}
+
+	list = append(list, ext)
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name()) < strings.ToLower(list[j].Name()) })
+
+	return list
+}
+
+// RemoveExtension removes the extension with the full name given from the list given, and returns
+// the updated list, along with the extension removed.
+func removeExtension(list []*Extension, name string) ([]*Extension, *Extension, error) {
+	for i, e := range list {
+		if e.Matches(name) {
+			return append(list[:i], list[i+1:]...), e, nil
+		}
+	}
+
+	return nil, nil, errors.New("no extension found with name '" + name + "'")
+}
+
+// MergeExtensions returns the extensions in both lists given, where extensions in the second list
+// take precedence over extensions of the same name in the first list.
+func mergeExtensions(shared, own []*Extension) []*Extension {
+	var result []*Extension
+	for _, e := range shared {
+		result = addExtension(result, e)
+	}
+	for _, e := range own {
+		result = addExtension(result, e)
+	}
+
+	return result
+}
+
+// SharedExtensions returns the list of extensions available to all authors.
+func (n *Inform) sharedExtensions() ([]*Extension, error) {
+	var list []*Extension
+	if _, err := n.bot.Store.Get(sharedExtensionsKey, &list); err != nil {
+		return nil, errors.Wrap(err, "loading shared extensions failed")
+	}
+
+	return list, nil
+}
+
+// StoreSharedExtensions stores the list of extensions available to all authors, moving extension
+// sources into the blob store beforehand.
+func (n *Inform) storeSharedExtensions(list []*Extension) error {
+	if err := storeExtensions(n.config.Blobs, list); err != nil {
+		return err
+	}
+
+	return n.bot.Store.Set(sharedExtensionsKey, list)
+}
+
+// IsAdmin returns whether or not the author given is allowed to manage shared extensions.
+func (n *Inform) isAdmin(authorID string) bool {
+	for _, id := range n.config.Admins {
+		if id == authorID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExtensionList represents the data passed to the extension list template.
+type extensionList struct {
+	Shared []*Extension
+	Own    []*Extension
+}
+
+// AddExtension adds the extension with the source given, either for the author given, or for all
+// authors, if shared is set. Only administrators can add shared extensions.
+func (n *Inform) AddExtension(channel string, author *Author, source []byte, shared bool) error {
+	if shared && !n.isAdmin(author.ID) {
+		n.Say(channel, messageNotAdmin)
+		return nil
+	} else if int64(len(source)) > n.config.MaxSourceSize {
+		n.Say(channel, messageInvalidExtension, errors.Errorf("extension is larger than %d bytes", n.config.MaxSourceSize))
+		return nil
+	}
+
+	ext, err := NewExtension(source)
+	if err != nil {
+		n.Say(channel, messageInvalidExtension, err)
+		return nil
+	}
+
+	if shared {
+		list, err := n.sharedExtensions()
+		if err != nil {
+			n.Say(channel, messageUnknownError)
+			return err
+		} else if err = n.storeSharedExtensions(addExtension(list, ext)); err != nil {
+			n.Say(channel, messageUnknownError)
+			return err
+		}
+	} else {
+		author.Extensions = addExtension(author.Extensions, ext)
+		if err := n.storeAuthor(author); err != nil {
+			n.Say(channel, messageUnknownError)
+			return err
+		}
+	}
+
+	n.Say(channel, messageAddedExtension, ext.Name())
+	return nil
+}
+
+// RemoveExtension removes the extension with the full name given, either for the author given, or
+// for all authors, if shared is set. Only administrators can remove shared extensions.
+func (n *Inform) RemoveExtension(channel string, author *Author, name string, shared bool) error {
+	var list []*Extension
+	var err error
+
+	if shared && !n.isAdmin(author.ID) {
+		n.Say(channel, messageNotAdmin)
+		return nil
+	} else if !shared {
+		list = author.Extensions
+	} else if list, err = n.sharedExtensions(); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	list, ext, err := removeExtension(list, name)
+	if err != nil {
+		n.Say(channel, messageInvalidExtension, err)
+		return nil
+	}
+
+	if shared {
+		err = n.storeSharedExtensions(list)
+	} else {
+		author.Extensions = list
+		err = n.storeAuthor(author)
+	}
+
+	if err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	n.Say(channel, messageRemovedExtension, ext.Name())
+	go n.collectGarbage()
+
+	return nil
+}
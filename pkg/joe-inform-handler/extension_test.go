@@ -0,0 +1,39 @@
+package inform
+
+import (
+	// Standard library
+	"encoding/json"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+)
+
+func TestStoreExtensions(t *testing.T) {
+	blobs, err := blob.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+
+	// Extensions stored before the blob store was used have their sources moved into the blob store.
+	var list []*Extension
+	if err := json.Unmarshal([]byte(`[{"Title":"Kitchens","Author":"Someone","Source":"YQ=="}]`), &list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	} else if err = storeExtensions(blobs, list); err != nil {
+		t.Fatalf("storeExtensions() error = %v", err)
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	} else if want := `[{"Title":"Kitchens","Author":"Someone","CreatedAt":"0001-01-01T00:00:00Z","SourceRef":"` + blob.Key([]byte("a")) + `"}]`; string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+
+	var loaded []*Extension
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	} else if err = loadExtensions(blobs, loaded); err != nil || string(loaded[0].Source) != "a" {
+		t.Errorf("loadExtensions() = %q, %v, want source loaded", loaded[0].Source, err)
+	}
+}
@@ -4,163 +4,501 @@ import (
 	// Standard library
 	"bytes"
 	"context"
+	"net/url"
 	"os/exec"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+	"go.deuill.org/informbot/pkg/joe-attachment"
+	"go.deuill.org/informbot/pkg/sandbox"
 
 	// Third-party packages
 	"github.com/go-joe/joe"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 // The prefix used for all keys stored.
 const keyPrefix = "org.deuill.informbot"
 
+// KeyPart returns the text given as escaped for use as part of a stored key, where parts are joined
+// by '.' separators. Author IDs and story names may themselves contain dots, which are escaped along
+// with any other characters not safe for use in paths, so that keys for different parts never match.
+func keyPart(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), ".", "%2E")
+}
+
 type Inform struct {
-	sessions map[string]*Session // A list of open sessions, against their authors.
+	sessions map[string]*Session // A list of open sessions, against their authors or channels.
+	uploads  map[string]*upload  // A list of stories awaiting source files, against their authors.
+	compiles *compileQueue       // Stories waiting to be compiled, or being compiled.
+	catalog  *catalog            // Translations for messages and templates.
+
+	// The options responses are formatted with, against the channels requests are being handled for,
+	// as set for the author of each request.
+	options map[string]Options
 
-	bot    *joe.Bot // The initialized bot to read commands from and send responses to.
-	config *Config  // The configuration for the Inform bot.
+	bot    *joe.Bot   // The initialized bot to read commands from and send responses to.
+	config *Config    // The configuration for the Inform bot.
+	mu     sync.Mutex // The lock protecting concurrent access to sessions, uploads, and options.
+
+	// The lock held while authors and blobs are changed, so that changes made concurrently are not
+	// lost, and blobs are not removed as unreferenced before being referred to. Where several locks
+	// are needed, this is acquired before locks for single sessions, which are acquired before mu.
+	dataMu sync.Mutex
+
+	// The context sessions are run under, which is cancelled on shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
+// Say sends the message given to the channel given, in the language set for the channel, and
+// formatted with any arguments given.
+func (n *Inform) Say(channel string, msg *message, args ...interface{}) {
+	n.sayWith(n.channelOptions(channel), channel, msg, args...)
+}
+
+// SayWith sends the message given to the channel given, in the language set in the options given,
+// for messages sent outside of requests and sessions, e.g. while compiling stories.
+func (n *Inform) sayWith(opts Options, channel string, msg *message, args ...interface{}) {
+	n.bot.Say(channel, n.catalog.message(opts.language(), msg, args...))
+}
+
+// SayTemplate sends the template given to the channel given, in the language and time zone set for
+// the channel, and executed with the data given.
 func (n *Inform) SayTemplate(channel string, template *template.Template, data interface{}) error {
-	var buf bytes.Buffer
-	if err := template.Execute(&buf, data); err != nil || buf.Len() == 0 {
-		n.bot.Say(channel, messageUnknownError)
+	return n.sayTemplateWith(n.channelOptions(channel), channel, template, data)
+}
+
+// SayTemplateWith sends the template given to the channel given, in the language and time zone set
+// in the options given, and executed with the data given.
+func (n *Inform) sayTemplateWith(opts Options, channel string, template *template.Template, data interface{}) error {
+	out, err := n.executeTemplateWith(opts, template, data)
+	if err != nil || out == "" {
+		n.sayWith(opts, channel, messageUnknownError)
 		return err
 	}
 
-	n.bot.Say(channel, buf.String())
+	n.bot.Say(channel, out)
 	return nil
 }
 
+// ExecuteTemplate returns the template given as executed with the data given, in the language and
+// time zone set for the channel given.
+func (n *Inform) executeTemplate(channel string, template *template.Template, data interface{}) (string, error) {
+	return n.executeTemplateWith(n.channelOptions(channel), template, data)
+}
+
+// ExecuteTemplateWith returns the template given as executed with the data given, in the language
+// and time zone set in the options given.
+func (n *Inform) executeTemplateWith(opts Options, template *template.Template, data interface{}) (string, error) {
+	t, err := n.catalog.template(opts.language(), template).Clone()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	t.Funcs(templateFuncs(opts.Location()))
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// Welcome sends the welcome message to the channel given, unless it has been sent there before, so
+// that group-chats are welcomed once, rather than once for every participant.
+func (n *Inform) welcome(channel string) error {
+	var key, sentAt = keyPrefix + ".welcome." + channel, time.Time{}
+	if ok, err := n.bot.Store.Get(key, &sentAt); err != nil || ok {
+		return err
+	} else if err := n.SayTemplate(channel, templateWelcome, nil); err != nil {
+		return err
+	}
+
+	return n.bot.Store.Set(key, time.Now().UTC())
+}
+
 func (n *Inform) Handle(ctx context.Context, ev joe.ReceiveMessageEvent) error {
-	// Validate event data.
-	if ev.AuthorID == "" {
-		n.bot.Say(ev.Channel, messageUnknownError)
+	// Validate event data. Messages with no author ID are only handled for participants known by
+	// name in the channel, e.g. occupants of anonymous group-chats, who take part as guests.
+	var nick = participantNick(ev)
+	if ev.AuthorID == "" && nick == "" {
+		n.Say(ev.Channel, messageUnknownError)
 		return nil
 	}
 
-	// Check for stored rule-set against author ID, and send welcome message if none was found.
-	var author, authorKey = &Author{}, keyPrefix + ".author." + ev.AuthorID
-	if ok, err := n.bot.Store.Get(authorKey, author); err != nil {
-		n.bot.Say(ev.Channel, messageUnknownError)
-		return err
-	} else if !ok {
-		if err := n.SayTemplate(ev.Channel, templateWelcome, nil); err != nil {
-			return errors.Wrap(err, "failed storing author information")
-		}
+	// Authors are loaded and changed with the data lock held, which is released before commands are
+	// run against sessions, as these change no authors, and can take a while to complete.
+	n.dataMu.Lock()
+	var unlock = sync.OnceFunc(n.dataMu.Unlock)
+	defer unlock()
 
-		// Create and store new Author representation.
-		author = NewAuthor(ev.AuthorID)
-		if err := n.bot.Store.Set(authorKey, author); err != nil {
-			n.bot.Say(ev.Channel, messageUnknownError)
+	// Check for stored rule-set against author ID, and send welcome message if none was found. Guests
+	// have no stored rule-set, and use the options for the session owner in the channel, if any.
+	var author = &Author{Options: n.channelOptions(ev.Channel)}
+	if ev.AuthorID != "" {
+		var authorKey = keyPrefix + ".author." + ev.AuthorID
+		if ok, err := n.bot.Store.Get(authorKey, author); err != nil {
+			n.Say(ev.Channel, messageUnknownError)
 			return err
+		} else if !ok {
+			if err := n.welcome(ev.Channel); err != nil {
+				return errors.Wrap(err, "failed storing author information")
+			}
+
+			// Create and store new Author representation.
+			author = NewAuthor(ev.AuthorID)
+			if err := n.storeAuthor(author); err != nil {
+				n.Say(ev.Channel, messageUnknownError)
+				return err
+			}
 		}
 	}
 
-	// Check for open session, and handle command directly if not prefixed.
+	// Responses are formatted with the options set for the author of the request, for as long as the
+	// request is being handled.
+	n.mu.Lock()
+	n.options[ev.Channel] = author.Options
+	n.mu.Unlock()
+
+	defer func() {
+		n.mu.Lock()
+		delete(n.options, ev.Channel)
+		n.mu.Unlock()
+	}()
+
+	author.blobs = n.config.Blobs
+
+	// Complete any story upload expected from the author.
+	var files = attachment.From(ev)
+	if len(files) > 0 {
+		if u := n.takeUpload(author.ID, time.Now()); u != nil {
+			return n.FetchUpload(ctx, ev.Channel, author, u, files[0])
+		}
+	}
+
+	// Check for open session, either shared in the channel or owned by the author, and handle
+	// command directly if not prefixed.
 	var cmd = ev.Text
-	if n.sessions[author.ID] != nil {
+	var sess = n.session(sessionKey("", ev.Channel))
+	if sess == nil && author.ID != "" {
+		sess = n.session(sessionKey(author.ID, ""))
+	}
+
+	// Skip files sent out of context, which would otherwise be taken as commands. Links sent while
+	// playing a story, e.g. with link previews attached, are passed to the story as-is.
+	if len(files) > 0 && (ev.Text == "" || (sess == nil && ev.Text == files[0].URL)) {
+		n.Say(ev.Channel, messageUnexpectedUpload)
+		return nil
+	}
+
+	if sess != nil && sess.lock() {
+		n.touch(sess, ev.Channel, time.Now())
+		if sess.restored {
+			n.Say(ev.Channel, messageResumedSession, sess.story.Name)
+			sess.restored = false
+		}
 		if !strings.HasPrefix(ev.Text, author.Options.Prefix) {
-			if err := n.sessions[author.ID].Run(cmd); err != nil {
-				n.bot.Say(ev.Channel, messageRunError, err)
-				return err
-			}
-			n.bot.Say(ev.Channel, n.sessions[author.ID].Output())
-			return nil
-		} else {
-			cmd = ev.Text[len(author.Options.Prefix):]
+			unlock()
+			defer sess.mu.Unlock()
+			return n.RunSession(ev.Channel, sess, cmd)
 		}
+
+		sess.mu.Unlock()
+		cmd = ev.Text[len(author.Options.Prefix):]
 	}
 
-	// Handle meta-commands.
-	var fields = strings.Fields(cmd)
-	if len(fields) == 0 {
+	// Handle meta-commands, as declared in the command registry.
+	var req = &request{ctx: ctx, event: ev, channel: ev.Channel, author: author, nick: nick}
+	return commands.dispatch(n, req, cmd)
+}
+
+// AddStory adds and compiles a story with the source given for the author given, replacing the
+// source for any existing story of the same name.
+func (n *Inform) AddStory(channel string, author *Author, name string, source []byte) error {
+	if int64(len(source)) > n.config.MaxSourceSize {
+		n.Say(channel, messageInvalidStory, errors.Errorf("story source is larger than %d bytes", n.config.MaxSourceSize))
 		return nil
+	}
+
+	story, err := author.AddStory(name, source)
+	if err != nil {
+		n.Say(channel, messageInvalidStory, err)
+		return nil
+	}
+
+	return n.CompileStory(channel, author, story, n.message(channel, messageAddedStory, story.Name))
+}
+
+// CompileStory stores the story given against the author, and queues the story for compilation. The
+// outcome of compilation is reported to the channel given, either as the message given, if
+// compilation succeeds, or as a list of problems found. Any compilation already queued or running
+// for the same story is cancelled, as it would be superseded.
+func (n *Inform) CompileStory(channel string, author *Author, story *Story, done string) error {
+	shared, err := n.sharedExtensions()
+	if err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	// Extensions added by the author take precedence over shared extensions with the same name.
+	var extensions = mergeExtensions(shared, author.Extensions)
+	if err := loadExtensions(n.config.Blobs, extensions); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	var pruned = story.pruneRevisions(n.config.RevisionLimit, n.config.RevisionMaxAge, time.Now())
+	if err := n.storeAuthor(author); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	} else if pruned {
+		go n.collectGarbage()
+	}
+
+	var job = compileJob{
+		story: &Story{
+			Name:     story.Name,
+			AuthorID: story.AuthorID,
+			Format:   story.Format,
+			Source:   story.Source,
+		},
+		extensions: extensions,
+		channel:    channel,
+		done:       done,
+		options:    author.Options,
+	}
+
+	var q = n.compiles
+	var ref = story.Ref()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Jobs still waiting for the same story are updated in place, and running jobs are cancelled.
+	if prev := q.active[ref]; prev != nil && !prev.running {
+		prev.story, prev.extensions, prev.channel, prev.done, prev.options = job.story, job.extensions, job.channel, job.done, job.options
+		n.Say(channel, messageCompileQueued, story.Name)
+		return nil
+	} else if prev != nil {
+		prev.cancel()
+		delete(q.active, ref)
+	}
+
+	job.ctx, job.cancel = context.WithCancel(n.ctx)
+	select {
+	case q.jobs <- &job:
+		q.active[ref] = &job
+	default:
+		job.cancel()
+		n.Say(channel, messageCompileQueueFull, story.Name)
+		return nil
+	}
+
+	// Stories are always reported as queued, along with the number of stories waiting ahead of them,
+	// and completion is reported separately once compiled.
+	if ahead := len(q.jobs) - 1; ahead > 0 {
+		n.Say(channel, messageCompileQueuedBehind, story.Name, ahead)
+	} else {
+		n.Say(channel, messageCompileQueued, story.Name)
+	}
+
+	return nil
+}
+
+// StartSession starts a new session for the given story, and sends any initial output to the
+// channel given. Sessions are owned by the author given, and are optionally shared in a channel, in
+// which case any participant in the channel can send commands to the story.
+func (n *Inform) StartSession(channel string, author *Author, story *Story, shared string) error {
+	if len(story.Build) == 0 {
+		n.Say(channel, messageInvalidSession, "the story has not been compiled successfully")
+		return nil
+	}
+
+	sess, err := NewSession(story)
+	if err != nil {
+		n.Say(channel, messageInvalidSession, err)
+		return err
+	} else if err = sess.Start(n.ctx, n.config); err != nil {
+		_ = sess.Close()
+		n.Say(channel, messageInvalidSession, err)
+		return err
+	}
+
+	// Sessions are locked before being made available, as these may be reaped concurrently.
+	sess.owner, sess.channel, sess.notify, sess.options = author.ID, shared, channel, author.Options
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	n.mu.Lock()
+	n.sessions[sess.key()] = sess
+	n.mu.Unlock()
+
+	if author.Options.Welcome {
+		n.Say(channel, messageStartedSession, story.Name, author.Options.Prefix)
+	} else {
+		n.Say(channel, messageStartedSessionBrief, story.Name)
+	}
+	n.sayOutput(channel, sess, sess.Output())
+
+	return n.Checkpoint(sess)
+}
+
+// EndSession stops the given session and removes any checkpoint stored for it. Callers are expected
+// to hold the lock for the session.
+func (n *Inform) EndSession(sess *Session) error {
+	n.mu.Lock()
+	delete(n.sessions, sess.key())
+	n.mu.Unlock()
+
+	sess.ended = true
+	if err := sess.Close(); err != nil {
+		n.bot.Logger.Warn("Stopping session failed", zap.Error(err))
+	}
+
+	n.updateStatus(sess)
+
+	return n.RemoveCheckpoint(sess)
+}
+
+// Session returns the active session held against the key given, if any.
+func (n *Inform) session(key string) *Session {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.sessions[key]
+}
+
+// Touch marks the session given as active, as described for Session.touch. Callers are expected to
+// hold the lock for the session.
+func (n *Inform) touch(sess *Session, channel string, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sess.touch(channel, now)
+}
+
+// StorySessions returns the number of active sessions playing the story with the author and name
+// given, whether started by the author or by others the story is shared with.
+func (n *Inform) storySessions(authorID, name string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var count int
+	for _, sess := range n.sessions {
+		if sess.story.AuthorID == authorID && sess.story.Name == name {
+			count++
+		}
+	}
+
+	return count
+}
+
+// RunSession handles the given command against the session, either by passing it through to the
+// story interpreter or, for commands that act on the session itself (such as saving and restoring),
+// by handling them directly. Callers are expected to hold the lock for the session.
+func (n *Inform) RunSession(channel string, sess *Session, cmd string) error {
+	var fields = strings.Fields(strings.ToLower(cmd))
+	if len(fields) == 0 || len(fields) > 2 {
+		fields = []string{"", ""}
 	} else if len(fields) == 1 {
-		cmd = fields[0]
-	} else if len(fields) >= 2 {
-		cmd = strings.Join(fields[:2], " ")
-	}
-
-	switch strings.ToLower(cmd) {
-	case "help", "h":
-		return n.SayTemplate(ev.Channel, templateHelp, nil)
-	case "story", "stories", "story list", "list stories", "s":
-		return n.SayTemplate(ev.Channel, templateStoryList, author)
-	case "story add", "stories add", "add stories":
-		if len(fields) < 4 {
-			n.bot.Say(ev.Channel, messageUnknownStory)
-		} else if story, err := author.AddStory(fields[2], fields[3]); err != nil {
-			n.bot.Say(ev.Channel, messageInvalidStory, err)
-		} else if err := story.Compile(ctx, n.config); err != nil {
-			n.bot.Say(ev.Channel, "TODO: Compilation error: "+err.Error())
-			return err
-		} else if err = n.bot.Store.Set(authorKey, author); err != nil {
-			n.bot.Say(ev.Channel, messageUnknownError)
+		fields = append(fields, "")
+	}
+
+	// Sessions halted after exceeding their per-turn budget can only be restored, either to the last
+	// checkpoint taken, or to an explicit save.
+	if sess.halted() {
+		if fields[0] != "restore" {
+			n.Say(channel, messageHaltedSession, sess.story.Name)
+			return nil
+		} else if err := sess.restart(n.ctx, n.config); err != nil {
+			n.Say(channel, messageRunError, err)
 			return err
-		} else {
-			n.bot.Say(ev.Channel, messageAddedStory, fields[2])
+		} else if fields[1] == "" {
+			n.Say(channel, messageRecoveredSession, sess.story.Name)
+			return n.Checkpoint(sess)
 		}
-		return nil
-	case "story remove", "stories remove", "story rem", "stories rem":
-		// TODO: Check for active session.
-		if len(fields) < 3 {
-			n.bot.Say(ev.Channel, messageUnknownStory)
-		} else if err := author.RemoveStory(fields[2]); err != nil {
-			n.bot.Say(ev.Channel, messageInvalidStory, err)
-		} else if err = n.bot.Store.Set(authorKey, author); err != nil {
-			n.bot.Say(ev.Channel, messageUnknownError)
+	}
+
+	switch fields[0] {
+	case "save":
+		save, err := NewSave(sess.owner, sess.saveStory(), fields[1], nil)
+		if err != nil {
+			n.Say(channel, messageInvalidSave, err)
+			return nil
+		} else if save.Data, err = sess.Save(); err != nil {
+			n.Say(channel, messageRunError, err)
+			return err
+		} else if err = storeSave(n.bot.Store, save); err != nil {
+			n.Say(channel, messageUnknownError)
 			return err
-		} else {
-			n.bot.Say(ev.Channel, messageRemovedStory, fields[2])
 		}
+		n.Say(channel, messageSaved, save.Slot)
 		return nil
-	case "story start", "stories start":
-		if len(fields) < 3 {
-			n.bot.Say(ev.Channel, messageUnknownStory)
-		} else if story, err := author.GetStory(fields[2]); err != nil {
-			n.bot.Say(ev.Channel, messageInvalidStory, err)
-		} else if _, ok := n.sessions[author.ID]; ok {
-			n.bot.Say(ev.Channel, "TODO: Stop session before starting")
-		} else if sess, err := NewSession(story); err != nil {
-			n.bot.Say(ev.Channel, messageInvalidSession, err)
+	case "restore":
+		save, err := loadSave(n.bot.Store, sess.owner, sess.saveStory(), fields[1])
+		if err != nil {
+			n.Say(channel, messageInvalidSave, err)
+			return nil
+		} else if err = sess.Restore(save.Data); err != nil {
+			n.Say(channel, messageRunError, err)
 			return err
-		} else if err = sess.Start(ctx, n.config); err != nil {
-			n.bot.Say(ev.Channel, "TODO: Cannot start session: %s", err)
+		}
+		n.Say(channel, messageRestored, save.Slot)
+		n.sayOutput(channel, sess, sess.Output())
+		return n.SaveCheckpoint(sess)
+	case "saves":
+		if fields[1] != "" {
+			break
+		} else if saves, err := listSaves(n.bot.Store, sess.owner, sess.saveStory()); err != nil {
+			n.Say(channel, messageUnknownError)
 			return err
 		} else {
-			n.bot.Say(ev.Channel, messageStartedSession, fields[2], author.Options.Prefix)
-			n.bot.Say(ev.Channel, sess.Output())
-			n.sessions[author.ID] = sess
+			return n.SayTemplate(channel, templateSaveList, saveList{Story: sess.story.Name, Saves: saves})
 		}
-		return nil
-	case "story end", "stories end":
-		if n.sessions[author.ID] == nil {
-			n.bot.Say(ev.Channel, "TODO: No active session")
-		} else {
-			n.bot.Say(ev.Channel, "TODO: Stopped session")
-			delete(n.sessions, author.ID)
+	case "script":
+		if fields[1] == "" {
+			return n.StartTranscript(channel, sess)
 		}
-		return nil
-	case "option", "options", "option list", "list options", "o":
-		return n.SayTemplate(ev.Channel, templateOptionList, author)
-	case "option set", "options set", "set option", "set options":
-		if len(fields) < 4 {
-			n.bot.Say(ev.Channel, messageUnknownOption)
-		} else if err := author.SetOption(fields[2], fields[3]); err != nil {
-			n.bot.Say(ev.Channel, messageInvalidOption, err)
-		} else if err = n.bot.Store.Set(authorKey, author); err != nil {
-			n.bot.Say(ev.Channel, messageUnknownError)
-			return err
-		} else {
-			n.bot.Say(ev.Channel, messageSetOption, fields[2], fields[3])
+	case "unscript":
+		if fields[1] == "" {
+			return n.StopTranscript(channel, sess)
 		}
+	case "quit", "\\x":
+		// Sessions are ended with meta-commands, which check that whoever ends shared sessions is
+		// in control of them.
+		if fields[1] == "" {
+			var end = "story end"
+			if sess.channel != "" {
+				end = "channel end"
+			}
+			n.Say(channel, messageQuitSession, sess.story.Name, n.channelOptions(channel).Prefix+end)
+			return nil
+		}
+	}
+
+	var turnErr *TurnError
+	if err := sess.Run(cmd); errors.As(err, &turnErr) {
+		n.Say(channel, messageTurnError, turnErr.Command, turnErr.Reason)
 		return nil
+	} else if err != nil {
+		n.Say(channel, messageRunError, err)
+		return err
+	}
+
+	var out = sess.Output()
+	n.sayOutput(channel, sess, out)
+
+	if err := n.recordTranscript(channel, sess, cmd, stripStyles(out)); err != nil {
+		n.bot.Logger.Warn("Recording transcript failed", zap.String("story", sess.story.Ref()), zap.Error(err))
 	}
 
-	return n.SayTemplate(ev.Channel, templateUnknownCommand, cmd)
+	return n.Checkpoint(sess)
 }
 
 // Default executable names for required runtime dependencies.
@@ -168,6 +506,7 @@ const (
 	defaultInform7   = "/usr/libexec/ni"
 	defaultInform6   = "/usr/libexec/inform6"
 	defaultDumbFrotz = "/usr/bin/dfrotz"
+	defaultGlulxe    = "/usr/bin/glulxe"
 )
 
 type Config struct {
@@ -175,9 +514,48 @@ type Config struct {
 	Bot *joe.Bot // The bot handler.
 
 	// Optional attributes.
+	Admins       []string               // Author IDs allowed to manage extensions shared with all authors.
+	Blobs        blob.Store             // The store for story and extension sources and builds, defaulting to files under 'blobs'.
+	Templates    string                 // A directory of translations and overrides for messages, laid out as '<language>/*.tmpl'.
+	Compiler     Compiler               // The compiler used for stories, defaulting to Inform 7.
+	Interpreters map[string]Interpreter // Interpreters used for each story format, set to defaults if missing.
+
+	// Paths used for default compilers and interpreters, where these aren't explicitly set.
 	Inform7   string // The path to the `ni` Inform 7 compiler.
 	Inform6   string // The path to the `inform6` Inform 6 compiler.
 	DumbFrotz string // The path to the `dumb-frotz` interpreter.
+	Glulxe    string // The path to the `glulxe` interpreter, used for Glulx stories if available.
+	RemGlk    bool   // Whether or not the `glulxe` interpreter is built against RemGlk, and keeps text styles.
+	PTY       bool   // Whether or not default interpreters are run under a pseudo-terminal.
+
+	// Session lifetimes, where zero values are set to defaults, and negative values disable expiry.
+	SessionIdleTimeout time.Duration // The time after which sessions with no activity are ended.
+	SessionMaxLifetime time.Duration // The time after which sessions are ended, regardless of activity.
+	SessionWarning     time.Duration // The time before sessions are ended that participants are warned.
+	SessionAutosave    bool          // Whether or not sessions are saved before being ended.
+
+	// Per-turn budgets, where zero values are set to defaults, and negative values disable limits.
+	TurnTimeout  time.Duration // The time allowed for the story to respond to a command.
+	TurnCPULimit time.Duration // The CPU time allowed for the story to respond to a command.
+
+	// Limits for compiling stories, where zero values are set to defaults.
+	CompileWorkers   int           // The number of stories compiled concurrently.
+	CompileQueueSize int           // The number of stories allowed to wait for compilation.
+	CompileTimeout   time.Duration // The time allowed for compiling a story, not including time queued.
+
+	// Limits for story sources, where zero values are set to defaults.
+	MaxSourceSize int64         // The maximum size for story sources, in bytes.
+	UploadTimeout time.Duration // The time allowed for sending source files after 'story add <name>'.
+
+	// Retention limits for story revisions, where zero values are set to defaults, and negative values
+	// disable limits. The current revision for each story is always kept.
+	RevisionLimit  int           // The number of revisions kept for each story.
+	RevisionMaxAge time.Duration // The age after which revisions are removed.
+
+	// The restrictions applied to compiler and interpreter processes. Unless sandboxing is disabled,
+	// sandbox.Init needs to be called first thing in the program's main function, and paths for bot
+	// data, such as the store and blob directory, should be hidden in policy.
+	Sandbox sandbox.Policy
 }
 
 func New(conf Config) (*Inform, error) {
@@ -197,21 +575,145 @@ func New(conf Config) (*Inform, error) {
 	if conf.DumbFrotz == "" {
 		conf.DumbFrotz = defaultDumbFrotz
 	}
+	if conf.Glulxe == "" {
+		conf.Glulxe = defaultGlulxe
+	}
 
-	// Verify and expand paths for runtime dependencies.
-	if i7, err := exec.LookPath(conf.Inform7); err != nil {
-		return nil, errors.Wrap(err, "Inform 7 compiler not found")
-	} else if i6, err := exec.LookPath(conf.Inform6); err != nil {
-		return nil, errors.Wrap(err, "Inform 6 compiler not found")
-	} else if frotz, err := exec.LookPath(conf.DumbFrotz); err != nil {
-		return nil, errors.Wrap(err, "Frotz interpreter not found")
-	} else {
-		conf.Inform7, conf.Inform6, conf.DumbFrotz = i7, i6, frotz
+	// Set default session lifetimes, if needed.
+	if conf.SessionIdleTimeout == 0 {
+		conf.SessionIdleTimeout = defaultSessionIdleTimeout
+	}
+	if conf.SessionMaxLifetime == 0 {
+		conf.SessionMaxLifetime = defaultSessionMaxLifetime
+	}
+	if conf.SessionWarning == 0 {
+		conf.SessionWarning = defaultSessionWarning
+	}
+
+	// Set default per-turn budgets, if needed.
+	if conf.TurnTimeout == 0 {
+		conf.TurnTimeout = defaultTurnTimeout
+	}
+	if conf.TurnCPULimit == 0 {
+		conf.TurnCPULimit = defaultTurnCPULimit
+	}
+
+	// Set default limits for compiling stories, if needed.
+	if conf.CompileWorkers <= 0 {
+		conf.CompileWorkers = defaultCompileWorkers
+	}
+	if conf.CompileQueueSize <= 0 {
+		conf.CompileQueueSize = defaultCompileQueueSize
+	}
+	if conf.CompileTimeout == 0 {
+		conf.CompileTimeout = defaultCompileTimeout
 	}
 
-	return &Inform{
+	// Set default limits for story sources, if needed.
+	if conf.MaxSourceSize == 0 {
+		conf.MaxSourceSize = defaultMaxSourceSize
+	}
+	if conf.UploadTimeout == 0 {
+		conf.UploadTimeout = defaultUploadTimeout
+	}
+
+	// Set default retention limits for story revisions, if needed.
+	if conf.RevisionLimit == 0 {
+		conf.RevisionLimit = defaultRevisionLimit
+	}
+	if conf.RevisionMaxAge == 0 {
+		conf.RevisionMaxAge = defaultRevisionMaxAge
+	}
+
+	// Set up the default blob store, if needed.
+	if conf.Blobs == nil {
+		blobs, err := blob.NewFileStore(defaultBlobDir)
+		if err != nil {
+			return nil, errors.Wrap(err, "setting up blob store failed")
+		}
+		conf.Blobs = blobs
+	}
+
+	// Set up the default compiler, if needed, verifying and expanding paths for its dependencies.
+	if conf.Compiler == nil {
+		if i7, err := exec.LookPath(conf.Inform7); err != nil {
+			return nil, errors.Wrap(err, "Inform 7 compiler not found")
+		} else if i6, err := exec.LookPath(conf.Inform6); err != nil {
+			return nil, errors.Wrap(err, "Inform 6 compiler not found")
+		} else {
+			conf.Compiler = NewInform7Compiler(i7, i6)
+		}
+	}
+
+	// Set up default interpreters for any story formats that have none set, copying any existing
+	// interpreters so as not to modify the caller's configuration.
+	var interps = make(map[string]Interpreter, len(storyFormats))
+	for format, interp := range conf.Interpreters {
+		interps[format] = interp
+	}
+
+	if interps[FormatZ5] == nil || interps[FormatZ8] == nil {
+		// The built-in Z-machine interpreter is used where Frotz is not available.
+		var interp Interpreter = &ZMachineInterpreter{}
+		if frotz, err := exec.LookPath(conf.DumbFrotz); err != nil {
+			conf.Bot.Logger.Warn("Frotz interpreter not found, using built-in Z-machine interpreter", zap.Error(err))
+		} else {
+			var cmd = NewFrotzInterpreter(frotz)
+			cmd.PTY, interp = conf.PTY, cmd
+		}
+
+		for _, format := range []string{FormatZ5, FormatZ8} {
+			if interps[format] == nil {
+				interps[format] = interp
+			}
+		}
+	}
+
+	// The Glulx interpreter is optional, and Glulx stories will fail to start if not found.
+	if interps[FormatGlulx] == nil {
+		if glulxe, err := exec.LookPath(conf.Glulxe); err != nil {
+			conf.Bot.Logger.Warn("Glulx interpreter not found, Glulx stories will not be playable", zap.Error(err))
+		} else if conf.RemGlk {
+			interps[FormatGlulx] = NewRemGlkInterpreter(glulxe)
+		} else {
+			var interp = NewGlulxeInterpreter(glulxe)
+			interp.PTY = conf.PTY
+			interps[FormatGlulx] = interp
+		}
+	}
+
+	conf.Interpreters = interps
+
+	// Load built-in translations, along with any translations or overrides given.
+	catalog, err := loadCatalog(conf.Templates)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading translations failed")
+	}
+
+	var n = &Inform{
 		bot:      conf.Bot,
 		config:   &conf,
 		sessions: make(map[string]*Session),
-	}, nil
+		uploads:  make(map[string]*upload),
+		compiles: newCompileQueue(conf.CompileQueueSize),
+		catalog:  catalog,
+		options:  make(map[string]Options),
+	}
+
+	// Resume any sessions that were active when the bot was last stopped.
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	if err := n.rehydrate(n.ctx); err != nil {
+		n.cancel()
+		return nil, errors.Wrap(err, "resuming sessions failed")
+	}
+
+	// Remove any data left unreferenced when the bot was last running.
+	go n.collectGarbage()
+
+	go n.reaper()
+	for i := 0; i < conf.CompileWorkers; i++ {
+		go n.compileWorker()
+	}
+
+	return n, nil
 }
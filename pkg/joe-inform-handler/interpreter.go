@@ -0,0 +1,208 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/sandbox"
+)
+
+// An Interpreter runs compiled story files, producing a Process that input can be written to and
+// output read from.
+type Interpreter interface {
+	// Start runs the story file at the path given, using the directory given as its working
+	// directory, and the sandbox policy given for any external processes.
+	Start(ctx context.Context, policy sandbox.Policy, dir, story string) (Process, error)
+}
+
+// A Process represents a running story, as started by an Interpreter. Commands are written as lines
+// of input, and responses are read as output, with input prompts (e.g. '>') delimiting responses.
+type Process interface {
+	io.Writer
+
+	// Output returns the reader story output is read from, which is closed when the process exits.
+	Output() io.Reader
+	// Errors returns the reader errors are read from, or nil if errors are reported as output.
+	Errors() io.Reader
+	// CPUTime returns the total CPU time used by the process, or zero if this is unknown.
+	CPUTime() time.Duration
+	// Close stops the process, releasing any resources held.
+	Close() error
+}
+
+// A StatusProcess is a Process that keeps the status line apart from other output, rather than
+// printing it as part of its output.
+type StatusProcess interface {
+	Process
+
+	// Status returns the status line, as of the last request for input.
+	Status() Status
+}
+
+// A StatusPrintingProcess is a Process that prints the status line as the first line of output for
+// each request for input, which is split from other output where recognized as a status line.
+type StatusPrintingProcess interface {
+	Process
+
+	// PrintsStatus returns whether or not the status line is printed as part of output.
+	PrintsStatus() bool
+}
+
+// Placeholders replaced in arguments for CommandInterpreter instances.
+const (
+	argDir   = "{dir}"   // The session working directory.
+	argStory = "{story}" // The path to the story file.
+)
+
+// CommandInterpreter runs stories with an external interpreter executable, such as 'dfrotz' or
+// 'glulxe', communicating with it over standard input and output.
+type CommandInterpreter struct {
+	Path string   // The path to the interpreter executable.
+	Args []string // The arguments given, where '{dir}' and '{story}' placeholders are replaced.
+	PTY  bool     // Whether or not the interpreter is run under a pseudo-terminal.
+
+	// Whether or not the interpreter prints the status line at the start of its output, as is the
+	// case for 'dfrotz'.
+	StatusLine bool
+}
+
+// Start runs the story file given with the configured interpreter executable.
+func (c *CommandInterpreter) Start(ctx context.Context, policy sandbox.Policy, dir, story string) (Process, error) {
+	var args = make([]string, len(c.Args))
+	for i := range c.Args {
+		args[i] = strings.NewReplacer(argDir, dir, argStory, story).Replace(c.Args[i])
+	}
+
+	cmd, err := policy.Command(ctx, dir, c.Path, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &commandProcess{cmd: cmd, status: c.StatusLine}
+
+	// Interpreters may be run under a pseudo-terminal, in which case both output and errors are
+	// read from the terminal, or otherwise connected to pipes.
+	if c.PTY {
+		ptm, pts, err := openPTY()
+		if err != nil {
+			return nil, err
+		}
+
+		defer pts.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = pts, pts, pts
+		cmd.SysProcAttr = setControllingTerminal(cmd.SysProcAttr)
+		p.in, p.out, p.pty = ptm, ptm, ptm
+	} else if p.in, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	} else if p.out, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	} else if p.err, err = cmd.StderrPipe(); err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		if p.pty != nil {
+			p.pty.Close()
+		}
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// CommandProcess represents a story running under an external interpreter process.
+type commandProcess struct {
+	cmd *exec.Cmd
+	pty *os.File // The controlling end of the pseudo-terminal used, if any.
+
+	status bool // Whether or not the status line is printed as part of output.
+
+	in  io.WriteCloser
+	out io.ReadCloser
+	err io.ReadCloser
+}
+
+func (p *commandProcess) Write(buf []byte) (int, error) {
+	return p.in.Write(buf)
+}
+
+func (p *commandProcess) Output() io.Reader {
+	return p.out
+}
+
+func (p *commandProcess) PrintsStatus() bool {
+	return p.status
+}
+
+func (p *commandProcess) Errors() io.Reader {
+	if p.err == nil {
+		return nil
+	}
+
+	return p.err
+}
+
+// CPUTime returns the CPU time used by the interpreter process, as reported in '/proc/<pid>/stat'.
+func (p *commandProcess) CPUTime() time.Duration {
+	buf, err := ioutil.ReadFile("/proc/" + strconv.Itoa(p.cmd.Process.Pid) + "/stat")
+	if err != nil {
+		return 0
+	}
+
+	// The process name (the second field) may contain spaces, and is thus skipped before splitting
+	// the remaining fields, where user and system CPU times are the 14th and 15th fields.
+	var fields = strings.Fields(string(buf[bytes.LastIndexByte(buf, ')')+1:]))
+	if len(fields) < 13 {
+		return 0
+	}
+
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+
+	return time.Duration(utime+stime) * time.Second / clockTicks
+}
+
+// Close kills the interpreter process and waits for it to exit. Pseudo-terminals are not closed
+// when the process exits, and are closed explicitly.
+func (p *commandProcess) Close() error {
+	err := p.cmd.Process.Kill()
+	if err == nil {
+		_ = p.cmd.Wait()
+	}
+
+	if p.pty != nil {
+		p.pty.Close()
+	}
+
+	return err
+}
+
+// The number of clock ticks per second, as used for CPU times in '/proc/<pid>/stat'.
+const clockTicks = 100
+
+// Default arguments for interpreter executables.
+var (
+	defaultFrotzArgs  = []string{"-r", "lt", "-r", "cm", "-p", "-m", "-R", argDir, argStory}
+	defaultGlulxeArgs = []string{argStory}
+)
+
+// NewFrotzInterpreter returns an Interpreter for Z-machine stories, using the 'dfrotz' executable
+// at the path given, with file access restricted to the session directory.
+func NewFrotzInterpreter(path string) *CommandInterpreter {
+	return &CommandInterpreter{Path: path, Args: defaultFrotzArgs, StatusLine: true}
+}
+
+// NewGlulxeInterpreter returns an Interpreter for Glulx stories, using the 'glulxe' executable at
+// the path given, as built against a line-based Glk library such as CheapGlk.
+func NewGlulxeInterpreter(path string) *CommandInterpreter {
+	return &CommandInterpreter{Path: path, Args: defaultGlulxeArgs}
+}
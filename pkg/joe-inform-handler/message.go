@@ -1,28 +1,171 @@
 package inform
 
-import (
-	// Standard library
-	"text/template"
-)
-
 var templateOptionList = parseTemplate("option-list", `
 The options currently set for '{{.ID}}' are:
-> Prefix: {{with .Options.Prefix}}'{{.}}'{{else}}(None Set){{end}}
-Change these options with 'option set <key> <value>'.`)
+{{- range .Options}}
+> {{.Name}}: '{{.Value}}' — {{.Description}}
+{{- end}}
+Change these options with 'option set <name> <value>', or go back to default values with 'option reset <name>'.`)
 
 var templateStoryList = parseTemplate("story-list", `
 {{if .Stories}}
 The list of active stories for '{{.ID}}' are:
 {{- range .Stories}}
 > Name: '{{.Name}}'
-> Created at: {{.CreatedAt.Format "Mon, 02 Jan 2006 15:04"}}
-> Last updated at: {{.CreatedAt.Format "Mon, 02 Jan 2006 15:04"}}
+> Created at: {{(localtime .CreatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}
+> Last updated at: {{(localtime .UpdatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}
+> Format: {{with .BuildFormat}}{{.}}{{else}}z8{{end}}{{if not .Format}} (automatic){{end}}
+> Visibility: {{with .Visibility}}{{.}}{{else}}private{{end}}{{with .Grants}}, shared with {{range $i, $id := .}}{{if $i}}, {{end}}'{{$id}}'{{end}}{{end}}
 {{end}}
 {{else}}
 There are currently no active stories available for '{{.ID}}'.
 Add a new one with 'story add' or get more information with 'help story' and 'help story add'.
 {{end}}`)
 
+// CompileReport represents the data passed to the compile problems template.
+type compileReport struct {
+	*Story
+	Limit int // The number of problems shown.
+}
+
+var templateCompileProblems = parseTemplate("compile-problems", `
+I couldn't compile story '{{.Name}}', as {{with .Log.Problems}}{{len .}} problem(s) were{{else}}problems were{{end}} found:
+{{- range $i, $p := .Log.Problems}}{{if lt $i $.Limit}}
+> {{with $p.Line}}Line {{.}}: {{end}}{{$p.Message}}
+{{- end}}{{end}}
+{{if gt (len .Log.Problems) .Limit}}Only the first {{.Limit}} problem(s) are shown, see the full list{{else}}See the full compiler output{{end}} with 'story problems {{.Name}}'.`)
+
+var templateStoryProblems = parseTemplate("story-problems", `
+{{with .Log}}
+The last compilation for story '{{$.Name}}' on {{(localtime .CreatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}} {{if .Success}}succeeded{{else}}failed{{end}}.
+{{- range .Problems}}
+> {{with .Line}}Line {{.}}: {{end}}{{.Message}}
+{{- with .Excerpt}}
+>> {{.}}
+{{- end}}
+{{- else}}
+{{with .Output}}The compiler output was:
+{{.}}{{else}}No problems were reported by the compiler.{{end}}
+{{- end}}
+{{else}}
+Story '{{.Name}}' has not been compiled yet.
+{{end}}`)
+
+var templateSharedStoryList = parseTemplate("shared-story-list", `
+{{if .Stories}}
+The list of stories shared by '{{.AuthorID}}' are:
+{{- range .Stories}}
+> Name: '{{.Ref}}'
+> Last updated at: {{(localtime .UpdatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}
+{{end}}
+Play any of these with 'story start <name>', or make your own copy with 'story fork <name>'.
+{{else}}
+There are currently no stories shared by '{{.AuthorID}}'.
+{{end}}`)
+
+var templateExtensionList = parseTemplate("extension-list", `
+{{if or .Shared .Own}}
+{{- with .Shared}}
+The extensions available to all stories are:
+{{- range .}}
+> {{.Name}}
+{{- end}}
+{{end}}
+{{- with .Own}}
+The extensions available to your stories alone are:
+{{- range .}}
+> {{.Name}}
+{{- end}}
+{{end}}
+Use any of these in stories with 'Include <name>.', e.g. 'Include Basic Screen Effects by Emily Short.'.
+{{else}}
+There are currently no extensions available, apart from those built into Inform.
+Add a new one with 'extension add', and send the extension file when asked.
+{{end}}`)
+
+// StorySource represents the data passed to the story source template.
+type storySource struct {
+	Story string
+	Lines []numberedLine
+	Total int    // The total number of lines in the story source.
+	More  string // The range of lines following those shown, if any.
+}
+
+var templateStorySource = parseTemplate("story-source", `
+The source for story '{{.Story}}' has {{.Total}} line(s), of which these are shown:
+{{- range .Lines}}
+{{.Number}}: {{.Text}}
+{{- end}}
+{{with .More}}Show more with 'story show {{$.Story}} {{.}}'.{{end}}`)
+
+var templateStoryHistory = parseTemplate("story-history", `
+{{if .Revisions}}
+The list of revisions for story '{{.Name}}' are:
+{{- range .Revisions}}
+> Revision {{.Number}}{{if eq .Number $.Current.Number}} (current){{end}}: {{(localtime .CreatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}, {{.Size}} bytes, {{if not .Compiled}}not compiled{{else if .Success}}compiled successfully{{else}}failed to compile{{with .Problems}} with {{.}} problem(s){{end}}{{end}}{{with .Note}} ({{.}}){{end}}
+{{- end}}
+Compare revisions with 'story diff {{.Name}} <revision> [<revision>]', or go back to a revision with 'story rollback {{.Name}} <revision>'.
+{{else}}
+There are currently no revisions stored for story '{{.Name}}'.
+{{end}}`)
+
+// StoryDiff represents the data passed to the story difference template.
+type storyDiff struct {
+	Story  string
+	From   int
+	To     int
+	Lines  []string
+	Hidden int // The number of changed lines not shown.
+}
+
+var templateStoryDiff = parseTemplate("story-diff", `
+{{if .Lines}}
+The changes for story '{{.Story}}' from revision {{.From}} to revision {{.To}} are:
+{{- range .Lines}}
+{{.}}
+{{- end}}
+{{with .Hidden}}Another {{.}} changed line(s) are not shown.{{end}}
+{{else}}
+There are no changes for story '{{.Story}}' between revision {{.From}} and revision {{.To}}.
+{{end}}`)
+
+// SaveList represents the data passed to the save list template.
+type saveList struct {
+	Story string
+	Saves []*Save
+}
+
+var templateSaveList = parseTemplate("save-list", `
+{{if .Saves}}
+The list of saves for story '{{.Story}}' are:
+{{- range .Saves}}
+> Name: '{{.Slot}}'
+> Saved at: {{(localtime .CreatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}
+{{end}}
+{{else}}
+There are currently no saves available for story '{{.Story}}'.
+Save your progress during a story with 'save' or 'save <name>', and continue from where you left off with 'restore' or 'restore <name>'.
+{{end}}`)
+
+var templateStatusLine = parseTemplate("status-line", `
+{{- if .Location}}📍 {{.Location}}
+{{- if .Time}} · Time: {{.Hours}}:{{printf "%02d" .Minutes}}{{end}}
+{{- if .Scored}} · Score: {{.Score}}{{end}}
+{{- if .Counted}} · Moves: {{.Moves}}{{end}}
+{{- else}}📍 {{.Text}}{{end}}`)
+
+var templateTranscriptList = parseTemplate("transcript-list", `
+{{if .Transcripts}}
+The list of transcripts for story '{{.Story}}' are:
+{{- range .Transcripts}}
+> Transcript {{.Number}}: recorded on {{(localtime .CreatedAt).Format "Mon, 02 Jan 2006 15:04 MST"}}, with {{.Turns}} command(s)
+{{- end}}
+See a transcript with 'story transcript {{.Story}} <number>', optionally followed by 'text', 'markdown' or 'html'.
+{{else}}
+There are currently no transcripts for story '{{.Story}}'.
+Record one by using 'script' while playing the story, and 'unscript' to stop.
+{{end}}`)
+
 var templateWelcome = parseTemplate("welcome", `
 Hi! 👋
 
@@ -34,53 +177,288 @@ Inform is much, much more useful than just for writing interactive fiction stori
 
 That's where I come in, and can help in both defining the rules and performing actions against them, both in direct messages and in group-chats.
 
-For more information on how you can define these rules, and how to converse with me in group-chats, type 'help' and I'll respond with a list of topics you can look further into.`)
+For more information on how you can define these rules, and how to converse with me in group-chats, type 'help' and I'll respond with a list of topics you can look further into.
+
+You can change the language I respond in at any time with 'option set language <language>', e.g. 'option set language fr'.`)
 
 var templateHelp = parseTemplate("help", `
+These are the commands I understand, grouped by topic:
+{{- range .}}
+> {{.Name}}: {{range $i, $c := .Commands}}{{if $i}}, {{end}}'{{$c.Name}}'{{end}}
+{{- end}}
+Get more information on a topic or command with 'help <topic>' or 'help <command>', e.g. 'help story' or 'help story add'. Arguments containing spaces can be given in quotes, e.g. 'extension remove "Basic Screen Effects by Emily Short"'.
+
 Inform itself is a large, complicated system, and help on writing rules way beyond the scope of this help text. You are in luck though, as Inform comes with a large amount of documentation on its website: http://inform7.com/doc
 
 Feel free to ask any questions about, or report any issues with InformBot itself here: https://github.com/deuill/informbot`)
 
+var templateHelpTopic = parseTemplate("help-topic", `
+The commands for '{{.Name}}' are:
+{{- range .Commands}}
+> {{.Usage}}: {{.Summary}}
+{{- end}}
+Get more information on any of these with 'help <command>', e.g. 'help {{(index .Commands 0).Name}}'.`)
+
+var templateCommandUsage = parseTemplate("command-usage", `
+{{with .Error}}I couldn't understand that command — {{.}}.
+{{end}}Usage: '{{.Command.Usage}}'
+{{.Command.Summary}}{{with .Command.Help}}
+{{.}}{{end}}{{with .Command.Aliases}}
+Also available as {{range $i, $a := .}}{{if $i}}, {{end}}'{{$a}}'{{end}}.{{end}}`)
+
+var templateUnknownHelp = parseTemplate("unknown-help", `
+I don't have any help on '{{.Command}}'.{{with .Suggestion}} Did you mean '{{.}}'?{{end}} Type 'help' for an overview of all commands.`)
+
 var templateUnknownCommand = parseTemplate("unknown-command", `
-I don't understand what '{{.}}' means. Type 'help' for an overview of common commands.`)
+I don't understand what '{{.Command}}' means.{{with .Suggestion}} Did you mean '{{.}}'?{{end}} {{with .Topic}}Type 'help {{.}}' for a list of commands on '{{.}}'.{{else}}Type 'help' for an overview of all commands.{{end}}`)
 
-var messageInvalidSession = `
-I couldn't start the story successfully — %s.`
+var messageInvalidSession = newMessage("invalid-session", `
+I couldn't start the story successfully — %s.`)
 
-var messageStartedSession = `
+var messageStartedSession = newMessage("started-session", `
 Story '%s' successfully started.
-Any subsequent meta-commands will have to be given a prefix (currently set to '%s'), and you can end this session by using the 'story end' command. Have fun! 🎉`
+Any subsequent meta-commands will have to be given a prefix (currently set to '%s'), and you can end this session by using the 'story end' command. Have fun! 🎉`)
 
-var messageAddedStory = `
-Story '%s' successfully added to active list.`
+var messageStartedSessionBrief = newMessage("started-session-brief", `
+Story '%s' started.`)
 
-var messageRemovedStory = `
-Story '%s' successfully removed from active list.`
+var messageActiveSession = newMessage("active-session", `
+You're already playing story '%s'. End it with 'story end' before starting another story.`)
 
-// TODO FIX THESE TO BE MORE GENERIC
+var messageNoSession = newMessage("no-session", `
+You're not currently playing any story. Start one with 'story start <name>'.`)
 
-var messageUnknownStory = `
-You need to pass in both the story name and URL, e.g. 'story add some-name https://example.com/story.ni'.
-Story names need to be one word (though they can contain hyphens or underscores), and not contain any spaces or other white-space characters.`
+var messageEndedSession = newMessage("ended-session", `
+Story '%s' successfully ended.`)
 
-var messageInvalidStory = `
-I couldn't add the story successfully — %s.`
+var messageQuitSession = newMessage("quit-session", `
+Story '%s' can't be quit from within the story itself, end it with '%s' instead.`)
 
-var messageSetOption = `
-Option '%s' successfully set to '%s'.`
+var messageNoStatus = newMessage("no-status", `
+Story '%s' hasn't shown a status line yet.`)
 
-var messageUnknownOption = `
-You need to pass in both the option name and value, e.g. 'option set Prefix ?'.`
+var messageResumedSession = newMessage("resumed-session", `
+Your game of '%s' was restored after I was restarted, and you can continue from where you left off.`)
 
-var messageInvalidOption = `
-I couldn't set that option successfully — %s.`
+var messageChannelSession = newMessage("channel-session", `
+Story '%s' is currently being played in this channel, under the control of '%s'.
+Anyone here can send commands to the story, but only the person in control can end the session with 'channel end' or hand over control with 'channel control <id>'.`)
 
-var messageRunError = `
-I could't run that command — %s.`
+var messageNoChannelSession = newMessage("no-channel-session", `
+There's no story being played in this channel. Start one for everyone here with 'channel start <name>'.`)
 
-var messageUnknownError = `
-Oops, something went wrong and I was unable to complete that request, give me a moment and try again (or ask whoever set me up for some help).`
+var messageEndedChannelSession = newMessage("ended-channel-session", `
+Story '%s' successfully ended for everyone in this channel.`)
 
-func parseTemplate(name, content string) *template.Template {
-	return template.Must(template.New(name).Parse(content))
-}
+var messageNotChannelOwner = newMessage("not-channel-owner", `
+Only '%s' can do that, as they're in control of the story played in this channel.`)
+
+var messageChannelOwner = newMessage("channel-owner", `
+Control of the story played in this channel was handed over to '%s'.`)
+
+var messageInvalidChannelOwner = newMessage("invalid-channel-owner", `
+I couldn't hand over control of the story played in this channel — %s.`)
+
+var messageGuestCommand = newMessage("guest-command", `
+Sorry %s, I can't tell who you are, as your address isn't visible in this channel. You can still send commands to the story being played here, but anything else needs to be sent to me directly.`)
+
+var messageExpiringSession = newMessage("expiring-session", `
+Story '%s' will end in %s, unless someone sends it a command before then.`)
+
+var messageExpiredSession = newMessage("expired-session", `
+Story '%s' has ended, as it was left idle or open for too long. Start it again with 'story start'.`)
+
+var messageExpiredSessionSaved = newMessage("expired-session-saved", `
+Story '%s' has ended, as it was left idle or open for too long. Your progress was saved, and you can continue from where you left off by starting the story again and using 'restore %s'.`)
+
+var messageTurnError = newMessage("turn-error", `
+The command '%s' %s, so I had to stop the story.
+Reply with 'restore' to go back to how things were before that command, or 'restore <name>' to continue from one of your saves.`)
+
+var messageHaltedSession = newMessage("halted-session", `
+Story '%s' was stopped, and needs to be restored before continuing.
+Reply with 'restore' to go back to where you last left off, or 'restore <name>' to continue from one of your saves.`)
+
+var messageRecoveredSession = newMessage("recovered-session", `
+Story '%s' was restored to where you last left off. Type 'look' to get your bearings.`)
+
+var messageAddedStory = newMessage("added-story", `
+Story '%s' successfully added to active list.`)
+
+var messageStoryInUse = newMessage("story-in-use", `
+Story '%s' can't be removed while being played, in %d session(s). End any sessions for it first, e.g. with 'story end'.`)
+
+var messageRemovedStory = newMessage("removed-story", `
+Story '%s' successfully removed from active list.`)
+
+var messageSaved = newMessage("saved", `
+Story progress successfully saved as '%s'.`)
+
+var messageRestored = newMessage("restored", `
+Story progress successfully restored from '%s'.`)
+
+var messageInvalidSave = newMessage("invalid-save", `
+I couldn't find or use that save — %s.`)
+
+var messageStartedTranscript = newMessage("started-transcript", `
+Recording transcript %d for story '%s'. Every command and response will be kept until you stop recording with 'unscript'.`)
+
+var messageStoppedTranscript = newMessage("stopped-transcript", `
+Stopped recording transcript %d, with %d command(s) recorded. See it with 'story transcript %s %[1]d', optionally followed by 'text', 'markdown' or 'html'.`)
+
+var messageInvalidTranscript = newMessage("invalid-transcript", `
+I couldn't use that transcript — %s.`)
+
+var messageTruncatedTranscript = newMessage("truncated-transcript", `
+The transcript is too long to show in full, so only the first %d of %d command(s) were shown.`)
+
+var messageExpectingUpload = newMessage("expecting-upload", `
+Send me the source for story '%s' as a file in the next %s, and I'll add it to your active list.`)
+
+var messageUnexpectedUpload = newMessage("unexpected-upload", `
+I wasn't expecting a file from you — if this is the source for a story, use 'story add <name>' first, or 'extension add' for extensions, and send the file again.`)
+
+var messageEditedStory = newMessage("edited-story", `
+Story '%s' successfully updated, and now has %d line(s).`)
+
+var messageInvalidEdit = newMessage("invalid-edit", `
+I couldn't edit the story successfully — %s.`)
+
+var messageInvalidLines = newMessage("invalid-lines", `
+I couldn't show the story source — %s.`)
+
+var messageRolledBackStory = newMessage("rolled-back-story", `
+Story '%s' successfully rolled back to revision %d, and saved as revision %d.`)
+
+var messageInvalidRevision = newMessage("invalid-revision", `
+I couldn't use that revision — %s.`)
+
+var messageSharedStory = newMessage("shared-story", `
+Story '%s' successfully set to %s visibility, and can be referred to by others as '%s'.`)
+
+var messageGrantedStory = newMessage("granted-story", `
+'%s' can now play story '%s', by referring to it as '%s'.`)
+
+var messageRevokedStory = newMessage("revoked-story", `
+'%s' can no longer play story '%s', unless it is shared publicly.`)
+
+var messageInvalidSharing = newMessage("invalid-sharing", `
+I couldn't change how the story is shared — %s.`)
+
+var messageForkedStory = newMessage("forked-story", `
+Story '%s' successfully copied to your active list as '%s'.`)
+
+var messageInvalidStory = newMessage("invalid-story", `
+I couldn't add the story successfully — %s.`)
+
+var messageExpectingExtension = newMessage("expecting-extension", `
+Send me the extension as a file in the next %s, and I'll make it available to your stories.`)
+
+var messageAddedExtension = newMessage("added-extension", `
+Extension '%s' successfully added, and will be available the next time stories are compiled.`)
+
+var messageRemovedExtension = newMessage("removed-extension", `
+Extension '%s' successfully removed.`)
+
+var messageInvalidExtension = newMessage("invalid-extension", `
+I couldn't add or remove the extension successfully — %s.`)
+
+var messageNotAdmin = newMessage("not-admin", `
+Only administrators can manage extensions shared with everyone, though you can add extensions for your own stories with 'extension add'.`)
+
+var messageSetFormat = newMessage("set-format", `
+Story '%s' successfully compiled, with format set to '%s'.`)
+
+var messageCompileQueued = newMessage("compile-queued", `
+Story '%s' is queued for compiling, and I'll let you know once it's done.`)
+
+var messageCompileQueuedBehind = newMessage("compile-queued-behind", `
+Story '%s' is queued for compiling, behind %d other story(s), and I'll let you know once it's done.`)
+
+var messageCompiling = newMessage("compiling", `
+Compiling story '%s', which might take a while. You can stop this with 'story cancel %[1]s'.`)
+
+var messageCompileQueueFull = newMessage("compile-queue-full", `
+I couldn't queue story '%s' for compiling, as too many stories are waiting to be compiled. Your changes were kept, so try again in a moment with 'story compile %[1]s'.`)
+
+var messageCompiledStory = newMessage("compiled-story", `
+Story '%s' successfully compiled.`)
+
+var messageCompileTimeout = newMessage("compile-timeout", `
+I had to stop compiling story '%s', as it took longer than %s.`)
+
+var messageCancelledCompile = newMessage("cancelled-compile", `
+Compiling story '%s' was cancelled, and the story will not be updated until it is next compiled.`)
+
+var messageInvalidCancel = newMessage("invalid-cancel", `
+I couldn't cancel compiling the story — %s.`)
+
+var messageInvalidFormat = newMessage("invalid-format", `
+I couldn't set the story format successfully — %s.`)
+
+var messageSetOption = newMessage("set-option", `
+Option '%s' successfully set to '%s'.`)
+
+var messageResetOption = newMessage("reset-option", `
+Option '%s' successfully reset to '%s'.`)
+
+var messageResetOptions = newMessage("reset-options", `
+All options successfully reset to their default values.`)
+
+var messageInvalidOption = newMessage("invalid-option", `
+I couldn't set that option successfully — %s.`)
+
+var messageRunError = newMessage("run-error", `
+I could't run that command — %s.`)
+
+var messageUnknownStory = newMessage("unknown-story", `
+You need to pass in the story name, e.g. 'story add some-name', and then send the story source as a file, or pass in a URL for it, e.g. 'story add some-name https://example.com/story.ni'.
+Story names need to be one word (though they can contain hyphens or underscores), and not contain any spaces or other white-space characters.`)
+
+var messageUnknownStorySource = newMessage("unknown-story-source", `
+You need to pass in the story name, followed by the story source on the lines after, e.g.:
+story new some-name
+The Kitchen is a room.`)
+
+var messageUnknownEdit = newMessage("unknown-edit", `
+You need to pass in the story name, the line numbers to change, and any new text, e.g.:
+> 'story edit some-name 12 The Kitchen is a room.' replaces line 12 (or lines 12 to 14, for '12-14').
+> 'story insert some-name 12 The Kitchen is a room.' adds text before line 12.
+> 'story delete some-name 12-14' removes lines 12 to 14.
+> 'story append some-name The Kitchen is a room.' adds text to the end of the story.
+Text can also start on the line after the command, and span multiple lines. See the current story source, with line numbers, with 'story show some-name'.`)
+
+var messageUnknownRevision = newMessage("unknown-revision", `
+You need to pass in both the story name and revision number, e.g. 'story rollback some-name 3', or 'story diff some-name 3 5'.
+See the list of revisions for a story with 'story history some-name'.`)
+
+var messageUnknownVisibility = newMessage("unknown-visibility", `
+You need to pass in both the story name and visibility, e.g. 'story share some-name public'.
+Supported visibilities are 'private', where only those you grant access to can play the story, 'unlisted', where anyone who knows the story name can play it, and 'public', where the story is also listed for everyone.`)
+
+var messageUnknownGrant = newMessage("unknown-grant", `
+You need to pass in both the story name and the ID of whoever you want to share it with, e.g. 'story grant some-name someone@example.com'.`)
+
+var messageUnknownFork = newMessage("unknown-fork", `
+You need to pass in the story to copy, and optionally a new name for it, e.g. 'story fork someone@example.com/some-name my-name'.`)
+
+var messageUnknownFormat = newMessage("unknown-format", `
+You need to pass in both the story name and format, e.g. 'story format some-name glulx'.
+Supported formats are 'z5', 'z8', 'glulx', and 'auto', which compiles to 'z8' unless the story is too large, in which case 'glulx' is used.`)
+
+var messageUnknownTranscript = newMessage("unknown-transcript", `
+You need to pass in the story name, e.g. 'story transcripts some-name' to list transcripts, or 'story transcript some-name 2 markdown' to see transcript 2 as Markdown.
+Supported formats are 'text', 'markdown' and 'html'. Transcripts are recorded by using 'script' while playing a story, and 'unscript' to stop.`)
+
+var messageUnknownChannelOwner = newMessage("unknown-channel-owner", `
+You need to pass in the ID of whoever you want to hand control over to, e.g. 'channel control someone@example.com'.`)
+
+var messageUnknownExtension = newMessage("unknown-extension", `
+You need to pass in the full extension name, e.g. 'extension remove Basic Screen Effects by Emily Short'.
+Shared extensions are removed with 'extension remove shared <name>'.`)
+
+var messageUnknownOption = newMessage("unknown-option", `
+You need to pass in both the option name and value, e.g. 'option set prefix ?'.`)
+
+var messageUnknownError = newMessage("unknown-error", `
+Oops, something went wrong and I was unable to complete that request, give me a moment and try again (or ask whoever set me up for some help).`)
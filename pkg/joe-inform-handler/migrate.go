@@ -0,0 +1,287 @@
+package inform
+
+import (
+	// Standard library
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Migrations lists changes made to the schema of stored records, in order, for use with memory
+// backends that apply migrations on startup. New migrations are to be appended here whenever stored
+// types change in ways that cannot be handled when decoding records.
+var Migrations = []bolt.Migration{
+	{Version: 1, Description: "set default options for authors stored without them", Migrate: migrateAuthorOptions},
+	{Version: 2, Description: "set default language for authors stored without one", Migrate: migrateAuthorLanguage},
+	{Version: 3, Description: "set default output, time zone and verbosity options for authors stored without them", Migrate: migrateAuthorOutputOptions},
+	{Version: 4, Description: "move transcript entries into separate records", Migrate: migrateTranscriptEntries},
+	{Version: 5, Description: "escape author IDs and story names in keys for saves", Migrate: migrateSaveKeys},
+	{Version: 6, Description: "escape author IDs and story names in keys for transcripts", Migrate: migrateTranscriptKeys},
+}
+
+// Migrations are expected to remain unchanged once added, and therefore spell out the option names
+// and default values they set, rather than refer to current types and values.
+
+// MigrateAuthorOptions sets the default prefix for stored authors, as is the case for authors stored
+// before options were added.
+func migrateAuthorOptions(tx bolt.Tx) error {
+	return migrateOptions(tx, func(options map[string]json.RawMessage) {
+		setDefaultOption(options, "Prefix", "?")
+	})
+}
+
+// MigrateAuthorLanguage sets the default language for stored authors, as is the case for authors
+// stored before the language option was added.
+func migrateAuthorLanguage(tx bolt.Tx) error {
+	return migrateOptions(tx, func(options map[string]json.RawMessage) {
+		setDefaultOption(options, "Language", "en")
+	})
+}
+
+// MigrateAuthorOutputOptions sets default output, time zone and verbosity options for stored authors,
+// as is the case for authors stored before these options were added.
+func migrateAuthorOutputOptions(tx bolt.Tx) error {
+	return migrateOptions(tx, func(options map[string]json.RawMessage) {
+		setDefaultOption(options, "Output", "plain")
+		setDefaultOption(options, "TimeZone", "UTC")
+		setDefaultOption(options, "Problems", 3)
+		setDefaultOption(options, "Welcome", true)
+		setDefaultOption(options, "Status", true)
+	})
+}
+
+// MigrateOptions applies the function given to the options for each stored author, decoded into their
+// separate fields, such that options not known to the function are retained as-is. Authors stored
+// without options are given an empty set of options.
+func migrateOptions(tx bolt.Tx, fn func(options map[string]json.RawMessage)) error {
+	return migrateAuthors(tx, func(author map[string]json.RawMessage) error {
+		var options = make(map[string]json.RawMessage)
+		if raw, ok := author["Options"]; ok && string(raw) != "null" {
+			if err := json.Unmarshal(raw, &options); err != nil {
+				return err
+			}
+		}
+
+		fn(options)
+
+		raw, err := json.Marshal(options)
+		if err != nil {
+			return err
+		}
+
+		author["Options"] = raw
+		return nil
+	})
+}
+
+// SetDefaultOption sets the option with the name given to the value given, where the option is
+// missing, or set to an empty string or zero. Options set to false are left as-is, as these can't be
+// told apart from options explicitly turned off.
+func setDefaultOption(options map[string]json.RawMessage, name string, value interface{}) {
+	switch string(options[name]) {
+	case "", "null", `""`, "0":
+		options[name], _ = json.Marshal(value)
+	}
+}
+
+// MigrateTranscriptEntries moves entries held inline in stored transcripts into separate records for
+// each entry, as stored by transcripts recorded since.
+func migrateTranscriptEntries(tx bolt.Tx) error {
+	keys, err := tx.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix+".transcript.") {
+			continue
+		}
+
+		var record map[string]json.RawMessage
+		var transcript struct {
+			Number   int
+			AuthorID string
+			Story    string
+			Entries  []json.RawMessage
+		}
+
+		value, _, err := tx.Get(key)
+		if err != nil {
+			return err
+		} else if err = json.Unmarshal(value, &record); err != nil {
+			return errors.Wrapf(err, "decoding record '%s' failed", key)
+		} else if err = json.Unmarshal(value, &transcript); err != nil {
+			return errors.Wrapf(err, "decoding record '%s' failed", key)
+		} else if _, ok := record["Entries"]; !ok {
+			continue
+		}
+
+		// Keys for entries are spelled out here, so as to remain unaffected by later changes.
+		for i, entry := range transcript.Entries {
+			var key = keyPrefix + ".transcript-entry." + transcript.AuthorID + "." + transcript.Story + "." +
+				strconv.Itoa(transcript.Number) + "." + strconv.Itoa(i+1)
+			if err := tx.Set(key, entry); err != nil {
+				return err
+			}
+		}
+
+		record["Turns"], _ = json.Marshal(len(transcript.Entries))
+		delete(record, "Entries")
+
+		if value, err = json.Marshal(record); err != nil {
+			return errors.Wrapf(err, "encoding record '%s' failed", key)
+		} else if err = tx.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateSaveKeys moves stored saves to keys with author IDs, story names and slots escaped, as their
+// unescaped forms may contain the separators used in keys.
+func migrateSaveKeys(tx bolt.Tx) error {
+	keys, err := tx.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix+".save.") {
+			continue
+		}
+
+		var save struct {
+			AuthorID string
+			Story    string
+			Slot     string
+		}
+
+		value, _, err := tx.Get(key)
+		if err != nil {
+			return err
+		} else if err = json.Unmarshal(value, &save); err != nil {
+			return errors.Wrapf(err, "decoding record '%s' failed", key)
+		}
+
+		// Keys for saves are spelled out here, so as to remain unaffected by later changes.
+		var escaped = keyPrefix + ".save." + migrateKeyPart(save.AuthorID) + "." + migrateKeyPart(save.Story) + "." +
+			migrateKeyPart(strings.ToLower(save.Slot))
+		if escaped == key {
+			continue
+		} else if err = tx.Set(escaped, value); err != nil {
+			return err
+		} else if _, err = tx.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateTranscriptKeys moves stored transcripts and their entries to keys with author IDs and story
+// names escaped, as their unescaped forms may contain the separators used in keys.
+func migrateTranscriptKeys(tx bolt.Tx) error {
+	keys, err := tx.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix+".transcript.") {
+			continue
+		}
+
+		var transcript struct {
+			Number   int
+			AuthorID string
+			Story    string
+			Turns    int
+		}
+
+		value, _, err := tx.Get(key)
+		if err != nil {
+			return err
+		} else if err = json.Unmarshal(value, &transcript); err != nil {
+			return errors.Wrapf(err, "decoding record '%s' failed", key)
+		}
+
+		// Keys for transcripts and entries are spelled out here, so as to remain unaffected by later
+		// changes.
+		var num = strconv.Itoa(transcript.Number)
+		var oldEntry = keyPrefix + ".transcript-entry." + transcript.AuthorID + "." + transcript.Story + "." + num + "."
+		var newEntry = keyPrefix + ".transcript-entry." + migrateKeyPart(transcript.AuthorID) + "." +
+			migrateKeyPart(transcript.Story) + "." + num + "."
+		if oldEntry != newEntry {
+			for turn := 1; turn <= transcript.Turns; turn++ {
+				if entry, ok, err := tx.Get(oldEntry + strconv.Itoa(turn)); err != nil {
+					return err
+				} else if !ok {
+					continue
+				} else if err = tx.Set(newEntry+strconv.Itoa(turn), entry); err != nil {
+					return err
+				} else if _, err = tx.Delete(oldEntry + strconv.Itoa(turn)); err != nil {
+					return err
+				}
+			}
+		}
+
+		var escaped = keyPrefix + ".transcript." + migrateKeyPart(transcript.AuthorID) + "." +
+			migrateKeyPart(transcript.Story) + "." + num
+		if escaped == key {
+			continue
+		} else if err = tx.Set(escaped, value); err != nil {
+			return err
+		} else if _, err = tx.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateKeyPart returns the text given as escaped for use as part of a stored key. This matches
+// keyPart as introduced, and is kept apart so as to remain unaffected by later changes.
+func migrateKeyPart(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), ".", "%2E")
+}
+
+// MigrateAuthors applies the function given to each stored author, decoded into its separate fields,
+// such that fields not known to the function are retained as-is.
+func migrateAuthors(tx bolt.Tx, fn func(author map[string]json.RawMessage) error) error {
+	keys, err := tx.Keys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, keyPrefix+".author.") {
+			continue
+		}
+
+		var author map[string]json.RawMessage
+		if value, _, err := tx.Get(key); err != nil {
+			return err
+		} else if err = json.Unmarshal(value, &author); err != nil {
+			return errors.Wrapf(err, "decoding record '%s' failed", key)
+		} else if err = fn(author); err != nil {
+			return errors.Wrapf(err, "migrating record '%s' failed", key)
+		}
+
+		value, err := json.Marshal(author)
+		if err != nil {
+			return errors.Wrapf(err, "encoding record '%s' failed", key)
+		} else if err = tx.Set(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,311 @@
+package inform
+
+import (
+	// Standard library
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Styles supported for story output.
+const (
+	OutputPlain     = "plain"     // Output is sent as-is.
+	OutputMonospace = "monospace" // Output is sent as a pre-formatted block.
+	OutputStyled    = "styled"    // Output is sent with headings emphasized, for clients supporting message styling.
+)
+
+// Options represent user-configurable values, which are used in processing commands
+// and formatting output.
+type Options struct {
+	Prefix     string // The prefix for meta-commands given while playing stories.
+	Language   string // The language responses are sent in.
+	Output     string // The style story output is sent in, one of the Output* constants.
+	TimeZone   string // The time zone times are shown in, as named in the IANA time zone database.
+	Welcome    bool   // Whether or not hints on playing stories are shown when starting them.
+	Status     bool   // Whether or not progress is reported while compiling stories.
+	Problems   int    // The number of problems shown when compiling stories fails.
+	StatusLine bool   // Whether or not the status line is shown at the top of story output.
+}
+
+// Default values for options, as assigned to newly created Author instances.
+var defaultOptions = Options{
+	Prefix:   "?",
+	Language: DefaultLanguage,
+	Output:   OutputPlain,
+	TimeZone: "UTC",
+	Welcome:  true,
+	Status:   true,
+	Problems: 3,
+}
+
+// Locations holds time zones already loaded, against their names, as loading time zones reads from
+// the time zone database every time.
+var locations sync.Map
+
+// Location returns the time zone set, or UTC if the time zone set is invalid.
+func (o Options) Location() *time.Location {
+	if loc, ok := locations.Load(o.TimeZone); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(o.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	locations.Store(o.TimeZone, loc)
+	return loc
+}
+
+// Language returns the language set, or the default language, if none is set.
+func (o Options) language() string {
+	if o.Language != "" {
+		return o.Language
+	}
+
+	return DefaultLanguage
+}
+
+// Option represents a single option, as set by name, along with functions for getting and setting
+// its value as text. Values set are validated against the type of the option.
+type option struct {
+	name        string
+	description string
+	get         func(o *Options) string
+	set         func(o *Options, value string) error
+}
+
+// Message returns the option description as a message, for use with translations.
+func (opt *option) message() *message {
+	return &message{name: "option-" + opt.name + "-description", text: opt.description}
+}
+
+// AvailableOptions lists all options authors can set, in the order they are listed in.
+var availableOptions = []*option{
+	stringOption("prefix", "The prefix for commands given to the bot while playing stories, e.g. '?story end'.",
+		func(o *Options) *string { return &o.Prefix }),
+	enumOption("language", "The language I respond in, e.g. 'en' or 'fr'.",
+		func(o *Options) *string { return &o.Language }),
+	enumOption("output", "The style story output is sent in, either 'plain', 'monospace' for a pre-formatted block, or 'styled' for headings, emphasis and other text styles.",
+		func(o *Options) *string { return &o.Output }, OutputPlain, OutputMonospace, OutputStyled),
+	timeZoneOption("timezone", "The time zone times are shown in, e.g. 'Europe/Paris', or 'UTC'.",
+		func(o *Options) *string { return &o.TimeZone }),
+	boolOption("welcome", "Whether or not hints on playing are shown when starting stories, either 'on' or 'off'.",
+		func(o *Options) *bool { return &o.Welcome }),
+	boolOption("status", "Whether or not progress is reported while compiling stories, either 'on' or 'off'.",
+		func(o *Options) *bool { return &o.Status }),
+	intOption("problems", "The number of problems shown when stories fail to compile, from 1 to 20.",
+		func(o *Options) *int { return &o.Problems }, 1, 20),
+	boolOption("statusline", "Whether or not the status line, e.g. the current location and score, is shown with every response while playing stories, either 'on' or 'off'.",
+		func(o *Options) *bool { return &o.StatusLine }),
+}
+
+// FindOption returns the option with the name given, if any.
+func findOption(name string) (*option, error) {
+	for _, opt := range availableOptions {
+		if strings.EqualFold(opt.name, name) {
+			return opt, nil
+		}
+	}
+
+	return nil, errors.New("option name '" + name + "' is unknown")
+}
+
+// NewOption returns an option with the name, description, and functions given, registering the
+// description for use in translations.
+func newOption(name, description string, get func(o *Options) string, set func(o *Options, value string) error) *option {
+	var opt = &option{name: name, description: description, get: get, set: set}
+	catalogNames[opt.message().name] = true
+	return opt
+}
+
+// StringOption returns an option taking any non-empty text.
+func stringOption(name, description string, field func(o *Options) *string) *option {
+	return newOption(name, description, func(o *Options) string {
+		return *field(o)
+	}, func(o *Options, value string) error {
+		if value == "" {
+			return errors.New("cannot set empty " + name + " value")
+		}
+		*field(o) = value
+		return nil
+	})
+}
+
+// EnumOption returns an option taking one of the values given, in any case, or any single word if no
+// values are given.
+func enumOption(name, description string, field func(o *Options) *string, values ...string) *option {
+	return newOption(name, description, func(o *Options) string {
+		return *field(o)
+	}, func(o *Options, value string) error {
+		value = strings.ToLower(value)
+		if value == "" || strings.ContainsAny(value, " \t\r\n") {
+			return errors.New("'" + value + "' is not a valid " + name + " value")
+		}
+		for _, v := range values {
+			if v == value {
+				*field(o) = value
+				return nil
+			}
+		}
+		if len(values) > 0 {
+			return errors.Errorf("'%s' is not a valid %s value, try one of '%s'", value, name, strings.Join(values, "', '"))
+		}
+		*field(o) = value
+		return nil
+	})
+}
+
+// TimeZoneOption returns an option taking time zone names, as found in the IANA time zone database.
+func timeZoneOption(name, description string, field func(o *Options) *string) *option {
+	return newOption(name, description, func(o *Options) string {
+		return *field(o)
+	}, func(o *Options, value string) error {
+		if value == "" || value == "Local" {
+			return errors.New("'" + value + "' is not a valid time zone")
+		} else if loc, err := time.LoadLocation(value); err != nil {
+			return errors.New("'" + value + "' is not a valid time zone, try one like 'Europe/Paris', or 'UTC'")
+		} else {
+			*field(o) = loc.String()
+		}
+		return nil
+	})
+}
+
+// BoolOption returns an option taking 'on' or 'off', or any of their common synonyms.
+func boolOption(name, description string, field func(o *Options) *bool) *option {
+	return newOption(name, description, func(o *Options) string {
+		if *field(o) {
+			return "on"
+		}
+		return "off"
+	}, func(o *Options, value string) error {
+		switch strings.ToLower(value) {
+		case "on", "yes", "true", "1":
+			*field(o) = true
+		case "off", "no", "false", "0":
+			*field(o) = false
+		default:
+			return errors.New("'" + value + "' is not a valid " + name + " value, try 'on' or 'off'")
+		}
+		return nil
+	})
+}
+
+// IntOption returns an option taking whole numbers between the minimum and maximum given, inclusive.
+func intOption(name, description string, field func(o *Options) *int, low, high int) *option {
+	return newOption(name, description, func(o *Options) string {
+		return strconv.Itoa(*field(o))
+	}, func(o *Options, value string) error {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < low || v > high {
+			return errors.Errorf("'%s' is not a valid %s value, try a number from %d to %d", value, name, low, high)
+		}
+		*field(o) = v
+		return nil
+	})
+}
+
+// SetOption sets the option with the name given to the value given, as long as the value is valid
+// for the option.
+func (a *Author) SetOption(name, value string) error {
+	opt, err := findOption(name)
+	if err != nil {
+		return err
+	}
+
+	return opt.set(&a.Options, value)
+}
+
+// ResetOption sets the option with the name given to its default value, or sets all options to their
+// default values, if no name is given.
+func (a *Author) ResetOption(name string) error {
+	if name == "" {
+		a.Options = defaultOptions
+		return nil
+	}
+
+	opt, err := findOption(name)
+	if err != nil {
+		return err
+	}
+
+	return opt.set(&a.Options, opt.get(&defaultOptions))
+}
+
+// OptionValue represents a single option in the option list template.
+type optionValue struct {
+	Name        string
+	Value       string
+	Description string
+}
+
+// OptionList represents the data passed to the option list template.
+type optionList struct {
+	ID      string
+	Options []optionValue
+}
+
+// OptionList returns all options set for the author given, with descriptions translated to the
+// language set for the channel given.
+func (n *Inform) optionList(channel string, author *Author) optionList {
+	var list = optionList{ID: author.ID}
+	for _, opt := range availableOptions {
+		list.Options = append(list.Options, optionValue{
+			Name:        opt.name,
+			Value:       opt.get(&author.Options),
+			Description: n.message(channel, opt.message()),
+		})
+	}
+
+	return list
+}
+
+// ChannelOptions returns the options responses to the channel given are formatted with. These are
+// the options for the author whose request is being handled in the channel, if any, or otherwise the
+// options for the owner of the session last interacted with in the channel, or the default options.
+func (n *Inform) channelOptions(channel string) Options {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if o, ok := n.options[channel]; ok {
+		return o
+	}
+
+	for _, sess := range n.sessions {
+		if sess.notify == channel {
+			return sess.options
+		}
+	}
+
+	return defaultOptions
+}
+
+// SetAuthorOptions sets the options given for the author given, as used for responses to the request
+// being handled in the channel given, and for output in any sessions owned by the author.
+func (n *Inform) setAuthorOptions(channel, authorID string, o Options) {
+	var owned []*Session
+
+	n.mu.Lock()
+	n.options[channel] = o
+	for _, sess := range n.sessions {
+		if sess.owner == authorID {
+			owned = append(owned, sess)
+		}
+	}
+	n.mu.Unlock()
+
+	// Session options are changed with both locks held, as these are read holding either.
+	for _, sess := range owned {
+		if sess.lock() {
+			n.mu.Lock()
+			sess.options = o
+			n.mu.Unlock()
+			sess.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package inform
+
+import (
+	// Standard library
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+)
+
+// SayOutput sends output produced by the session given to the channel given, formatted in the output
+// style set by the session owner, and preceded by the status line, if requested. Styled output is
+// rendered by the adapter, where supported. The status line shown by adapters is updated regardless.
+func (n *Inform) sayOutput(channel string, sess *Session, out string) {
+	var opts, render = sess.options, styling.Text
+	if a, ok := n.bot.Adapter.(StyleAwareAdapter); ok {
+		render = a.RenderStyles
+	}
+
+	if out = formatOutput(opts.Output, render, out); opts.StatusLine {
+		if status := n.showStatus(channel, sess); status != "" {
+			out = status + "\n\n" + strings.TrimLeft(out, "\n")
+		}
+	}
+
+	n.bot.Say(channel, out)
+	n.updateStatus(sess)
+}
+
+// FormatOutput returns the story output given, formatted in the output style given, and rendered
+// with the function given for styled output. Any style marks in the output are removed for other
+// output styles, and unknown styles return the output with style marks removed.
+func formatOutput(style string, render func(spans []styling.Span) string, out string) string {
+	if strings.TrimSpace(stripStyles(out)) == "" {
+		return stripStyles(out)
+	}
+
+	switch style {
+	case OutputMonospace:
+		return "```\n" + strings.Trim(stripStyles(out), "\n") + "\n```"
+	case OutputStyled:
+		// Output produced without styles has any lines that look like headings styled as such.
+		if !hasStyles(out) {
+			out = markHeadings(out)
+		}
+		return render(parseSpans(out))
+	}
+
+	return stripStyles(out)
+}
+
+// MarkHeadings returns the story output given, with lines that look like headings, and that start
+// a paragraph, marked as headings.
+func markHeadings(out string) string {
+	var lines = strings.Split(out, "\n")
+	for i, line := range lines {
+		if (i == 0 || strings.TrimSpace(lines[i-1]) == "") && isHeading(line) {
+			lines[i] = styleMark(styling.Header) + line + styleMark(styling.Normal)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Maximum length for lines considered to be headings, e.g. room names or story titles.
+const maxHeadingLength = 50
+
+// IsHeading returns whether or not the line given looks like a heading, i.e. is short, starts with an
+// upper-case letter, and does not end like a sentence does.
+func isHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || utf8.RuneCountInString(line) > maxHeadingLength {
+		return false
+	} else if r, _ := utf8.DecodeRuneInString(line); !unicode.IsUpper(r) {
+		return false
+	} else if r, _ := utf8.DecodeLastRuneInString(line); strings.ContainsRune(".,;:!?\"')]>*", r) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,127 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Problem represents a single issue reported by the Inform 7 or Inform 6 compilers during story
+// compilation.
+type Problem struct {
+	Line    int    // The line number in the story source this problem refers to, or 0 if unknown.
+	Message string // The problem description, as reported by the compiler.
+	Excerpt string // The line of story source this problem refers to, if any.
+}
+
+// CompileLog represents the outcome of the last compilation for a story, as well as any output and
+// problems reported by the compilers.
+type CompileLog struct {
+	CreatedAt time.Time // The UTC timestamp compilation was attempted on.
+	Success   bool      // Whether or not compilation produced a story file.
+	Output    string    // The combined output for all compiler invocations.
+	Problems  []Problem // Problems parsed from compiler output.
+}
+
+var (
+	// Matches source references in the Problems report, e.g. 'source:story.ni#line12'.
+	problemLinePattern = regexp.MustCompile(`source:[^"#]*#line(\d+)`)
+	// Matches source references in compiler output, e.g. '(source text, line 12)'.
+	problemOutputPattern = regexp.MustCompile(`\(source text, line (\d+)\)`)
+	// Matches errors in Inform 6 output, e.g. '"auto.inf", line 12: Error: ...'.
+	problemInform6Pattern = regexp.MustCompile(`(?m)^.*line \d+: (?:Fatal error|Error):\s*(.+)$`)
+	// Matches HTML tags, for stripping from problem descriptions.
+	problemTagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// ParseProblemsReport returns problems listed in the 'Problems.html' report produced by the Inform
+// 7 compiler in the project 'Build' directory. Any source lines referenced are matched against the
+// source given.
+func parseProblemsReport(report, source []byte) []Problem {
+	var problems []Problem
+	for _, p := range bytes.Split(report, []byte("<p")) {
+		if !bytes.Contains(p, []byte("Problem")) {
+			continue
+		}
+
+		var line int
+		if m := problemLinePattern.FindSubmatch(p); m != nil {
+			line, _ = strconv.Atoi(string(m[1]))
+		}
+
+		// Strip any trailing content not part of the paragraph itself.
+		if i := bytes.Index(p, []byte("</p>")); i >= 0 {
+			p = p[:i]
+		}
+		if i := bytes.IndexByte(p, '>'); i >= 0 {
+			p = p[i+1:]
+		}
+
+		var msg = problemText(string(problemTagPattern.ReplaceAll(p, nil)))
+		if msg == "" {
+			continue
+		}
+
+		problems = append(problems, Problem{
+			Line:    line,
+			Message: msg,
+			Excerpt: sourceLine(source, line),
+		})
+	}
+
+	return problems
+}
+
+// ParseProblemsOutput returns problems reported in the textual output of the Inform 7 and Inform 6
+// compilers, which is used as a fallback where no Problems report has been produced.
+func parseProblemsOutput(output, source []byte) []Problem {
+	var problems []Problem
+	for _, p := range bytes.Split(output, []byte("\n\n")) {
+		if !bytes.Contains(p, []byte(">-->")) {
+			continue
+		}
+
+		var line int
+		if m := problemOutputPattern.FindSubmatch(p); m != nil {
+			line, _ = strconv.Atoi(string(m[1]))
+		}
+
+		problems = append(problems, Problem{
+			Line:    line,
+			Message: problemText(string(p)),
+			Excerpt: sourceLine(source, line),
+		})
+	}
+
+	for _, m := range problemInform6Pattern.FindAllSubmatch(output, -1) {
+		problems = append(problems, Problem{Message: problemText(string(m[1]))})
+	}
+
+	return problems
+}
+
+// ProblemText normalizes the given problem description, unescaping any HTML entities and collapsing
+// white-space.
+func problemText(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	s = strings.ReplaceAll(s, " :", ":")
+	for _, p := range []string{">-->", "Problem."} {
+		s = strings.TrimSpace(strings.TrimPrefix(s, p))
+	}
+	return s
+}
+
+// SourceLine returns the line of source given, starting at 1, or an empty string if the line does not
+// exist.
+func sourceLine(source []byte, line int) string {
+	var lines = bytes.Split(source, []byte{'\n'})
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	return string(bytes.TrimSpace(lines[line-1]))
+}
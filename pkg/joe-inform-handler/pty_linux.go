@@ -0,0 +1,73 @@
+//go:build linux
+
+package inform
+
+import (
+	// Standard library
+	"os"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// OpenPTY allocates a new pseudo-terminal pair, returning the controlling (master) and terminal
+// (slave) ends. The terminal end has input echo and output post-processing disabled, so that input
+// written is not repeated in output read.
+func openPTY() (*os.File, *os.File, error) {
+	ptm, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "opening pseudo-terminal failed")
+	}
+
+	var num, unlock uint32
+	if err = ioctl(ptm.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&num))); err != nil {
+		ptm.Close()
+		return nil, nil, errors.Wrap(err, "opening pseudo-terminal failed")
+	} else if err = ioctl(ptm.Fd(), syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		ptm.Close()
+		return nil, nil, errors.Wrap(err, "unlocking pseudo-terminal failed")
+	}
+
+	pts, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(num)), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptm.Close()
+		return nil, nil, errors.Wrap(err, "opening pseudo-terminal failed")
+	}
+
+	var attr syscall.Termios
+	if err = ioctl(pts.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&attr))); err == nil {
+		attr.Lflag &^= syscall.ECHO | syscall.ECHONL
+		attr.Oflag &^= syscall.OPOST
+		err = ioctl(pts.Fd(), syscall.TCSETS, uintptr(unsafe.Pointer(&attr)))
+	}
+
+	if err != nil {
+		ptm.Close()
+		pts.Close()
+		return nil, nil, errors.Wrap(err, "setting pseudo-terminal attributes failed")
+	}
+
+	return ptm, pts, nil
+}
+
+// SetControllingTerminal sets the process attributes given to start the process in a new session,
+// with its standard input as its controlling terminal.
+func setControllingTerminal(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	if attr == nil {
+		attr = &syscall.SysProcAttr{}
+	}
+
+	attr.Setsid, attr.Setctty, attr.Ctty = true, true, 0
+	return attr
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+
+	return nil
+}
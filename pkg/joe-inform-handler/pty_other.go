@@ -0,0 +1,22 @@
+//go:build !linux
+
+package inform
+
+import (
+	// Standard library
+	"os"
+	"syscall"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// OpenPTY is not supported on this platform, and always returns an error.
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pseudo-terminals are not supported on this platform")
+}
+
+// SetControllingTerminal returns the process attributes given unchanged.
+func setControllingTerminal(attr *syscall.SysProcAttr) *syscall.SysProcAttr {
+	return attr
+}
@@ -0,0 +1,159 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Default values for the compile queue, used where no explicit values are set in configuration.
+const (
+	defaultCompileWorkers   = 2
+	defaultCompileQueueSize = 32
+	defaultCompileTimeout   = 5 * time.Minute
+)
+
+// CompileJob represents a story queued for compilation.
+type compileJob struct {
+	story      *Story       // A copy of the story, as it was when queued.
+	extensions []*Extension // The extensions available to the story.
+	channel    string       // The channel progress is reported to.
+	done       string       // The message sent when compilation succeeds.
+	options    Options      // The options for the author, as used in all messages sent for the job.
+	running    bool         // Whether or not the job has been picked up by a worker.
+
+	ctx    context.Context    // The context compilation is run under.
+	cancel context.CancelFunc // Cancels compilation, whether queued or running.
+}
+
+// CompileQueue represents stories waiting to be compiled, and those currently being compiled, by a
+// fixed number of workers.
+type compileQueue struct {
+	jobs   chan *compileJob
+	active map[string]*compileJob // Jobs queued or running, against their story references.
+	busy   int                    // The number of workers currently compiling stories.
+	mu     sync.Mutex             // The lock protecting concurrent access to active jobs.
+}
+
+// CancelCompile cancels any compilation queued or running for the story given, returning an error if
+// none was found.
+func (n *Inform) CancelCompile(story *Story) error {
+	var q = n.compiles
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job := q.active[story.Ref()]
+	if job == nil {
+		return errors.New("story '" + story.Name + "' is not being compiled")
+	}
+
+	delete(q.active, story.Ref())
+	job.cancel()
+
+	return nil
+}
+
+// CompileWorker compiles queued stories until the bot is shut down.
+func (n *Inform) compileWorker() {
+	var q = n.compiles
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case job := <-q.jobs:
+			q.mu.Lock()
+			if job.ctx.Err() != nil {
+				q.mu.Unlock()
+				continue
+			}
+			job.running, q.busy = true, q.busy+1
+			q.mu.Unlock()
+
+			n.compile(job)
+
+			q.mu.Lock()
+			if q.busy--; q.active[job.story.Ref()] == job {
+				delete(q.active, job.story.Ref())
+			}
+			q.mu.Unlock()
+
+			job.cancel()
+		}
+	}
+}
+
+// Compile runs compilation for the job given, and stores the result against the story, as long as
+// the story has not changed since being queued.
+func (n *Inform) compile(job *compileJob) {
+	var name = job.story.Name
+	if job.options.Status {
+		n.sayWith(job.options, job.channel, messageCompiling, name)
+	}
+
+	// Compilation is cancelled when superseded, when requested with 'story cancel', or on shutdown,
+	// none of which are reported here.
+	ctx, cancel := context.WithTimeout(job.ctx, n.config.CompileTimeout)
+	defer cancel()
+
+	err := n.compileCached(ctx, job.story, job.extensions)
+	if job.ctx.Err() != nil {
+		return
+	} else if ctx.Err() == context.DeadlineExceeded {
+		n.sayWith(job.options, job.channel, messageCompileTimeout, name, n.config.CompileTimeout)
+		return
+	} else if err != nil && job.story.Log == nil {
+		n.bot.Logger.Error("Compiling story failed", zap.String("story", job.story.Ref()), zap.Error(err))
+		n.sayWith(job.options, job.channel, messageUnknownError)
+		return
+	}
+
+	n.dataMu.Lock()
+	defer n.dataMu.Unlock()
+
+	// Reload the story, as it may have changed or been removed since compilation was queued.
+	author, err := n.loadAuthor(job.story.AuthorID)
+	if err != nil {
+		n.bot.Logger.Error("Storing compiled story failed", zap.String("story", job.story.Ref()), zap.Error(err))
+		n.sayWith(job.options, job.channel, messageUnknownError)
+		return
+	}
+
+	story, err := author.GetStory(name)
+	if err != nil || !bytes.Equal(story.Source, job.story.Source) || story.Format != job.story.Format {
+		return
+	}
+
+	// Stories that fail to compile retain their previous build, if any.
+	if story.Log = job.story.Log; story.Log.Success {
+		story.Build, story.BuildFormat, story.UpdatedAt = job.story.Build, job.story.BuildFormat, job.story.UpdatedAt
+	}
+	if r := story.Current(); r != nil && r.SourceRef == blob.Key(story.Source) {
+		r.Compiled, r.Success, r.Problems = true, story.Log.Success, len(story.Log.Problems)
+	}
+
+	if err := n.storeAuthor(author); err != nil {
+		n.bot.Logger.Error("Storing compiled story failed", zap.String("story", story.Ref()), zap.Error(err))
+		n.sayWith(job.options, job.channel, messageUnknownError)
+	} else if !story.Log.Success {
+		_ = n.sayTemplateWith(job.options, job.channel, templateCompileProblems, compileReport{Story: story, Limit: job.options.Problems})
+	} else {
+		n.bot.Say(job.channel, job.done)
+	}
+}
+
+// NewCompileQueue returns an empty compile queue holding up to the number of jobs given.
+func newCompileQueue(size int) *compileQueue {
+	return &compileQueue{
+		jobs:   make(chan *compileJob, size),
+		active: make(map[string]*compileJob),
+	}
+}
@@ -0,0 +1,134 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// The time output needs to remain unchanged after a prompt is detected before the response is
+// considered complete, as prompts may otherwise be matched against partial output.
+const promptSettlePeriod = 20 * time.Millisecond
+
+// Prompts printed by interpreters when waiting for input, matched against the end of any output
+// read. Prompts for line input are removed from responses, while other prompts (such as those for
+// file names) are retained.
+var (
+	linePromptPattern  = regexp.MustCompile(`\n>\s?$`)
+	otherPromptPattern = regexp.MustCompile(`(?i)((file ?name|saved game)[^\n]*: ?|overwrite existing file\? ?|\[hit any key[^\]]*\] ?)$`)
+)
+
+// OutputReader continuously reads output produced by an interpreter, and splits it into complete
+// responses, as delimited by input prompts. Any errors produced by the interpreter are collected
+// alongside.
+type outputReader struct {
+	responses chan []byte // Complete responses, in the order they were produced.
+
+	mu   sync.Mutex // The lock protecting concurrent access to fields below.
+	buf  []byte     // Output read since the last complete response.
+	errs []byte     // Errors read since errors were last taken.
+}
+
+// Flush returns any output read since the last complete response, regardless of whether or not a
+// prompt has been detected.
+func (r *outputReader) flush() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buf = r.buf
+	r.buf = nil
+	return buf
+}
+
+// Errors returns any errors read since errors were last taken.
+func (r *outputReader) errors() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs = r.errs
+	r.errs = nil
+	return errs
+}
+
+// Prompted returns whether or not the output read so far ends in a known prompt.
+func (r *outputReader) prompted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return linePromptPattern.Match(r.buf) || otherPromptPattern.Match(r.buf)
+}
+
+// Run reads chunks of output until the channel given is closed, emitting responses as prompts are
+// detected, and collects chunks of errors from the channel given, if any. Any remaining output is
+// emitted as a final response, once all remaining errors have been collected.
+func (r *outputReader) run(chunks, errs <-chan []byte) {
+	var settled <-chan time.Time
+	for {
+		select {
+		case chunk, ok := <-chunks:
+			if !ok {
+				if errs != nil {
+					for chunk := range errs {
+						r.addErrors(chunk)
+					}
+				}
+				if buf := r.flush(); len(buf) > 0 {
+					r.responses <- buf
+				}
+				close(r.responses)
+				return
+			}
+
+			// Normalize line endings, as produced by interpreters running under a terminal.
+			chunk = bytes.ReplaceAll(chunk, []byte{'\r', '\n'}, []byte{'\n'})
+
+			r.mu.Lock()
+			r.buf = append(r.buf, chunk...)
+			r.mu.Unlock()
+
+			settled = nil
+			if r.prompted() {
+				settled = time.After(promptSettlePeriod)
+			}
+		case chunk, ok := <-errs:
+			if !ok {
+				errs = nil // Stop selecting on closed channel.
+				continue
+			}
+			r.addErrors(chunk)
+		case <-settled:
+			settled = nil
+			if buf := r.flush(); len(buf) > 0 {
+				r.responses <- buf
+			}
+		}
+	}
+}
+
+// AddErrors adds the chunk of errors given to any errors collected so far.
+func (r *outputReader) addErrors(chunk []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, chunk...)
+}
+
+// NewOutputReader returns an outputReader for the given interpreter output and errors, if any, and
+// starts reading from these in the background.
+func newOutputReader(out, errs io.Reader) *outputReader {
+	var r = &outputReader{responses: make(chan []byte, 16)}
+
+	var errChunks <-chan []byte
+	if errs != nil {
+		errChunks = readChunks(errs)
+	}
+
+	go r.run(readChunks(out), errChunks)
+	return r
+}
+
+// TrimPrompt returns the response given with any trailing line input prompt removed.
+func trimPrompt(buf []byte) []byte {
+	return linePromptPattern.ReplaceAll(buf, nil)
+}
@@ -0,0 +1,118 @@
+package inform
+
+import (
+	// Standard library
+	"time"
+
+	// Third-party packages
+	"go.uber.org/zap"
+)
+
+// Default values for session lifetimes, used where no explicit values are set in configuration.
+const (
+	defaultSessionIdleTimeout = time.Hour
+	defaultSessionMaxLifetime = 24 * time.Hour
+	defaultSessionWarning     = 5 * time.Minute
+
+	// The interval at which sessions are checked for expiry.
+	sessionReapInterval = 30 * time.Second
+)
+
+// The save slot used when saving sessions before they expire.
+const sessionAutosaveSlot = "autosave"
+
+// Deadline returns the time the given session expires on, according to configured session lifetimes,
+// or a zero time if the session never expires.
+func (n *Inform) deadline(sess *Session) time.Time {
+	var deadline time.Time
+	if n.config.SessionIdleTimeout > 0 {
+		deadline = sess.activeAt.Add(n.config.SessionIdleTimeout)
+	}
+	if n.config.SessionMaxLifetime > 0 {
+		if d := sess.startedAt.Add(n.config.SessionMaxLifetime); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+
+	return deadline
+}
+
+// Reap ends all sessions that have expired, and warns participants for sessions about to expire. If
+// enabled, sessions are saved before being ended, and can be restored in future sessions. Sessions
+// left idle with commands given since their last checkpoint save have their state saved.
+func (n *Inform) reap(now time.Time) {
+	// Sessions are checked holding their own lock alone, so that sessions running commands hold up
+	// neither other sessions nor requests.
+	n.mu.Lock()
+	var sessions = make([]*Session, 0, len(n.sessions))
+	for _, sess := range n.sessions {
+		sessions = append(sessions, sess)
+	}
+	n.mu.Unlock()
+
+	for _, sess := range sessions {
+		if sess.lock() {
+			n.reapSession(sess, now)
+			sess.mu.Unlock()
+		}
+	}
+}
+
+// ReapSession ends the session given if expired, as described for reap. Callers are expected to hold
+// the lock for the session.
+func (n *Inform) reapSession(sess *Session, now time.Time) {
+	if len(sess.log) > 0 && !sess.halted() && now.Sub(sess.activeAt) >= checkpointIdleInterval {
+		if err := n.SaveCheckpoint(sess); err != nil {
+			n.bot.Logger.Warn("Storing checkpoint failed", zap.Error(err))
+		}
+	}
+
+	var deadline = n.deadline(sess)
+	if deadline.IsZero() {
+		return
+	} else if now.Before(deadline) {
+		if !sess.warned && n.config.SessionWarning > 0 && !now.Before(deadline.Add(-n.config.SessionWarning)) {
+			n.Say(sess.notify, messageExpiringSession, sess.story.Name, deadline.Sub(now).Round(time.Minute))
+			sess.warned = true
+		}
+		return
+	}
+
+	var saved bool
+	if n.config.SessionAutosave {
+		if save, err := NewSave(sess.owner, sess.saveStory(), sessionAutosaveSlot, nil); err != nil {
+			n.bot.Logger.Warn("Saving expired session failed", zap.Error(err))
+		} else if save.Data, err = sess.Save(); err != nil {
+			n.bot.Logger.Warn("Saving expired session failed", zap.Error(err))
+		} else if err = storeSave(n.bot.Store, save); err != nil {
+			n.bot.Logger.Warn("Saving expired session failed", zap.Error(err))
+		} else {
+			saved = true
+		}
+	}
+
+	if err := n.EndSession(sess); err != nil {
+		n.bot.Logger.Error("Ending expired session failed", zap.Error(err))
+	}
+
+	if saved {
+		n.Say(sess.notify, messageExpiredSessionSaved, sess.story.Name, sessionAutosaveSlot)
+	} else {
+		n.Say(sess.notify, messageExpiredSession, sess.story.Name)
+	}
+}
+
+// Reaper periodically ends expired sessions, until the bot is shut down.
+func (n *Inform) reaper() {
+	var ticker = time.NewTicker(sessionReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.reap(now)
+		}
+	}
+}
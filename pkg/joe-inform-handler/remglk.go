@@ -0,0 +1,408 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+	"go.deuill.org/informbot/pkg/sandbox"
+)
+
+// Default dimensions for the screen presented to stories run with RemGlkInterpreter, in characters.
+const (
+	defaultRemGlkWidth  = 80
+	defaultRemGlkHeight = 24
+)
+
+// Default arguments for interpreter executables built against RemGlk.
+var defaultRemGlkArgs = []string{argStory}
+
+// RemGlkInterpreter runs stories with an external interpreter built against RemGlk, such as 'glulxe',
+// communicating with it in the JSON protocol defined by GlkOte over standard input and output. Unlike
+// CommandInterpreter, text styles are kept in story output, and the status line is kept apart from
+// other output, as shown in any grid window opened by the story.
+type RemGlkInterpreter struct {
+	Path   string   // The path to the interpreter executable.
+	Args   []string // The arguments given, where '{dir}' and '{story}' placeholders are replaced.
+	Width  int      // The width of the screen presented to stories, in characters.
+	Height int      // The height of the screen presented to stories, in characters.
+}
+
+// NewRemGlkInterpreter returns an Interpreter using the executable at the path given, as built
+// against RemGlk.
+func NewRemGlkInterpreter(path string) *RemGlkInterpreter {
+	return &RemGlkInterpreter{Path: path, Args: defaultRemGlkArgs}
+}
+
+// Start runs the story file given with the configured interpreter executable, and sends the initial
+// event expected by RemGlk, describing the screen presented to the story.
+func (r *RemGlkInterpreter) Start(ctx context.Context, policy sandbox.Policy, dir, story string) (Process, error) {
+	proc, err := (&CommandInterpreter{Path: r.Path, Args: r.Args}).Start(ctx, policy, dir, story)
+	if err != nil {
+		return nil, err
+	}
+
+	var width, height = r.Width, r.Height
+	if width <= 0 {
+		width = defaultRemGlkWidth
+	}
+	if height <= 0 {
+		height = defaultRemGlkHeight
+	}
+
+	var out, w = io.Pipe()
+	var p = &remglkProcess{
+		Process: proc,
+		out:     out,
+		w:       w,
+		windows: make(map[int]string),
+		grids:   make(map[int][]string),
+	}
+
+	err = p.send(remglkEvent{
+		Type:    "init",
+		Metrics: &remglkMetrics{Width: width, Height: height, CharWidth: 1, CharHeight: 1},
+	})
+	if err != nil {
+		proc.Close()
+		return nil, err
+	}
+
+	go p.run(proc.Output())
+	return p, nil
+}
+
+// RemGlkEvent represents input sent to RemGlk, either for initializing the story, or as a response to
+// a request for input.
+type remglkEvent struct {
+	Type     string         `json:"type"`
+	Gen      int            `json:"gen"`
+	Window   int            `json:"window,omitempty"`
+	Value    string         `json:"value,omitempty"`
+	Response string         `json:"response,omitempty"`
+	Metrics  *remglkMetrics `json:"metrics,omitempty"`
+}
+
+// RemGlkMetrics represents the dimensions of the screen presented to stories, as sent on startup.
+type remglkMetrics struct {
+	Width      int `json:"width"`
+	Height     int `json:"height"`
+	CharWidth  int `json:"charwidth"`
+	CharHeight int `json:"charheight"`
+}
+
+// RemGlkUpdate represents output produced by RemGlk, as a set of changes to windows open, their
+// content, and any requests for input.
+type remglkUpdate struct {
+	Type         string              `json:"type"`
+	Gen          int                 `json:"gen"`
+	Message      string              `json:"message"` // The error message, for updates of type 'error'.
+	Windows      []remglkWindow      `json:"windows"`
+	Content      []remglkContent     `json:"content"`
+	Input        []remglkInput       `json:"input"`
+	SpecialInput *remglkSpecialInput `json:"specialinput"`
+	Exit         bool                `json:"exit"`
+}
+
+// RemGlkWindow represents a window open, as listed in full whenever windows change.
+type remglkWindow struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"` // One of 'buffer', 'grid', 'graphics', or 'pair'.
+}
+
+// RemGlkContent represents changes to the content of a window, either as paragraphs added to buffer
+// windows, or as lines replaced in grid windows.
+type remglkContent struct {
+	ID    int  `json:"id"`
+	Clear bool `json:"clear"`
+	Text  []struct {
+		Append  bool        `json:"append"`
+		Content remglkSpans `json:"content"`
+	} `json:"text"`
+	Lines []struct {
+		Line    int         `json:"line"`
+		Content remglkSpans `json:"content"`
+	} `json:"lines"`
+}
+
+// RemGlkInput represents a request for line or character input in a window.
+type remglkInput struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"` // One of 'line' or 'char'.
+}
+
+// RemGlkSpecialInput represents a request for input not tied to a window, e.g. for file names.
+type remglkSpecialInput struct {
+	Type     string `json:"type"`
+	FileMode string `json:"filemode"`
+	FileType string `json:"filetype"`
+}
+
+// RemGlkSpans represents styled text, as given in either of the forms used by RemGlk, i.e. as a list
+// of objects with style and text fields, or as a flat list of alternating style names and text.
+type remglkSpans []styling.Span
+
+// UnmarshalJSON decodes styled text given in either of the forms used by RemGlk.
+func (s *remglkSpans) UnmarshalJSON(data []byte) error {
+	var spans []struct {
+		Style string `json:"style"`
+		Text  string `json:"text"`
+	}
+
+	if err := json.Unmarshal(data, &spans); err == nil {
+		for _, span := range spans {
+			*s = append(*s, styling.Span{Style: span.Style, Text: span.Text})
+		}
+		return nil
+	}
+
+	var pairs []string
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		*s = append(*s, styling.Span{Style: pairs[i], Text: pairs[i+1]})
+	}
+
+	return nil
+}
+
+// RemGlkProcess represents a story running under an interpreter built against RemGlk, translating
+// between the JSON protocol spoken by RemGlk and the line-based input and output expected of a
+// Process. Text styles are marked in output, and prompts are added for any requests for input.
+type remglkProcess struct {
+	Process // The underlying interpreter process, speaking the RemGlk protocol.
+
+	out *io.PipeReader // The reader story output is read from.
+	w   *io.PipeWriter // The writer story output is translated into.
+
+	mu      sync.Mutex       // The lock protecting concurrent access to fields below.
+	gen     int              // The generation number for the last update received.
+	windows map[int]string   // The types of windows open, against their IDs.
+	grids   map[int][]string // The lines of text shown in grid windows, against their IDs.
+	input   *remglkInput     // The request for input in a window, if any.
+	special bool             // Whether or not a file name has been requested.
+	queued  []string         // Lines of input given while no input was requested.
+	partial []byte           // Input written with no terminating new-line.
+	started bool             // Whether or not any text was written since the last prompt.
+	last    string           // The last line of text written since the last prompt.
+}
+
+// Write sends each line of input given as a response to the request for input currently pending, or
+// queues the line until input is requested.
+func (p *remglkProcess) Write(buf []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.partial = append(p.partial, buf...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		p.queued = append(p.queued, strings.TrimRight(string(p.partial[:i]), "\r"))
+		p.partial = p.partial[i+1:]
+	}
+
+	if err := p.respond(); err != nil {
+		return 0, err
+	}
+
+	return len(buf), nil
+}
+
+// Respond sends the first line of input queued as a response to the request for input pending, if
+// any. Requests for input are only responded to once.
+func (p *remglkProcess) respond() error {
+	if len(p.queued) == 0 || (p.input == nil && !p.special) {
+		return nil
+	}
+
+	var line, ev = p.queued[0], remglkEvent{Gen: p.gen}
+	p.queued = p.queued[1:]
+
+	switch {
+	case p.special:
+		ev.Type, ev.Response, ev.Value = "specialresponse", "fileref_prompt", line
+	case p.input.Type == "char":
+		ev.Type, ev.Window, ev.Value = "char", p.input.ID, "return"
+		if r, _ := utf8.DecodeRuneInString(line); line != "" {
+			ev.Value = string(r)
+		}
+	default:
+		ev.Type, ev.Window, ev.Value = "line", p.input.ID, line
+	}
+
+	p.input, p.special = nil, false
+	return p.send(ev)
+}
+
+// Send writes the event given to the interpreter.
+func (p *remglkProcess) send(ev remglkEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Process.Write(append(buf, '\n'))
+	return err
+}
+
+func (p *remglkProcess) Output() io.Reader {
+	return p.out
+}
+
+// Status returns the status line, as shown in the first grid window opened by the story, if any.
+func (p *remglkProcess) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var ids []int
+	for id := range p.grids {
+		ids = append(ids, id)
+	}
+
+	if len(ids) == 0 {
+		return Status{}
+	}
+
+	sort.Ints(ids)
+
+	var lines []string
+	for _, l := range p.grids[ids[0]] {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+
+	st, _ := parseStatus(strings.Join(lines, "\n"))
+	return st
+}
+
+// Close stops the interpreter process, and closes the reader story output is read from.
+func (p *remglkProcess) Close() error {
+	err := p.Process.Close()
+	p.w.Close()
+	return err
+}
+
+// Run decodes updates read from the interpreter output given, until the interpreter exits, writing
+// text and prompts for each update to the reader returned by Output.
+func (p *remglkProcess) run(r io.Reader) {
+	defer p.w.Close()
+
+	var dec = json.NewDecoder(r)
+	for {
+		var u remglkUpdate
+		if err := dec.Decode(&u); err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Fprintf(p.w, "\n[Fatal error: %s]\n", err)
+			return
+		} else if u.Type == "error" {
+			fmt.Fprintf(p.w, "\n[Fatal error: %s]\n", u.Message)
+			return
+		}
+
+		if _, err := io.WriteString(p.w, p.update(&u)); err != nil || u.Exit {
+			return
+		}
+	}
+}
+
+// Update applies the update given, and returns any text produced, along with a prompt for any
+// request for input.
+func (p *remglkProcess) update(u *remglkUpdate) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.gen = u.Gen
+	if u.Windows != nil {
+		p.windows = make(map[int]string, len(u.Windows))
+		for _, w := range u.Windows {
+			p.windows[w.ID] = w.Type
+		}
+		for id := range p.grids {
+			if p.windows[id] != "grid" {
+				delete(p.grids, id)
+			}
+		}
+	}
+
+	var buf strings.Builder
+	for _, c := range u.Content {
+		switch p.windows[c.ID] {
+		case "grid":
+			if c.Clear {
+				p.grids[c.ID] = nil
+			}
+			for _, l := range c.Lines {
+				for len(p.grids[c.ID]) <= l.Line {
+					p.grids[c.ID] = append(p.grids[c.ID], "")
+				}
+				p.grids[c.ID][l.Line] = styling.Text(l.Content)
+			}
+		case "buffer":
+			for _, par := range c.Text {
+				if !par.Append {
+					if p.started {
+						buf.WriteString("\n")
+					}
+					p.started, p.last = true, ""
+				}
+				for _, s := range par.Content {
+					// Line input is echoed by RemGlk, but is otherwise left out of output.
+					if par.Append && s.Style == styling.Input {
+						continue
+					} else if s.Style == styling.Normal || s.Style == "" {
+						buf.WriteString(s.Text)
+					} else {
+						buf.WriteString(styleMark(s.Style) + s.Text + styleMark(styling.Normal))
+					}
+					p.started, p.last = true, p.last+s.Text
+				}
+			}
+		}
+	}
+
+	p.input, p.special = nil, false
+	if len(u.Input) > 0 {
+		p.input = &u.Input[0]
+	}
+
+	// Prompts are added for requests for input, as expected by the outputReader, and replace any
+	// prompt for line input printed by the story itself.
+	var out = buf.String()
+	switch {
+	case u.SpecialInput != nil && u.SpecialInput.Type == "fileref_prompt":
+		p.special = true
+		out += "\nFile name: "
+	case p.input != nil && p.input.Type == "char":
+		out += "\n[hit any key]"
+	case p.input != nil:
+		if i := strings.LastIndex(out, ">"); i >= 0 && strings.TrimSpace(p.last) == ">" {
+			out = strings.TrimRight(out[:i], "\n")
+		}
+		out += "\n>"
+	}
+
+	if p.input != nil || p.special {
+		p.started, p.last = false, ""
+		if err := p.respond(); err != nil {
+			out += fmt.Sprintf("\n[Fatal error: %s]\n", err)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,132 @@
+package inform
+
+import (
+	// Standard library
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+)
+
+func TestRemGlkSpansUnmarshalJSON(t *testing.T) {
+	var tests = []struct {
+		name    string
+		data    string
+		want    remglkSpans
+		wantErr bool
+	}{
+		{"objects", `[{"style":"header","text":"Kitchen"},{"style":"normal","text":" A room."}]`,
+			remglkSpans{{Style: styling.Header, Text: "Kitchen"}, {Style: styling.Normal, Text: " A room."}}, false},
+		{"pairs", `["header","Kitchen","normal"," A room."]`,
+			remglkSpans{{Style: styling.Header, Text: "Kitchen"}, {Style: styling.Normal, Text: " A room."}}, false},
+		{"odd pairs", `["header","Kitchen","normal"]`, remglkSpans{{Style: styling.Header, Text: "Kitchen"}}, false},
+		{"empty", `[]`, nil, false},
+		{"invalid", `[1, 2]`, nil, true},
+		{"not a list", `"text"`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got remglkSpans
+			if err := json.Unmarshal([]byte(tt.data), &got); (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, want error %v", tt.data, err, tt.wantErr)
+			} else if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal(%s) = %+v, want %+v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+// NewTestRemGlkProcess returns a remglkProcess with no running interpreter, for applying updates to.
+func newTestRemGlkProcess() *remglkProcess {
+	return &remglkProcess{
+		Process: &testProcess{},
+		windows: make(map[int]string),
+		grids:   make(map[int][]string),
+	}
+}
+
+// DecodeUpdate returns the RemGlk update given, as decoded from JSON.
+func decodeUpdate(t *testing.T, data string) *remglkUpdate {
+	t.Helper()
+	var u remglkUpdate
+	if err := json.Unmarshal([]byte(data), &u); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	return &u
+}
+
+func TestRemGlkUpdate(t *testing.T) {
+	var tests = []struct {
+		name    string
+		updates []string
+		want    string
+		status  string
+		special bool
+	}{
+		{"buffer and grid", []string{`{"type":"update","gen":1,
+			"windows":[{"id":1,"type":"grid"},{"id":2,"type":"buffer"}],
+			"content":[
+				{"id":1,"lines":[{"line":0,"content":[{"style":"normal","text":" Kitchen                    0/1"}]}]},
+				{"id":2,"text":[
+					{"content":[{"style":"header","text":"Kitchen"}]},
+					{"content":[{"style":"normal","text":"A "},{"style":"emphasized","text":"small"},{"style":"normal","text":" room."}]},
+					{"content":[{"style":"normal","text":">"}]}
+				]}
+			],
+			"input":[{"id":2,"type":"line"}]}`},
+			"\x1b[header]Kitchen\x1b[]\nA \x1b[emphasized]small\x1b[] room.\n>", "Kitchen", false},
+		{"pair content", []string{`{"type":"update","gen":1,
+			"windows":[{"id":2,"type":"buffer"}],
+			"content":[{"id":2,"text":[{"content":["normal","Hello ","alert","there"]}]}],
+			"input":[{"id":2,"type":"line"}]}`},
+			"Hello \x1b[alert]there\x1b[]\n>", "", false},
+		{"echoed input", []string{`{"type":"update","gen":2,
+			"windows":[{"id":2,"type":"buffer"}],
+			"content":[{"id":2,"text":[
+				{"append":true,"content":[{"style":"input","text":"look"}]},
+				{"content":[{"style":"normal","text":"Nothing here."}]}
+			]}],
+			"input":[{"id":2,"type":"line"}]}`},
+			"Nothing here.\n>", "", false},
+		{"grid cleared", []string{`{"type":"update","gen":1,
+			"windows":[{"id":1,"type":"grid"}],
+			"content":[{"id":1,"lines":[{"line":1,"content":[{"style":"normal","text":" Cellar                    3/4"}]}]}]}`, `{"type":"update","gen":2,
+			"content":[{"id":1,"clear":true,"lines":[{"line":0,"content":[{"style":"normal","text":" Attic                    4/5"}]}]}]}`},
+			"", "Attic", false},
+		{"char input", []string{`{"type":"update","gen":1,
+			"windows":[{"id":2,"type":"buffer"}],
+			"content":[{"id":2,"text":[{"content":[{"style":"normal","text":"Press any key."}]}]}],
+			"input":[{"id":2,"type":"char"}]}`},
+			"Press any key.\n[hit any key]", "", false},
+		{"special input", []string{`{"type":"update","gen":1,
+			"windows":[{"id":2,"type":"buffer"}],
+			"specialinput":{"type":"fileref_prompt","filemode":"write","filetype":"save"}}`},
+			"\nFile name: ", "", true},
+		{"prompt in earlier update", []string{`{"type":"update","gen":1,
+			"windows":[{"id":2,"type":"buffer"}],
+			"content":[{"id":2,"text":[{"content":[{"style":"normal","text":">"}]}]}]}`, `{"type":"update","gen":2,
+			"input":[{"id":2,"type":"line"}]}`},
+			"\n>", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p, got = newTestRemGlkProcess(), ""
+			for _, u := range tt.updates {
+				got = p.update(decodeUpdate(t, u))
+			}
+
+			if got != tt.want {
+				t.Errorf("update() = %q, want %q", got, tt.want)
+			} else if st := p.Status(); st.Location != tt.status {
+				t.Errorf("Status() = %+v, want location %q", st, tt.status)
+			} else if p.special != tt.special {
+				t.Errorf("update() special input = %v, want %v", p.special, tt.special)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Default retention limits for story revisions.
+const (
+	defaultRevisionLimit  = 20                  // The number of revisions kept for each story.
+	defaultRevisionMaxAge = 90 * 24 * time.Hour // The age after which revisions are removed.
+)
+
+// Revision represents a single version of the source for a story, as stored whenever the source for
+// the story changes.
+type Revision struct {
+	Number    int       // The revision number, increasing with every change to the story source.
+	CreatedAt time.Time // The UTC timestamp this revision was created on.
+	Note      string    // A short description of how this revision was created, if any.
+	SourceRef string    // The reference to the story source for this revision, as kept in the blob store.
+	Size      int       // The size of the story source for this revision, in bytes.
+
+	// The story source for this revision, as loaded from the blob store when needed.
+	Source []byte `json:"-"`
+
+	// The story source for revisions stored before the blob store was used.
+	LegacySource []byte `json:"Source,omitempty"`
+
+	// The outcome of the last compilation attempted for this revision, if any.
+	Compiled bool
+	Success  bool
+	Problems int
+}
+
+// Current returns the revision for the current story source, or nil if no revisions are stored.
+func (s *Story) Current() *Revision {
+	if len(s.Revisions) == 0 {
+		return nil
+	}
+
+	return s.Revisions[len(s.Revisions)-1]
+}
+
+// GetRevision returns the revision with the number given.
+func (s *Story) GetRevision(num int) (*Revision, error) {
+	for _, r := range s.Revisions {
+		if r.Number == num {
+			return r, nil
+		}
+	}
+
+	return nil, errors.Errorf("no revision %d found for story '%s'", num, s.Name)
+}
+
+// AddRevision stores the current story source as a new revision, unless it is unchanged from the
+// current revision. Stories added before revisions were kept have their previous source stored as
+// the initial revision, where this is known.
+func (s *Story) addRevision(prev []byte, note string) {
+	var cur, key = s.Current(), blob.Key(s.Source)
+	if cur == nil && len(prev) > 0 && !bytes.Equal(prev, s.Source) {
+		cur = newRevision(1, s.UpdatedAt, "", prev)
+		s.Revisions = append(s.Revisions, cur)
+	}
+
+	if cur != nil && cur.SourceRef == key {
+		return
+	}
+
+	var num = 1
+	if cur != nil {
+		num = cur.Number + 1
+	}
+
+	s.Revisions = append(s.Revisions, newRevision(num, time.Now().UTC(), note, s.Source))
+}
+
+// Rollback sets the story source to that of the revision with the number given, storing the result
+// as a new revision.
+func (s *Story) Rollback(num int) error {
+	r, err := s.GetRevision(num)
+	if err != nil {
+		return err
+	} else if r.SourceRef == blob.Key(s.Source) {
+		return errors.Errorf("revision %d is the same as the current story source", num)
+	}
+
+	src, err := s.revisionSource(r)
+	if err != nil {
+		return err
+	}
+
+	var prev = s.Source
+	s.Source = append([]byte(nil), src...)
+	s.addRevision(prev, "rolled back to revision "+strconv.Itoa(num))
+
+	return nil
+}
+
+// NewRevision returns a revision with the number, creation time, note and source given.
+func newRevision(num int, createdAt time.Time, note string, source []byte) *Revision {
+	return &Revision{
+		Number:    num,
+		CreatedAt: createdAt,
+		Note:      note,
+		SourceRef: blob.Key(source),
+		Size:      len(source),
+		Source:    source,
+	}
+}
+
+// PruneRevisions removes revisions beyond the number of revisions given, or older than the age given,
+// where either limit is positive, and returns whether or not any revisions were removed. The current
+// revision is always kept.
+func (s *Story) pruneRevisions(limit int, maxAge time.Duration, now time.Time) bool {
+	var keep = s.Revisions[:0]
+	for i, r := range s.Revisions {
+		var last = i == len(s.Revisions)-1
+		if !last && limit > 0 && len(s.Revisions)-i > limit {
+			continue
+		} else if !last && maxAge > 0 && now.Sub(r.CreatedAt) > maxAge {
+			continue
+		}
+		keep = append(keep, r)
+	}
+
+	// Clear references to removed revisions, so that their sources can be freed.
+	var pruned = len(keep) < len(s.Revisions)
+	for i := len(keep); i < len(s.Revisions); i++ {
+		s.Revisions[i] = nil
+	}
+
+	s.Revisions = keep
+	return pruned
+}
+
+// ParseRevision parses revision numbers given either as plain numbers, e.g. '12', or with a leading
+// 'r', e.g. 'r12'.
+func parseRevision(rev string) (int, error) {
+	num, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(rev), "r"))
+	if err != nil || num < 1 {
+		return 0, errors.Errorf("'%s' is not a valid revision number", rev)
+	}
+
+	return num, nil
+}
+
+// DiffStory sends the differences between two revisions of the story given to the channel given,
+// where the second revision defaults to the current revision, if not given.
+func (n *Inform) DiffStory(channel string, story *Story, from, to string) error {
+	var revs [2]*Revision
+	for i, rev := range []string{from, to} {
+		if rev == "" {
+			if revs[i] = story.Current(); revs[i] == nil {
+				n.Say(channel, messageInvalidRevision, "story has no revisions")
+				return nil
+			}
+			continue
+		}
+
+		num, err := parseRevision(rev)
+		if err == nil {
+			revs[i], err = story.GetRevision(num)
+		}
+		if err != nil {
+			n.Say(channel, messageInvalidRevision, err)
+			return nil
+		}
+	}
+
+	var old, cur = &Story{}, &Story{}
+	for i, s := range []*Story{old, cur} {
+		src, err := story.revisionSource(revs[i])
+		if err != nil {
+			n.Say(channel, messageUnknownError)
+			return err
+		}
+		s.Source = src
+	}
+
+	var lines, hidden = formatDiff(diffLines(old.lines(), cur.lines()))
+
+	return n.SayTemplate(channel, templateStoryDiff, storyDiff{
+		Story:  story.Name,
+		From:   revs[0].Number,
+		To:     revs[1].Number,
+		Lines:  lines,
+		Hidden: hidden,
+	})
+}
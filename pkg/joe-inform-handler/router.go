@@ -0,0 +1,410 @@
+package inform
+
+import (
+	// Standard library
+	"context"
+	"strings"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+)
+
+// Command represents a meta-command understood by the bot, as declared by its usage, e.g. 'story add
+// <name> [<url>]', where leading words form the command name, and the remainder form its arguments.
+// Arguments are given as one of:
+//
+//	<name>      A required argument, taking a single word or quoted text.
+//	[<name>]    An optional argument, taking a single word or quoted text.
+//	<name...>   A required argument, taking all remaining text as-is, including any new-lines.
+//	[<name...>] An optional argument, taking all remaining text as-is, including any new-lines.
+//	[word]      An optional flag, set when the word is given as-is.
+type command struct {
+	Usage   string   // The command name and arguments, as described above.
+	Aliases []string // Alternative names for the command, e.g. 'stories add'.
+	Summary string   // A short description of the command, as shown in help topics.
+	Help    string   // A longer description of the command and its arguments, if any.
+
+	name    string                              // The command name, as taken from the usage.
+	args    []argument                          // The arguments accepted, as taken from the usage.
+	guest   bool                                // Whether or not guests can give the command.
+	missing *message                            // The message sent for missing arguments, in place of usage.
+	run     func(n *Inform, req *request) error // The function handling the command.
+}
+
+// Name returns the command name, as taken from its usage.
+func (c *command) Name() string {
+	return c.name
+}
+
+// Topic returns the topic the command belongs to, which is the first word of its name.
+func (c *command) Topic() string {
+	return strings.Fields(c.name)[0]
+}
+
+// Summary returns the command summary as a message, for use with translations.
+func (c *command) summary() *message {
+	return &message{name: "command-" + strings.ReplaceAll(c.name, " ", "-") + "-summary", text: c.Summary}
+}
+
+// Help returns the command help text as a message, for use with translations.
+func (c *command) help() *message {
+	return &message{name: "command-" + strings.ReplaceAll(c.name, " ", "-") + "-help", text: c.Help}
+}
+
+// Names returns the command name, followed by any aliases.
+func (c *command) names() []string {
+	return append([]string{c.name}, c.Aliases...)
+}
+
+// Argument represents a single argument accepted by a command, as declared in its usage.
+type argument struct {
+	name     string // The argument name, or the word expected for flags.
+	required bool   // Whether or not the argument needs to be given.
+	rest     bool   // Whether or not the argument takes all remaining text as-is.
+	flag     bool   // Whether or not the argument is a flag, set by giving its name as-is.
+}
+
+// ParseUsage sets the name and arguments for the command from its usage, and panics if the usage is
+// invalid, as commands are declared statically.
+func (c *command) parseUsage() {
+	for _, f := range strings.Fields(c.Usage) {
+		var a = argument{name: f, required: true}
+		if strings.HasPrefix(f, "[") && strings.HasSuffix(f, "]") {
+			a.name, a.required = f[1:len(f)-1], false
+		}
+		if strings.HasPrefix(a.name, "<") && strings.HasSuffix(a.name, ">") {
+			a.name = a.name[1 : len(a.name)-1]
+		} else if !a.required {
+			a.flag = true
+		} else if len(c.args) == 0 {
+			c.name = strings.TrimSpace(c.name + " " + f)
+			continue
+		} else {
+			panic("invalid usage '" + c.Usage + "': words cannot follow arguments")
+		}
+		if a.rest = strings.HasSuffix(a.name, "..."); a.rest {
+			a.name = strings.TrimSuffix(a.name, "...")
+		}
+		c.args = append(c.args, a)
+	}
+
+	if c.name == "" {
+		panic("invalid usage '" + c.Usage + "': no command name given")
+	}
+}
+
+// Request represents a single invocation of a command, along with its arguments.
+type request struct {
+	ctx     context.Context
+	event   joe.ReceiveMessageEvent
+	channel string
+	author  *Author // The author giving the command, with an empty ID for guests.
+	nick    string  // The name the author is known by in the channel, if any.
+	router  *router
+
+	command *command
+	args    map[string]string
+}
+
+// Arg returns the value given for the argument with the name given, or an empty string if none was
+// given. Flags given are set to their own name.
+func (r *request) arg(name string) string {
+	return r.args[name]
+}
+
+// Router represents the set of commands understood by the bot, and dispatches commands given to them.
+type router struct {
+	commands []*command
+	topics   map[string]bool // Words that begin names made up of multiple words, e.g. 'story'.
+}
+
+// Dispatch finds the command for the text given, parses its arguments, and runs the command. Unknown
+// commands are reported along with any similar command found, and invalid arguments are reported
+// along with help for the command, or with the message set for missing arguments. Guests can only
+// give commands that don't act on their own stories or sessions, as their identity is not known.
+func (rt *router) dispatch(n *Inform, req *request, text string) error {
+	var tokens = tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	cmd, consumed := rt.match(tokens)
+	if cmd == nil {
+		return rt.unknown(n, req.channel, tokens)
+	} else if req.author.ID == "" && !cmd.guest {
+		n.Say(req.channel, messageGuestCommand, req.nick)
+		return nil
+	}
+
+	// Commands missing required arguments are reported with the specific message set for the
+	// command, if any, and otherwise with the command usage.
+	args, err := cmd.bind(text, tokens[consumed:])
+	if _, ok := err.(missingArgumentError); ok && cmd.missing != nil {
+		n.Say(req.channel, cmd.missing)
+		return nil
+	} else if err != nil {
+		return n.SayTemplate(req.channel, templateCommandUsage, commandUsage{Command: n.localCommand(req.channel, cmd), Error: err.Error()})
+	}
+
+	req.router, req.command, req.args = rt, cmd, args
+	return cmd.run(n, req)
+}
+
+// Match returns the command matching the longest prefix of the tokens given, along with the number
+// of tokens making up the command name. Names made up of a single topic word, e.g. 'story', are only
+// matched when given alone, so that mistyped sub-commands aren't taken as arguments.
+func (rt *router) match(tokens []token) (*command, int) {
+	var match *command
+	var size int
+
+	for _, c := range rt.commands {
+		for _, name := range c.names() {
+			var words = strings.Fields(name)
+			if len(words) <= size || len(words) > len(tokens) {
+				continue
+			} else if len(words) == 1 && len(tokens) > 1 && rt.topics[words[0]] {
+				continue
+			}
+
+			var ok = true
+			for i := range words {
+				if tokens[i].quoted || !strings.EqualFold(tokens[i].text, words[i]) {
+					ok = false
+					break
+				}
+			}
+
+			if ok {
+				match, size = c, len(words)
+			}
+		}
+	}
+
+	return match, size
+}
+
+// Find returns the command with the name or alias given, if any.
+func (rt *router) find(name string) *command {
+	var tokens = make([]token, 0)
+	for _, f := range strings.Fields(name) {
+		tokens = append(tokens, token{text: f})
+	}
+
+	if c, size := rt.match(tokens); c != nil && size == len(tokens) {
+		return c
+	}
+
+	return nil
+}
+
+// Topic returns all commands belonging to the topic given, in the order they were declared.
+func (rt *router) topic(word string) []*command {
+	var list []*command
+	for _, c := range rt.commands {
+		if strings.EqualFold(c.Topic(), word) {
+			list = append(list, c)
+		}
+	}
+
+	return list
+}
+
+// TopicNames returns the names of all topics, in the order their commands were declared.
+func (rt *router) topicNames() []string {
+	var names []string
+	var seen = make(map[string]bool)
+	for _, c := range rt.commands {
+		if !seen[c.Topic()] {
+			names, seen[c.Topic()] = append(names, c.Topic()), true
+		}
+	}
+
+	return names
+}
+
+// Suggest returns the command name or alias most similar to the words given, or an empty string if
+// no command is similar enough to be suggested. Longer names are preferred over shorter names, so
+// that mistyped sub-commands are suggested in full, and topic words are never suggested alone.
+func (rt *router) suggest(words []string) string {
+	var best string
+	var bestSize, bestDist = 0, 0
+
+	for _, c := range rt.commands {
+		for _, name := range c.names() {
+			var size = len(strings.Fields(name))
+			if size > len(words) || size < bestSize {
+				continue
+			} else if size == 1 && len(words) > 1 && rt.topics[name] {
+				continue
+			}
+
+			var dist = editDistance(strings.ToLower(strings.Join(words[:size], " ")), name)
+			if dist > (len(name)+2)/4 || (size == bestSize && dist >= bestDist) {
+				continue
+			}
+
+			best, bestSize, bestDist = name, size, dist
+		}
+	}
+
+	return best
+}
+
+// Unknown reports the command given as unknown, suggesting any similar command found, or pointing to
+// help for the topic given, if any.
+func (rt *router) unknown(n *Inform, channel string, tokens []token) error {
+	var words = make([]string, 0, 2)
+	for i := 0; i < len(tokens) && i < 2; i++ {
+		words = append(words, tokens[i].text)
+	}
+
+	var topic string
+	if len(words) > 1 && rt.topics[strings.ToLower(words[0])] {
+		topic = strings.ToLower(words[0])
+	}
+
+	return n.SayTemplate(channel, templateUnknownCommand, unknownCommand{
+		Command:    strings.Join(words, " "),
+		Suggestion: rt.suggest(words),
+		Topic:      topic,
+	})
+}
+
+// Bind returns the arguments for the command, as taken from the tokens given, which follow the
+// command name in the text given.
+func (c *command) bind(text string, tokens []token) (map[string]string, error) {
+	var args = make(map[string]string, len(c.args))
+	var i = 0
+
+	for _, a := range c.args {
+		switch {
+		case a.flag:
+			if i < len(tokens) && !tokens[i].quoted && strings.EqualFold(tokens[i].text, a.name) {
+				args[a.name], i = a.name, i+1
+			}
+		case a.rest:
+			if i < len(tokens) {
+				args[a.name], i = restText(text, tokens[i].start), len(tokens)
+			}
+		case i < len(tokens):
+			args[a.name], i = tokens[i].text, i+1
+		}
+
+		if a.required && strings.TrimSpace(args[a.name]) == "" {
+			return nil, missingArgumentError(a.name)
+		}
+	}
+
+	if i < len(tokens) {
+		return nil, errors.New("'" + tokens[i].text + "' was not expected")
+	}
+
+	return args, nil
+}
+
+// MissingArgumentError is returned when binding arguments for commands where a required argument is
+// not given, and holds the name of the argument.
+type missingArgumentError string
+
+func (e missingArgumentError) Error() string {
+	return "you need to pass in <" + string(e) + ">"
+}
+
+// NewRouter returns a router for the commands given, which are required to have valid usages.
+func newRouter(commands []*command) *router {
+	var rt = &router{commands: commands, topics: make(map[string]bool)}
+	for _, c := range commands {
+		c.parseUsage()
+		catalogNames[c.summary().name], catalogNames[c.help().name] = true, true
+		for _, name := range c.names() {
+			if words := strings.Fields(name); len(words) > 1 {
+				rt.topics[words[0]] = true
+			}
+		}
+	}
+
+	return rt
+}
+
+// Token represents a single word or quoted string in a command, along with its position.
+type token struct {
+	text   string // The token text, with any quotes removed.
+	quoted bool   // Whether or not the token was quoted.
+	start  int    // The byte offset the token starts at, including any opening quote.
+}
+
+// Tokenize splits the text given into words separated by white-space, where words starting with a
+// double or single quote extend to the matching closing quote, and can contain white-space. Quotes
+// that are never closed are taken as-is, as these are common in free-form text, e.g. story sources.
+func tokenize(text string) []token {
+	var tokens []token
+	for i := 0; i < len(text); {
+		if isSpace(text[i]) {
+			i++
+			continue
+		}
+
+		var start = i
+		if q := text[i]; q == '"' || q == '\'' {
+			if end := strings.IndexByte(text[i+1:], q); end >= 0 {
+				tokens = append(tokens, token{text: text[i+1 : i+1+end], quoted: true, start: start})
+				i += end + 2
+				continue
+			}
+		}
+
+		for i < len(text) && !isSpace(text[i]) {
+			i++
+		}
+
+		tokens = append(tokens, token{text: text[start:i], start: start})
+	}
+
+	return tokens
+}
+
+// IsSpace returns whether or not the byte given is white-space separating words in commands.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// RestText returns the text given from the offset given, preserving white-space apart from any
+// trailing spaces, and any new-line directly following the offset.
+func restText(text string, offset int) string {
+	text = strings.TrimRight(text[offset:], " \t")
+	if strings.HasPrefix(text, "\r\n") {
+		return text[2:]
+	}
+
+	return strings.TrimPrefix(text, "\n")
+}
+
+// EditDistance returns the number of single-character insertions, deletions, substitutions, or
+// transpositions of adjacent characters needed to turn one string into the other.
+func editDistance(a, b string) int {
+	var s, t = []rune(a), []rune(b)
+	var d = make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			var cost = 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(s)][len(t)]
+}
@@ -0,0 +1,218 @@
+package inform
+
+import (
+	// Standard library
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	var tests = []struct {
+		name string
+		text string
+		want []token
+	}{
+		{"empty", "", nil},
+		{"white-space", " \t\r\n ", nil},
+		{"words", "story add foo", []token{{"story", false, 0}, {"add", false, 6}, {"foo", false, 10}}},
+		{"extra white-space", "  story\t\nadd  ", []token{{"story", false, 2}, {"add", false, 9}}},
+		{"double quotes", `remove "Basic Screen Effects"`, []token{{"remove", false, 0}, {"Basic Screen Effects", true, 7}}},
+		{"single quotes", `remove 'Basic Effects' x`, []token{{"remove", false, 0}, {"Basic Effects", true, 7}, {"x", false, 23}}},
+		{"empty quotes", `a "" b`, []token{{"a", false, 0}, {"", true, 2}, {"b", false, 5}}},
+		{"mixed quotes", `"it's here"`, []token{{"it's here", true, 0}}},
+		{"unclosed quote", `say "hello there`, []token{{"say", false, 0}, {`"hello`, false, 4}, {"there", false, 11}}},
+		{"apostrophe", "it's fine", []token{{"it's", false, 0}, {"fine", false, 5}}},
+		{"quote within word", `a"b c"`, []token{{`a"b`, false, 0}, {`c"`, false, 4}}},
+		{"adjacent quotes", `"a""b"`, []token{{"a", true, 0}, {"b", true, 3}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	var tests = []struct {
+		name    string
+		usage   string
+		text    string
+		want    map[string]string
+		wantErr string
+	}{
+		{"required", "story start <story>", "foo", map[string]string{"story": "foo"}, ""},
+		{"required quoted", "story start <story>", `"some story"`, map[string]string{"story": "some story"}, ""},
+		{"required missing", "story start <story>", "", nil, "you need to pass in <story>"},
+		{"required empty quotes", "story start <story>", `""`, nil, "you need to pass in <story>"},
+		{"optional given", "story add <name> [<url>]", "foo http://x", map[string]string{"name": "foo", "url": "http://x"}, ""},
+		{"optional missing", "story add <name> [<url>]", "foo", map[string]string{"name": "foo"}, ""},
+		{"unexpected", "story add <name> [<url>]", "foo http://x y", nil, "'y' was not expected"},
+		{"rest", "story new <name> <source...>", "foo\nThe Kitchen is a room.\n\nIt is dark.  ", map[string]string{"name": "foo", "source": "The Kitchen is a room.\n\nIt is dark."}, ""},
+		{"rest with leading space", "story append <name> <text...>", "foo   Some  text", map[string]string{"name": "foo", "text": "Some  text"}, ""},
+		{"rest with quotes", "story append <name> <text...>", `foo "Some text" more`, map[string]string{"name": "foo", "text": `"Some text" more`}, ""},
+		{"rest with carriage return", "story new <name> <source...>", "foo\r\nThe Kitchen.", map[string]string{"name": "foo", "source": "The Kitchen."}, ""},
+		{"rest missing", "story new <name> <source...>", "foo", nil, "you need to pass in <source>"},
+		{"optional rest", "story show <name> [<lines...>]", "foo 12 - 20", map[string]string{"name": "foo", "lines": "12 - 20"}, ""},
+		{"optional rest missing", "story show <name> [<lines...>]", "foo", map[string]string{"name": "foo"}, ""},
+		{"flag given", "extension remove [shared] <name...>", "SHARED Basic Effects", map[string]string{"shared": "shared", "name": "Basic Effects"}, ""},
+		{"flag missing", "extension remove [shared] <name...>", "Basic Effects", map[string]string{"name": "Basic Effects"}, ""},
+		{"flag quoted", "extension remove [shared] <name...>", `"shared"`, map[string]string{"name": `"shared"`}, ""},
+		{"flag only", "extension remove [shared] <name...>", "shared", nil, "you need to pass in <name>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c = &command{Usage: tt.usage}
+			c.parseUsage()
+
+			got, err := c.bind(tt.text, tokenize(tt.text))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("bind(%q) error = %v, want %q", tt.text, err, tt.wantErr)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("bind(%q) error = %v", tt.text, err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bind(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindMissingArgument(t *testing.T) {
+	var c = &command{Usage: "story grant <name> <author>"}
+	c.parseUsage()
+
+	// Missing arguments are told apart from other errors, so that specific messages can be sent.
+	if _, err := c.bind("foo", tokenize("foo")); err != missingArgumentError("author") {
+		t.Errorf("bind() error = %#v, want missingArgumentError", err)
+	} else if _, err := c.bind("foo a b", tokenize("foo a b")); err == nil {
+		t.Errorf("bind() error = nil, want error")
+	} else if _, ok := err.(missingArgumentError); ok {
+		t.Errorf("bind() error = %#v, want other error", err)
+	}
+}
+
+func TestParseUsage(t *testing.T) {
+	var tests = []struct {
+		usage string
+		name  string
+		args  []argument
+	}{
+		{"story end", "story end", nil},
+		{"help [<topic...>]", "help", []argument{{name: "topic", rest: true}}},
+		{"story add <name> [<url>]", "story add", []argument{{name: "name", required: true}, {name: "url"}}},
+		{"extension add [shared] [<url>]", "extension add", []argument{{name: "shared", flag: true}, {name: "url"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.usage, func(t *testing.T) {
+			var c = &command{Usage: tt.usage}
+			if c.parseUsage(); c.name != tt.name || !reflect.DeepEqual(c.args, tt.args) {
+				t.Errorf("parseUsage() = %q, %+v, want %q, %+v", c.name, c.args, tt.name, tt.args)
+			}
+		})
+	}
+
+	for _, usage := range []string{"", "<name>", "story <name> add"} {
+		t.Run(usage, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("parseUsage() did not panic for %q", usage)
+				}
+			}()
+			(&command{Usage: usage}).parseUsage()
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		text     string
+		want     string
+		consumed int
+	}{
+		{"story add foo", "story add", 2},
+		{"STORIES Add foo", "story add", 2},
+		{"story", "story list", 1},
+		{"s", "story list", 1},
+		{"story bogus", "", 0},
+		{`"story" add`, "", 0},
+		{"story list someone@example.com", "story list", 2},
+		{"status", "story status", 1},
+		{"help story add", "help", 1},
+		{"bogus", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var name string
+			c, consumed := commands.match(tokenize(tt.text))
+			if c != nil {
+				name = c.Name()
+			}
+			if name != tt.want || consumed != tt.consumed {
+				t.Errorf("match(%q) = %q, %d, want %q, %d", tt.text, name, consumed, tt.want, tt.consumed)
+			}
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	var tests = []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"story", "ad"}, "story add"},
+		{[]string{"story", "strat"}, "story start"},
+		{[]string{"stroy", "add"}, "story add"},
+		{[]string{"stories", "lst"}, "stories list"},
+		{[]string{"hlep"}, "help"},
+		{[]string{"optoins"}, "options"},
+		{[]string{"story", "bogus"}, ""},
+		{[]string{"xyzzy"}, ""},
+		{[]string{"channel", "xyzzy"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := commands.suggest(tt.words); got != tt.want {
+				t.Errorf("suggest(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"story", "story", 0},
+		{"story", "stor", 1},
+		{"story", "storey", 1},
+		{"story", "stony", 1},
+		{"story", "stroy", 1},
+		{"story", "tsory", 1},
+		{"kitten", "sitting", 3},
+		{"ca", "abc", 3},
+		{"héllo", "hello", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+			} else if got := editDistance(tt.b, tt.a); got != tt.want {
+				t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
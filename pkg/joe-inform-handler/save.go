@@ -0,0 +1,166 @@
+package inform
+
+import (
+	// Standard library
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+)
+
+// The slot name used for saves where no explicit slot name was given.
+const defaultSaveSlot = "default"
+
+// Valid save slot names are limited to a single word containing letters, numbers, hyphens or
+// underscores.
+var saveSlotPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+
+// Save represents a snapshot of interpreter state for a story, as produced by the interpreter's own
+// save mechanism (typically a Quetzal file for Z-machine stories).
+type Save struct {
+	Slot      string    // The user-provided name for the save.
+	AuthorID  string    // The author ID, corresponds to Author.ID.
+	Story     string    // The story name, corresponds to Story.Name.
+	CreatedAt time.Time // The UTC timestamp this save was made on.
+
+	// The opaque save file, as produced by the interpreter.
+	Data []byte
+}
+
+// NewSave returns a Save for the given author, story and slot, with the slot name validated and
+// normalized.
+func NewSave(authorID, story, slot string, data []byte) (*Save, error) {
+	if slot == "" {
+		slot = defaultSaveSlot
+	} else if !saveSlotPattern.MatchString(slot) {
+		return nil, errors.New("save names need to be a single word, and cannot contain special characters")
+	}
+
+	return &Save{
+		Slot:      strings.ToLower(slot),
+		AuthorID:  authorID,
+		Story:     story,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}, nil
+}
+
+// SaveStoryName returns the story name saves for the story and author given are stored against, which
+// is the story reference for stories shared by other authors, so as not to collide with the author's
+// own stories.
+func saveStoryName(story *Story, authorID string) string {
+	if story.AuthorID == authorID {
+		return story.Name
+	}
+
+	return story.Ref()
+}
+
+// SaveKey returns the key used for storing the save in the given slot for a story.
+func saveKey(authorID, story, slot string) string {
+	return savePrefix(authorID, story) + keyPart(strings.ToLower(slot))
+}
+
+// SavePrefix returns the prefix for keys used in storing saves for a story.
+func savePrefix(authorID, story string) string {
+	return keyPrefix + ".save." + keyPart(authorID) + "." + keyPart(story) + "."
+}
+
+// StoreSave persists the given save to the store, replacing any save in the same slot.
+func storeSave(store *joe.Storage, save *Save) error {
+	return store.Set(saveKey(save.AuthorID, save.Story, save.Slot), save)
+}
+
+// LoadSave returns the save for the given author, story and slot, or an error if none was found.
+func loadSave(store *joe.Storage, authorID, story, slot string) (*Save, error) {
+	if slot == "" {
+		slot = defaultSaveSlot
+	}
+
+	var save = &Save{}
+	if ok, err := store.Get(saveKey(authorID, story, slot), save); err != nil {
+		return nil, errors.Wrap(err, "loading save failed")
+	} else if !ok || save.AuthorID != authorID || save.Story != story {
+		return nil, errors.New("no save found with name '" + slot + "'")
+	}
+
+	return save, nil
+}
+
+// ListSaves returns all saves stored for the given author and story, ordered by creation time.
+func listSaves(store *joe.Storage, authorID, story string) ([]*Save, error) {
+	keys, err := store.Keys()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing saves failed")
+	}
+
+	var saves []*Save
+	var prefix = savePrefix(authorID, story)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		var save = &Save{}
+		if ok, err := store.Get(k, save); err != nil {
+			return nil, errors.Wrap(err, "listing saves failed")
+		} else if !ok || save.AuthorID != authorID || save.Story != story {
+			continue
+		}
+
+		save.Data = nil // Save data isn't needed for listing.
+		saves = append(saves, save)
+	}
+
+	sort.Slice(saves, func(i, j int) bool {
+		return saves[i].CreatedAt.Before(saves[j].CreatedAt)
+	})
+
+	return saves, nil
+}
+
+// RemoveSaves removes all saves stored for the given author and story.
+func removeSaves(store *joe.Storage, authorID, story string) error {
+	saves, err := listSaves(store, authorID, story)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range saves {
+		if _, err := store.Delete(saveKey(authorID, story, s.Slot)); err != nil {
+			return errors.Wrap(err, "removing save failed")
+		}
+	}
+
+	return nil
+}
+
+// RemoveStorySaves removes saves stored by any author for the given story, as is the case for
+// stories shared by other authors, which are saved under their full reference.
+func removeStorySaves(store *joe.Storage, story string) error {
+	keys, err := store.Keys()
+	if err != nil {
+		return errors.Wrap(err, "removing saves failed")
+	}
+
+	for _, k := range keys {
+		if !strings.HasPrefix(k, keyPrefix+".save.") {
+			continue
+		}
+
+		var save = &Save{}
+		if ok, err := store.Get(k, save); err != nil {
+			return errors.Wrap(err, "removing saves failed")
+		} else if !ok || save.Story != story {
+			continue
+		} else if _, err = store.Delete(saveKey(save.AuthorID, story, save.Slot)); err != nil {
+			return errors.Wrap(err, "removing save failed")
+		}
+	}
+
+	return nil
+}
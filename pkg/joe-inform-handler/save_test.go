@@ -0,0 +1,121 @@
+package inform
+
+import (
+	// Standard library
+	"encoding/json"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"go.uber.org/zap"
+)
+
+func TestSaveKey(t *testing.T) {
+	// Author IDs and story names containing separators don't produce matching keys.
+	var tests = [][3]string{
+		{"a@x.com", "y.z", "default"},
+		{"a@x.com.y", "z", "default"},
+		{"a@x.com", "y", "z.default"},
+		{"a@x.com", "a@x.com/y.z", "default"},
+		{"a@x.com", "a@x%2Ecom/y.z", "default"},
+	}
+
+	var seen = make(map[string]bool)
+	for _, tt := range tests {
+		var key = saveKey(tt[0], tt[1], tt[2])
+		if seen[key] {
+			t.Errorf("saveKey(%q, %q, %q) = %q, which matches other keys", tt[0], tt[1], tt[2], key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestLoadSave(t *testing.T) {
+	var store = joe.NewStorage(zap.NewNop())
+	save, err := NewSave("a@x.com", "y.z", "", []byte("data"))
+	if err != nil {
+		t.Fatalf("NewSave() error = %v", err)
+	} else if err = storeSave(store, save); err != nil {
+		t.Fatalf("storeSave() error = %v", err)
+	}
+
+	if got, err := loadSave(store, "a@x.com", "y.z", ""); err != nil || string(got.Data) != "data" {
+		t.Errorf("loadSave() = %+v, %v, want stored save", got, err)
+	} else if _, err := loadSave(store, "a@x.com.y", "z", ""); err == nil {
+		t.Errorf("loadSave() error = nil for other author, want error")
+	}
+
+	// Saves stored under keys not matching their author or story are not loaded.
+	if err := store.Set(saveKey("b@x.com", "y.z", "default"), save); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	} else if _, err := loadSave(store, "b@x.com", "y.z", ""); err == nil {
+		t.Errorf("loadSave() error = nil for save stored by other author, want error")
+	}
+}
+
+func TestRemoveStorySaves(t *testing.T) {
+	var store = joe.NewStorage(zap.NewNop())
+	for _, s := range [][2]string{{"b@x.com", "a@x.com/y"}, {"c@x.com", "a@x.com/y"}, {"c@x.com", "a@x.com/z"}} {
+		if save, err := NewSave(s[0], s[1], "", []byte("data")); err != nil {
+			t.Fatalf("NewSave() error = %v", err)
+		} else if err = storeSave(store, save); err != nil {
+			t.Fatalf("storeSave() error = %v", err)
+		}
+	}
+
+	if err := removeStorySaves(store, "a@x.com/y"); err != nil {
+		t.Fatalf("removeStorySaves() error = %v", err)
+	} else if keys, err := store.Keys(); err != nil || len(keys) != 1 || keys[0] != saveKey("c@x.com", "a@x.com/z", "default") {
+		t.Errorf("Keys() = %q, %v, want save for other story only", keys, err)
+	}
+}
+
+func TestMigrateSaveKeys(t *testing.T) {
+	var records = map[string][]byte{
+		keyPrefix + ".save.a@x.com.y.z.default": []byte(`{"Slot":"default","AuthorID":"a@x.com","Story":"y.z"}`),
+		keyPrefix + ".save.b@x.com.w.slot":      []byte(`{"Slot":"slot","AuthorID":"b@x.com","Story":"w"}`),
+		keyPrefix + ".other":                    []byte(`"kept"`),
+	}
+
+	s, err := bolt.NewStore(t.TempDir()+"/store.db", bolt.WithMigrations(Migrations...))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	defer s.Close()
+	if err := s.Import(records); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+
+	var want = map[string]bool{
+		saveKey("a@x.com", "y.z", "default"): true,
+		saveKey("b@x.com", "w", "slot"):      true,
+		keyPrefix + ".other":                 true,
+	}
+
+	if len(keys) != len(want) {
+		t.Errorf("Keys() = %q, want %d keys", keys, len(want))
+	}
+
+	for _, k := range keys {
+		if !want[k] {
+			t.Errorf("Keys() = %q, want %v", keys, want)
+			break
+		}
+	}
+
+	var save Save
+	if value, ok, err := s.Get(saveKey("a@x.com", "y.z", "default")); err != nil || !ok {
+		t.Errorf("Get() = %v, %v, want save", ok, err)
+	} else if err = json.Unmarshal(value, &save); err != nil || save.Story != "y.z" {
+		t.Errorf("Get() = %+v, %v, want save for story 'y.z'", save, err)
+	}
+}
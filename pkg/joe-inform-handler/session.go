@@ -8,43 +8,71 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	// Third-party packages
 	"github.com/pkg/errors"
 )
 
-// Default arguments for executable dependencies.
-var (
-	// The prefix used for Frotz meta-commands.
-	frotzMetaPrefix = "\\"
-	frotzArgs       = []string{"-r", "lt", "-r", "cm", "-r", "ch1", "-p", "-m", "-R"}
-)
+// The prefix used for Frotz meta-commands.
+const frotzMetaPrefix = "\\"
+
+// The file name used for save files written by the interpreter, relative to the session directory.
+const sessionSaveFile = "session.qzl"
+
+// The suffix added to file names by Glk-based interpreters, when saving files.
+const glkSaveSuffix = ".glksave"
 
 type Session struct {
-	path string
-	name string
+	path   string
+	name   string
+	story  *Story
+	format string
+
+	// The lock held while commands are run against the session, protecting concurrent access to fields
+	// below. Fields read when looking up options for channels are only changed while also holding the
+	// lock for sessions.
+	mu    sync.Mutex
+	ended bool // Whether or not the session was ended, and removed from active sessions.
+
+	owner   string  // The author ID in control of the session.
+	channel string  // The channel the session is shared in, if any.
+	options Options // The options set for the owner, as used in formatting output.
+
+	notify    string    // The channel last used for interacting with the session.
+	startedAt time.Time // The time the session was started on.
+	activeAt  time.Time // The time the session was last interacted with.
+	warned    bool      // Whether or not participants were warned of the session expiring.
 
-	proc *os.Process
+	log        []string // Commands given since the last checkpoint was saved.
+	checkpoint []byte   // The save data for the last checkpoint, if any.
+	restored   bool     // Whether or not the session was resumed from a checkpoint.
 
-	in  io.WriteCloser
-	out io.ReadCloser
-	err io.ReadCloser
+	transcript *Transcript // The transcript being recorded for the session, if any.
+
+	status  Status // The status line, as last shown by the story.
+	shown   string // The status line as last set for adapters, if any.
+	shownIn string // The channel the status line was last set for.
+
+	proc Process
+	conf *Config
+
+	reader *outputReader // Responses and errors read from the interpreter, as they become available.
+	output []byte        // Output collected since the last call to Output.
 }
 
 func (s *Session) Run(cmd string) error {
 	switch strings.ToLower(cmd) {
-	case "restore":
-		return errors.New("TODO: Implement restoring")
-	case "save":
-		return errors.New("TODO: Implement saving")
+	case "restore", "save":
+		return errors.New("saving and restoring needs to happen via the bot")
 	case "\\x", "quit":
-		return errors.New("TODO: Implement session stopping")
+		return errors.New("sessions need to be ended via the bot")
 	case "script", "unscript":
-		return errors.New("transcripts are disabled")
+		return errors.New("transcripts need to be recorded via the bot")
 	case "\\<", "\\>", "\\^", "\\.": // Cursor motion
 	case "\\1", "\\2", "\\3", "\\4", "\\5", "\\6", "\\7", "\\8", "\\9", "\\0": // F1 - F10
 	case "\\n", "\\u": // Frotz hot-keys
@@ -54,20 +82,117 @@ func (s *Session) Run(cmd string) error {
 		}
 	}
 
-	if _, err := s.in.Write(append([]byte(cmd), '\n')); err != nil {
+	if err := s.send(cmd); err != nil {
+		return err
+	}
+
+	s.log = append(s.log, cmd)
+	return nil
+}
+
+// Save requests that the interpreter write its current state to a save file, and returns the
+// contents of that file.
+func (s *Session) Save() ([]byte, error) {
+	// Interpreters may add their own suffix to file names given, so both variants are checked for.
+	var files = []string{path.Join(s.path, sessionSaveFile), path.Join(s.path, sessionSaveFile+glkSaveSuffix)}
+	for _, f := range files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "removing previous save file failed")
+		}
+	}
+
+	// The interpreter will prompt for a file name, which is restricted to the session directory.
+	if err := s.prompt("save", sessionSaveFile); err != nil {
+		return nil, err
+	}
+
+	s.Output() // Discard confirmation message.
+	for _, f := range files {
+		if buf, err := ioutil.ReadFile(f); err == nil {
+			return buf, nil
+		}
+	}
+
+	return nil, errors.New("interpreter failed to save story")
+}
+
+// Restore writes the given save data to a file in the session directory and requests that the
+// interpreter restore its state from it. Any output produced by the interpreter is made available
+// via Output.
+func (s *Session) Restore(data []byte) error {
+	for _, f := range []string{sessionSaveFile, sessionSaveFile + glkSaveSuffix} {
+		if err := ioutil.WriteFile(path.Join(s.path, f), data, 0644); err != nil {
+			return errors.Wrap(err, "writing save file failed")
+		}
+	}
+
+	return s.prompt("restore", sessionSaveFile)
+}
+
+// Prompt runs the given command, which is expected to prompt for a file name, and responds to the
+// prompt with the name given.
+func (s *Session) prompt(cmd, name string) error {
+	if err := s.send(cmd); err != nil {
+		return err
+	}
+
+	s.Output() // Discard file name prompt.
+	return s.send(name)
+}
+
+// Send writes the given line of input to the interpreter, and waits for the interpreter to process
+// it, making any output produced available via Output. If the interpreter fails to process input
+// within its allotted budget, it is stopped and a TurnError is returned.
+func (s *Session) send(cmd string) error {
+	if s.halted() {
+		return errors.New("story is not running")
+	}
+
+	// Collect any responses left over from previous commands, e.g. where output was produced after
+	// the prompt ending the previous response, so that they aren't mistaken for responses to this one.
+	for len(s.reader.responses) > 0 {
+		s.output = append(s.output, <-s.reader.responses...)
+	}
+
+	if _, err := s.proc.Write(append([]byte(cmd), '\n')); err != nil {
 		return errors.New("failed writing command")
 	}
 
+	out, err := s.await(cmd)
+	s.output = append(s.output, out...)
+	if err != nil {
+		s.halt()
+		return err
+	}
+
 	return s.Error()
 }
 
+// Output returns any output produced by the interpreter since the last call to Output, updating
+// the status line for the session with any status line found. Output is only checked for status
+// lines for interpreters known to print these as part of their output.
 func (s *Session) Output() string {
-	var buf = bytes.TrimSuffix(readPipe(s.out), []byte{'\n', '>'})
+	var buf = trimPrompt(s.output)
+	s.output = nil
+
+	if p, ok := s.proc.(StatusProcess); ok {
+		s.status = p.Status()
+	} else if p, ok := s.proc.(StatusPrintingProcess); ok && p.PrintsStatus() {
+		if st, rest, ok := splitStatus(buf); ok {
+			s.status, buf = st, rest
+		}
+	}
+
 	return string(buf)
 }
 
+// Status returns the status line, as last shown by the story.
+func (s *Session) Status() Status {
+	return s.status
+}
+
 func (s *Session) Error() error {
-	var buf = bytes.ReplaceAll(readPipe(s.err), []byte{'\n'}, []byte{':', ' '})
+	var buf = bytes.ReplaceAll(s.reader.errors(), []byte{'\n'}, []byte{':', ' '})
 	if len(buf) > 0 {
 		return errors.New(string(buf))
 	}
@@ -75,87 +200,141 @@ func (s *Session) Error() error {
 	return nil
 }
 
+// Start runs the story with the interpreter configured for its format, and waits for the initial
+// output to become available via Output.
 func (s *Session) Start(ctx context.Context, conf *Config) error {
-	var err error
-	var cmd = exec.CommandContext(ctx, conf.DumbFrotz, append(frotzArgs, s.path, s.name)...)
+	interp, ok := conf.Interpreters[s.format]
+	if !ok || interp == nil {
+		return errors.New("no interpreter available for story format '" + s.format + "'")
+	}
 
-	if s.in, err = cmd.StdinPipe(); err != nil {
-		return errors.Wrap(err, "starting session failed")
-	} else if s.out, err = cmd.StdoutPipe(); err != nil {
-		return errors.Wrap(err, "starting session failed")
-	} else if s.err, err = cmd.StderrPipe(); err != nil {
+	proc, err := interp.Start(ctx, conf.Sandbox, s.path, s.name)
+	if err != nil {
 		return errors.Wrap(err, "starting session failed")
-	} else if err = cmd.Start(); err != nil {
+	}
+
+	s.proc, s.conf = proc, conf
+	s.reader = newOutputReader(proc.Output(), proc.Errors())
+
+	out, err := s.await("")
+	if err != nil {
+		s.halt()
 		return errors.Wrap(err, "starting session failed")
-	} else if err := s.Error(); err != nil {
-		return err
 	}
 
-	s.proc = cmd.Process
-	return nil
+	s.output = out
+	return s.Error()
 }
 
-func (s *Session) Close() error {
-	var err error
+// Halt stops the interpreter process, if running, leaving the session otherwise intact. Halted
+// sessions can be started again with Start.
+func (s *Session) halt() {
 	if s.proc != nil {
-		err = s.proc.Kill()
+		_ = s.proc.Close()
 		s.proc = nil
 	}
+}
+
+// Halted returns whether or not the interpreter process has been stopped.
+func (s *Session) halted() bool {
+	return s.proc == nil
+}
+
+// Lock acquires the lock for the session, and returns whether or not the session is still active.
+// The lock is released for sessions ended while waiting for it.
+func (s *Session) lock() bool {
+	if s.mu.Lock(); s.ended {
+		s.mu.Unlock()
+		return false
+	}
+
+	return true
+}
+
+// Touch marks the session as active, as of the time given, and sets the channel given as the one
+// receiving notifications for the session.
+func (s *Session) touch(channel string, now time.Time) {
+	s.notify, s.activeAt, s.warned = channel, now, false
+}
+
+// Close stops the interpreter process, if running, and removes all files created for the session.
+func (s *Session) Close() error {
+	s.halt()
+	return os.RemoveAll(s.path)
+}
+
+// SessionKey returns the key sessions are held against, depending on whether they are shared in a
+// channel or are otherwise owned by a single author.
+func sessionKey(authorID, channel string) string {
+	if channel != "" {
+		return "channel." + channel
+	}
+
+	return "author." + authorID
+}
+
+func (s *Session) key() string {
+	return sessionKey(s.owner, s.channel)
+}
+
+// SaveStory returns the story name saves made during the session are stored against.
+func (s *Session) saveStory() string {
+	return saveStoryName(s.story, s.owner)
+}
 
-	return err
+// Characters not used as-is in file names, as derived from author IDs or story names.
+var unsafePathPattern = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// PathName returns the text given with any characters not safe for use in file names replaced.
+func pathName(s string) string {
+	return unsafePathPattern.ReplaceAllString(s, "_")
 }
 
 func NewSession(story *Story) (*Session, error) {
-	dir, err := ioutil.TempDir(os.TempDir(), fmt.Sprintf("%s-%s-%s-*", keyPrefix, story.AuthorID, story.Name))
+	dir, err := ioutil.TempDir(os.TempDir(), fmt.Sprintf("%s-%s-%s-*", keyPrefix, pathName(story.AuthorID), pathName(story.Name)))
 	if err != nil {
 		return nil, errors.Wrap(err, "creating temporary directory failed")
 	}
 
-	f, err := os.Create(path.Join(dir, "output.z8"))
-	if err != nil {
-		return nil, errors.Wrap(err, "writing temporary story file failed")
+	// Stories compiled before formats were selectable are always compiled for Z-machine version 8.
+	var format = story.BuildFormat
+	if format == FormatAuto {
+		format = FormatZ8
 	}
 
-	defer f.Close()
-	if _, err = f.Write(story.Build); err != nil {
+	var name = path.Join(dir, "output."+storyFormats[format].extension)
+	if err = ioutil.WriteFile(name, story.Build, 0644); err != nil {
+		_ = os.RemoveAll(dir)
 		return nil, errors.Wrap(err, "writing temporary story file failed")
 	}
 
 	return &Session{
-		path: dir,
-		name: f.Name(),
+		path:      dir,
+		name:      name,
+		story:     story,
+		format:    format,
+		startedAt: time.Now(),
+		activeAt:  time.Now(),
 	}, nil
 }
 
-func readPipe(r io.Reader) []byte {
-	var chunks = make(chan []byte)
+// ReadChunks continuously reads from the given reader, sending any data read over the channel
+// returned, which is closed once the reader is exhausted.
+func readChunks(r io.Reader) <-chan []byte {
+	var chunks = make(chan []byte, 16)
 	go func() {
-		var chunk = make([]byte, 1024)
+		defer close(chunks)
 		for {
+			var chunk = make([]byte, 1024)
 			n, err := r.Read(chunk)
-			if err != nil || n == 0 {
-				close(chunks)
-				return
+			if n > 0 {
+				chunks <- chunk[:n]
 			}
-
-			chunks <- chunk[:n]
-			if n < 1024 {
-				close(chunks)
+			if err != nil {
 				return
 			}
 		}
 	}()
 
-	var buf []byte
-	for {
-		select {
-		case chunk, ok := <-chunks:
-			if !ok {
-				return buf
-			}
-			buf = append(buf, chunk...)
-		case <-time.After(10 * time.Millisecond):
-			return buf
-		}
-	}
+	return chunks
 }
@@ -0,0 +1,188 @@
+package inform
+
+import (
+	// Standard library
+	"strings"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Story visibility levels, determining who other than the author can play and fork stories.
+const (
+	VisibilityPrivate  = ""         // Only the author, and any authors granted access.
+	VisibilityUnlisted = "unlisted" // Anyone referring to the story by name, though it isn't listed.
+	VisibilityPublic   = "public"   // Anyone, with the story listed for other authors.
+)
+
+// The separator between author IDs and story names in story references, e.g. 'someone/some-name'.
+// Neither author IDs nor story names can contain the separator, which is never found in the bare JIDs
+// used as author IDs for XMPP.
+const storyRefSeparator = "/"
+
+// SetVisibility sets the visibility level for the story.
+func (s *Story) SetVisibility(visibility string) error {
+	switch visibility = strings.ToLower(visibility); visibility {
+	case "private":
+		s.Visibility = VisibilityPrivate
+	case VisibilityUnlisted, VisibilityPublic:
+		s.Visibility = visibility
+	default:
+		return errors.New("story visibility '" + visibility + "' is unknown")
+	}
+
+	return nil
+}
+
+// Grant allows the author given to play and fork the story, regardless of its visibility.
+func (s *Story) Grant(authorID string) error {
+	if err := validateAuthorID(authorID); err != nil {
+		return err
+	} else if authorID == s.AuthorID {
+		return errors.New("authors always have access to their own stories")
+	} else if s.isGranted(authorID) {
+		return errors.New("'" + authorID + "' already has access to story '" + s.Name + "'")
+	}
+
+	s.Grants = append(s.Grants, authorID)
+	return nil
+}
+
+// Revoke removes access previously granted to the author given.
+func (s *Story) Revoke(authorID string) error {
+	for i, id := range s.Grants {
+		if id == authorID {
+			s.Grants = append(s.Grants[:i], s.Grants[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("'" + authorID + "' has not been granted access to story '" + s.Name + "'")
+}
+
+// CanAccess returns whether or not the author given can play and fork the story.
+func (s *Story) CanAccess(authorID string) bool {
+	return authorID == s.AuthorID || s.Visibility != VisibilityPrivate || s.isGranted(authorID)
+}
+
+// IsListed returns whether or not the story is listed for the author given, which is the case for
+// public stories, and stories the author has been explicitly granted access to.
+func (s *Story) IsListed(authorID string) bool {
+	return s.Visibility == VisibilityPublic || s.isGranted(authorID)
+}
+
+// IsGranted returns whether or not the author given has been explicitly granted access to the story.
+func (s *Story) isGranted(authorID string) bool {
+	for _, id := range s.Grants {
+		if id == authorID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Ref returns the reference for the story, as used by other authors, e.g. 'someone/some-name'.
+func (s *Story) Ref() string {
+	return s.AuthorID + storyRefSeparator + s.Name
+}
+
+// ParseStoryRef returns the author ID and story name for the story reference given, where the author
+// ID is empty for plain story names. References not made up of a valid author ID and story name
+// are rejected.
+func parseStoryRef(ref string) (authorID, name string, err error) {
+	authorID, name, ok := strings.Cut(ref, storyRefSeparator)
+	if !ok {
+		return "", ref, nil
+	} else if validateAuthorID(authorID) != nil || validateStoryName(name) != nil {
+		return "", "", errors.New("story reference '" + ref + "' is not valid, and needs to be given as e.g. 'someone@example.com/some-name'")
+	}
+
+	return authorID, name, nil
+}
+
+// FindStory returns the story referred to for the author given, either as a plain story name for the
+// author's own stories, or as a reference to another author's story, e.g. 'someone/some-name'.
+// Stories the author does not have access to are reported as not found.
+func (n *Inform) FindStory(author *Author, ref string) (*Story, error) {
+	authorID, name, err := parseStoryRef(ref)
+	if err != nil {
+		return nil, err
+	} else if authorID == "" || authorID == author.ID {
+		return author.GetStory(name)
+	}
+
+	other, err := n.loadAuthor(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	story, err := other.GetStory(name)
+	if err != nil || !story.CanAccess(author.ID) {
+		return nil, errors.New("no story found with name '" + ref + "'")
+	}
+
+	return story, nil
+}
+
+// LoadAuthor returns the stored author with the ID given.
+func (n *Inform) loadAuthor(id string) (*Author, error) {
+	var author = &Author{Options: defaultOptions}
+	if ok, err := n.bot.Store.Get(keyPrefix+".author."+id, author); err != nil {
+		return nil, errors.Wrap(err, "loading author failed")
+	} else if !ok {
+		return nil, errors.New("no author found with ID '" + id + "'")
+	}
+
+	author.blobs = n.config.Blobs
+	return author, nil
+}
+
+// SharedStoryList represents the data passed to the shared story list template.
+type sharedStoryList struct {
+	AuthorID string
+	Stories  []*Story
+}
+
+// SharedStories returns the list of stories for the author given that are listed for the viewer
+// given.
+func (n *Inform) SharedStories(authorID, viewerID string) (*sharedStoryList, error) {
+	author, err := n.loadAuthor(authorID)
+	if err != nil {
+		return nil, err
+	}
+
+	var list = &sharedStoryList{AuthorID: author.ID}
+	for _, s := range author.Stories {
+		if s.IsListed(viewerID) {
+			list.Stories = append(list.Stories, s)
+		}
+	}
+
+	return list, nil
+}
+
+// ForkStory returns a copy of the story given, owned by the author given and with the name given,
+// which starts out private. The copy retains the current source and format for the story, but none
+// of its previous revisions.
+func (a *Author) ForkStory(story *Story, name string) (*Story, error) {
+	if name == "" {
+		name = story.Name
+	}
+
+	if s, _ := a.GetStory(name); s != nil {
+		return nil, errors.New("a story named '" + name + "' already exists")
+	} else if err := validateStoryName(name); err != nil {
+		return nil, err
+	} else if len(story.Source) == 0 {
+		return nil, errors.New("story source is empty")
+	}
+
+	var fork = NewStory(name, a.ID)
+	fork.Format = story.Format
+	fork.Source = append([]byte(nil), story.Source...)
+	fork.addRevision(nil, "forked from "+story.Ref())
+
+	a.Stories = append(a.Stories, fork)
+	return fork, nil
+}
@@ -0,0 +1,204 @@
+package inform
+
+import (
+	// Standard library
+	"strconv"
+	"strings"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// The maximum number of source lines shown at once, where no explicit range is given.
+const maxShownLines = 50
+
+// NumberedLine represents a single, numbered line of story source.
+type numberedLine struct {
+	Number int
+	Text   string
+}
+
+// Lines returns the story source as a list of lines, not including any trailing line terminator.
+func (s *Story) lines() []string {
+	var src = strings.ReplaceAll(string(s.Source), "\r\n", "\n")
+	if src = strings.TrimSuffix(src, "\n"); src == "" {
+		return nil
+	}
+
+	return strings.Split(src, "\n")
+}
+
+// SetLines sets the story source to the lines given.
+func (s *Story) setLines(lines []string) {
+	if len(lines) == 0 {
+		s.WithSource(nil)
+		return
+	}
+
+	s.WithSource([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
+// ShowLines returns the numbered source lines between the line numbers given, inclusive. Ranges
+// extending past the end of the source are truncated.
+func (s *Story) ShowLines(from, to int) ([]numberedLine, error) {
+	var lines = s.lines()
+	if from < 1 || from > len(lines) {
+		return nil, errors.Errorf("line %d is out of range, as the story has %d line(s)", from, len(lines))
+	} else if to > len(lines) {
+		to = len(lines)
+	}
+
+	var result = make([]numberedLine, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		result = append(result, numberedLine{Number: i, Text: lines[i-1]})
+	}
+
+	return result, nil
+}
+
+// ReplaceLines replaces the source lines between the line numbers given, inclusive, with the text
+// given, which may span multiple lines.
+func (s *Story) ReplaceLines(from, to int, text string) error {
+	var lines = s.lines()
+	if from < 1 || to > len(lines) {
+		return errors.Errorf("lines %d to %d are out of range, as the story has %d line(s)", from, to, len(lines))
+	}
+
+	var result = append(append([]string{}, lines[:from-1]...), splitLines(text)...)
+	s.setLines(append(result, lines[to:]...))
+	return nil
+}
+
+// InsertLines inserts the text given, which may span multiple lines, before the line number given.
+// Lines are appended to the end of the source for the line number following the last line.
+func (s *Story) InsertLines(at int, text string) error {
+	var lines = s.lines()
+	if at < 1 || at > len(lines)+1 {
+		return errors.Errorf("line %d is out of range, as the story has %d line(s)", at, len(lines))
+	}
+
+	var result = append(append([]string{}, lines[:at-1]...), splitLines(text)...)
+	s.setLines(append(result, lines[at-1:]...))
+	return nil
+}
+
+// DeleteLines removes the source lines between the line numbers given, inclusive.
+func (s *Story) DeleteLines(from, to int) error {
+	var lines = s.lines()
+	if from < 1 || to > len(lines) {
+		return errors.Errorf("lines %d to %d are out of range, as the story has %d line(s)", from, to, len(lines))
+	}
+
+	s.setLines(append(lines[:from-1], lines[to:]...))
+	return nil
+}
+
+// AppendParagraph appends the text given to the end of the source, as a separate paragraph.
+func (s *Story) AppendParagraph(text string) {
+	var lines = s.lines()
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) != "" {
+		lines = append(lines, "")
+	}
+
+	s.setLines(append(lines, splitLines(text)...))
+}
+
+// SplitLines returns the text given as a list of lines, ignoring any trailing line terminator.
+func splitLines(text string) []string {
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n"), "\n")
+}
+
+// ParseLineRange parses line ranges given as a single line number, e.g. '12', or as a range of line
+// numbers, inclusive, e.g. '12-20'.
+func parseLineRange(r string) (int, int, error) {
+	var start, end, isRange = strings.Cut(r, "-")
+	from, err := strconv.Atoi(start)
+	if err != nil || from < 1 {
+		return 0, 0, errors.Errorf("'%s' is not a valid line number or range", r)
+	} else if !isRange {
+		return from, from, nil
+	}
+
+	to, err := strconv.Atoi(end)
+	if err != nil || to < from {
+		return 0, 0, errors.Errorf("'%s' is not a valid line number or range", r)
+	}
+
+	return from, to, nil
+}
+
+// ShowStory sends the numbered source lines for the story given to the channel given, either for the
+// line range given, or for the first lines of the story, if no range is given.
+func (n *Inform) ShowStory(channel string, story *Story, lines string) error {
+	var from, to = 1, maxShownLines
+	if lines != "" {
+		var err error
+		if from, to, err = parseLineRange(lines); err != nil {
+			n.Say(channel, messageInvalidLines, err)
+			return nil
+		}
+	}
+
+	shown, err := story.ShowLines(from, to)
+	if err != nil {
+		n.Say(channel, messageInvalidLines, err)
+		return nil
+	}
+
+	// Point to the following range of lines, if any remain.
+	var src = storySource{Story: story.Name, Lines: shown, Total: len(story.lines())}
+	if last := shown[len(shown)-1].Number; last < src.Total {
+		src.More = strconv.Itoa(last+1) + "-" + strconv.Itoa(last+maxShownLines)
+	}
+
+	return n.SayTemplate(channel, templateStorySource, src)
+}
+
+// EditStory applies the edit given to the source of an existing story for the author given, and
+// recompiles the story. Edits are given as one of:
+//
+//	story edit <name> <line>[-<line>] <text>
+//	story insert <name> <line> <text>
+//	story delete <name> <line>[-<line>]
+//	story append <name> <text>
+//
+// Where text may span multiple lines, and starts either directly after the line number, or on the
+// following line.
+func (n *Inform) EditStory(channel string, author *Author, op, name, lines, text string) error {
+	story, err := author.GetStory(name)
+	if err != nil {
+		n.Say(channel, messageInvalidStory, err)
+		return nil
+	}
+
+	// Line numbers are given for all edits, apart from appending paragraphs.
+	var from, to int
+	if op = strings.ToLower(op); op != "append" {
+		if from, to, err = parseLineRange(lines); err != nil {
+			n.Say(channel, messageInvalidEdit, err)
+			return nil
+		}
+	}
+
+	if op == "append" {
+		story.AppendParagraph(text)
+	} else if op == "delete" {
+		err = story.DeleteLines(from, to)
+	} else if op == "edit" {
+		err = story.ReplaceLines(from, to, text)
+	} else if from != to {
+		err = errors.New("text can only be inserted before a single line")
+	} else {
+		err = story.InsertLines(from, text)
+	}
+
+	if err != nil {
+		n.Say(channel, messageInvalidEdit, err)
+		return nil
+	} else if int64(len(story.Source)) > n.config.MaxSourceSize {
+		n.Say(channel, messageInvalidEdit, errors.Errorf("story source would be larger than %d bytes", n.config.MaxSourceSize))
+		return nil
+	}
+
+	return n.CompileStory(channel, author, story, n.message(channel, messageEditedStory, story.Name, len(story.lines())))
+}
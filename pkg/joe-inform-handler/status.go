@@ -0,0 +1,161 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	// Third-party packages
+	"go.uber.org/zap"
+)
+
+// Status represents the status line shown by a story, commonly holding the current location, along
+// with either the score and number of moves made, or the time of day. Status lines not following
+// these conventions only have Text set.
+type Status struct {
+	Text     string // The status line as shown, with runs of spaces collapsed.
+	Location string // The name of the current location.
+	Scored   bool   // Whether or not the score is shown.
+	Score    int    // The current score, if shown.
+	Counted  bool   // Whether or not the number of moves is shown.
+	Moves    int    // The current number of moves, if shown.
+	Time     bool   // Whether or not the time of day is shown, rather than score and moves.
+	Hours    int    // The current hour of the day, from 0 to 23, if time is shown.
+	Minutes  int    // The current minute of the hour, if time is shown.
+}
+
+// StatusAwareAdapter is an optional interface that adapters can implement, if they support showing
+// the status line for stories played in a channel outside of messages sent, e.g. as presence status.
+// The status given is empty when no story is being played in the channel.
+type StatusAwareAdapter interface {
+	SetStatus(channel, status string) error
+}
+
+// Patterns matched against the right-hand side of status lines, as commonly shown by stories, and
+// in the order they are checked.
+var (
+	statusSeparatorPattern  = regexp.MustCompile(`\s{2,}`)
+	statusScoreMovesPattern = regexp.MustCompile(`(?i)^score:\s*(-?\d+)\s+(?:moves|turns):\s*(\d+)$`)
+	statusFractionPattern   = regexp.MustCompile(`^(-?\d+)\s*/\s*(\d+)$`)
+	statusScorePattern      = regexp.MustCompile(`(?i)^score:\s*(-?\d+)$`)
+	statusMovesPattern      = regexp.MustCompile(`(?i)^(?:(?:moves|turns):\s*)?(\d+)$`)
+	statusTimePattern       = regexp.MustCompile(`(?i)^(?:time:\s*)?(\d{1,2}):(\d{2})\s*([ap]\.?m\.?)?$`)
+)
+
+// ParseStatus returns the status line given, as parsed into its separate parts where these follow
+// common conventions, and whether or not any such parts were found. Only the first line is parsed
+// for status lines spanning multiple lines.
+func parseStatus(text string) (Status, bool) {
+	var line = strings.TrimSpace(text)
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = strings.TrimSpace(line[:i])
+	}
+
+	var st = Status{Text: statusSeparatorPattern.ReplaceAllString(strings.TrimSpace(text), "  ")}
+	var parts = statusSeparatorPattern.Split(line, 2)
+	if len(parts) < 2 {
+		return st, false
+	}
+
+	var right = strings.Join(strings.Fields(parts[1]), " ")
+	if m := statusScoreMovesPattern.FindStringSubmatch(right); m != nil {
+		st.Scored, st.Score, st.Counted, st.Moves = true, atoi(m[1]), true, atoi(m[2])
+	} else if m := statusFractionPattern.FindStringSubmatch(right); m != nil {
+		st.Scored, st.Score, st.Counted, st.Moves = true, atoi(m[1]), true, atoi(m[2])
+	} else if m := statusScorePattern.FindStringSubmatch(right); m != nil {
+		st.Scored, st.Score = true, atoi(m[1])
+	} else if m := statusMovesPattern.FindStringSubmatch(right); m != nil {
+		st.Counted, st.Moves = true, atoi(m[1])
+	} else if m := statusTimePattern.FindStringSubmatch(right); m != nil && atoi(m[1]) < 24 && atoi(m[2]) < 60 {
+		st.Time, st.Hours, st.Minutes = true, atoi(m[1]), atoi(m[2])
+		if suffix := strings.ToLower(m[3]); suffix != "" {
+			st.Hours %= 12
+			if suffix[0] == 'p' {
+				st.Hours += 12
+			}
+		}
+	} else {
+		return st, false
+	}
+
+	st.Location = parts[0]
+	return st, true
+}
+
+// SplitStatus returns the status line found at the start of the interpreter output given, if any,
+// along with the remaining output. Status lines are only recognized where they follow common
+// conventions, as output by interpreters that print the status line as part of their output, and
+// other output is returned as-is.
+func splitStatus(buf []byte) (Status, []byte, bool) {
+	var rest = bytes.TrimLeft(buf, "\n")
+	var line = rest
+	if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+		line, rest = rest[:i], rest[i+1:]
+	} else {
+		rest = nil
+	}
+
+	st, ok := parseStatus(string(line))
+	if !ok {
+		return Status{}, buf, false
+	}
+
+	return st, bytes.TrimLeft(rest, "\n"), true
+}
+
+// Atoi returns the number for the text given, or zero if the text is not a valid number.
+func atoi(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+// ShowStatus returns the status line for the session given, as shown to the channel given, or an
+// empty string if the story has not shown a status line.
+func (n *Inform) showStatus(channel string, sess *Session) string {
+	var st = sess.Status()
+	if st.Text == "" {
+		return ""
+	}
+
+	out, err := n.executeTemplate(channel, templateStatusLine, st)
+	if err != nil {
+		return st.Text
+	}
+
+	return strings.TrimSpace(out)
+}
+
+// UpdateStatus sets the status line shown by adapters for the session given, where supported, and
+// where the status line has changed since last set. Status lines are cleared for sessions that have
+// been halted, or where the session was last interacted with in a different channel.
+func (n *Inform) updateStatus(sess *Session) {
+	a, ok := n.bot.Adapter.(StatusAwareAdapter)
+	if !ok {
+		return
+	}
+
+	var channel, status = sess.notify, ""
+	if !sess.halted() {
+		status = n.showStatus(channel, sess)
+	}
+
+	if sess.shownIn != "" && sess.shownIn != channel {
+		n.setStatus(a, sess.shownIn, "")
+		sess.shownIn, sess.shown = "", ""
+	}
+
+	if status != sess.shown {
+		n.setStatus(a, channel, status)
+		sess.shownIn, sess.shown = channel, status
+	}
+}
+
+// SetStatus sets the status line shown by the adapter given for the channel given, logging any
+// errors returned.
+func (n *Inform) setStatus(a StatusAwareAdapter, channel, status string) {
+	if err := a.SetStatus(channel, status); err != nil {
+		n.bot.Logger.Warn("Setting status failed", zap.String("channel", channel), zap.Error(err))
+	}
+}
@@ -0,0 +1,119 @@
+package inform
+
+import (
+	// Standard library
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatus(t *testing.T) {
+	var tests = []struct {
+		name string
+		text string
+		want Status
+		ok   bool
+	}{
+		{"score and moves", " West of House                                    Score: 0        Moves: 1",
+			Status{Text: "West of House  Score: 0  Moves: 1", Location: "West of House", Scored: true, Score: 0, Counted: true, Moves: 1}, true},
+		{"score and turns", " Cellar                                    Score: 25        Turns: 12",
+			Status{Text: "Cellar  Score: 25  Turns: 12", Location: "Cellar", Scored: true, Score: 25, Counted: true, Moves: 12}, true},
+		{"fraction", " Kitchen                                                          0/1",
+			Status{Text: "Kitchen  0/1", Location: "Kitchen", Scored: true, Score: 0, Counted: true, Moves: 1}, true},
+		{"moves only", " Kitchen                                                          12",
+			Status{Text: "Kitchen  12", Location: "Kitchen", Counted: true, Moves: 12}, true},
+		{"score only", " Kitchen                                                   Score: -5",
+			Status{Text: "Kitchen  Score: -5", Location: "Kitchen", Scored: true, Score: -5}, true},
+		{"time", " Laboratory                                                  9:05 pm",
+			Status{Text: "Laboratory  9:05 pm", Location: "Laboratory", Time: true, Hours: 21, Minutes: 5}, true},
+		{"time label", " Laboratory                                         Time: 12:05 am",
+			Status{Text: "Laboratory  Time: 12:05 am", Location: "Laboratory", Time: true, Hours: 0, Minutes: 5}, true},
+		{"multiple lines", " Kitchen                                                          0/1\n Second line",
+			Status{Text: "Kitchen  0/1  Second line", Location: "Kitchen", Scored: true, Score: 0, Counted: true, Moves: 1}, true},
+		{"unconventional", " Some Place                         whatever else", Status{Text: "Some Place  whatever else"}, false},
+		{"invalid time", " Laboratory                                                  25:61", Status{Text: "Laboratory  25:61"}, false},
+		{"single part", "Hello world", Status{Text: "Hello world"}, false},
+		{"empty", "", Status{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := parseStatus(tt.text); got != tt.want || ok != tt.ok {
+				t.Errorf("parseStatus(%q) = %+v, %v, want %+v, %v", tt.text, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSplitStatus(t *testing.T) {
+	var tests = []struct {
+		name     string
+		buf      string
+		location string
+		rest     string
+		ok       bool
+	}{
+		{"dfrotz score and moves",
+			"\n West of House                                    Score: 0        Moves: 1\n\nWest of House\nYou are standing in an open field west of a white house.\n",
+			"West of House", "West of House\nYou are standing in an open field west of a white house.\n", true},
+		{"dfrotz fraction",
+			" Kitchen                                                          0/1\n\nKitchen\nA small room.\n",
+			"Kitchen", "Kitchen\nA small room.\n", true},
+		{"dfrotz time",
+			" Laboratory                                                  9:05 pm\n\nIt is getting late.\n",
+			"Laboratory", "It is getting late.\n", true},
+		{"status line only", " Kitchen                                                          3/4", "Kitchen", "", true},
+		{"room heading", "Kitchen\nA small room.\n", "", "Kitchen\nA small room.\n", false},
+		{"padded text", "Welcome to the story.        It is dark.\nA small room.\n", "", "Welcome to the story.        It is dark.\nA small room.\n", false},
+		{"padded heading", " Chapter One                              Beginnings\n\nIt begins.\n", "", " Chapter One                              Beginnings\n\nIt begins.\n", false},
+		{"score message", "[Your score has just gone up by one point.]\n", "", "[Your score has just gone up by one point.]\n", false},
+		{"time in text", "The clock reads 9:05 pm.\n", "", "The clock reads 9:05 pm.\n", false},
+		{"empty", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, rest, ok := splitStatus([]byte(tt.buf))
+			if ok != tt.ok || st.Location != tt.location || string(rest) != tt.rest {
+				t.Errorf("splitStatus(%q) = %q, %q, %v, want %q, %q, %v", tt.buf, st.Location, rest, ok, tt.location, tt.rest, tt.ok)
+			}
+		})
+	}
+}
+
+// TestProcess is a Process producing no output, and optionally printing status lines as part of
+// output, as set.
+type testProcess struct {
+	status bool
+}
+
+func (p *testProcess) Write(buf []byte) (int, error) { return len(buf), nil }
+func (p *testProcess) Output() io.Reader             { return strings.NewReader("") }
+func (p *testProcess) Errors() io.Reader             { return nil }
+func (p *testProcess) CPUTime() time.Duration        { return 0 }
+func (p *testProcess) Close() error                  { return nil }
+func (p *testProcess) PrintsStatus() bool            { return p.status }
+
+func TestSessionOutputStatus(t *testing.T) {
+	const out = " Kitchen                                                          0/1\n\nKitchen\nA small room.\n"
+	var tests = []struct {
+		name     string
+		status   bool
+		location string
+		want     string
+	}{
+		{"printed", true, "Kitchen", "Kitchen\nA small room.\n"},
+		{"not printed", false, "", out},
+	}
+
+	// Status lines are only split from output for interpreters known to print them.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s = &Session{proc: &testProcess{status: tt.status}, output: []byte(out)}
+			if got := s.Output(); got != tt.want || s.Status().Location != tt.location {
+				t.Errorf("Output() = %q, status %q, want %q, status %q", got, s.Status().Location, tt.want, tt.location)
+			}
+		})
+	}
+}
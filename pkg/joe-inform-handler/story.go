@@ -3,71 +3,135 @@ package inform
 import (
 	// Standard library
 	"context"
-	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
-	"path"
+	"strings"
 	"time"
 
+	// Internal packages
+	"go.deuill.org/informbot/pkg/blob"
+
 	// Third-party packages
 	"github.com/pkg/errors"
 )
 
-var (
-	// Default path for Inform7 data.
-	inform7DataDir = "/usr/share/inform7/Internal"
-
-	// Default arguments for Inform 6 and 7 compilers.
-	inform7Args = []string{"--noprogress", "--internal", inform7DataDir, "--format=z8"}
-	inform6Args = []string{"-E2wSDv8F0Cud2"}
+// Story file formats supported, as targeted by the compilers.
+const (
+	FormatAuto  = ""      // Compile to Z-machine version 8, falling back to Glulx if needed.
+	FormatZ5    = "z5"    // Compile to Z-machine version 5.
+	FormatZ8    = "z8"    // Compile to Z-machine version 8.
+	FormatGlulx = "glulx" // Compile to Glulx.
 )
 
+// StoryFormat represents parameters for a specific story file format.
+type storyFormat struct {
+	extension string // The file extension for compiled story files.
+}
+
+var storyFormats = map[string]storyFormat{
+	FormatZ5:    {extension: "z5"},
+	FormatZ8:    {extension: "z8"},
+	FormatGlulx: {extension: "ulx"},
+}
+
 type Story struct {
 	Name      string    // The user-provided name for the story.
 	AuthorID  string    // The author ID, corSayTemplates to Author.ID.
 	CreatedAt time.Time // The UTC timestamp this story was first added on.
 	UpdatedAt time.Time // The UTC timestamp this story was last updated on.
 
-	// Source and compiled Z-Code for story.
-	Source []byte
-	Build  []byte
+	// The story file format requested, and the format the story was last compiled to.
+	Format      string
+	BuildFormat string
+
+	// References to the story source and compiled story file, as kept in the blob store.
+	SourceRef string `json:",omitempty"`
+	BuildRef  string `json:",omitempty"`
+
+	// Source and compiled story file, as loaded from the blob store when the story is requested.
+	Source []byte `json:"-"`
+	Build  []byte `json:"-"`
+
+	// Source and compiled story file for stories stored before the blob store was used, which are
+	// moved into the blob store the next time the author is stored.
+	LegacySource []byte `json:"Source,omitempty"`
+	LegacyBuild  []byte `json:"Build,omitempty"`
+
+	// The outcome of the last compilation attempted for the story.
+	Log *CompileLog
+
+	// The visibility level for the story, and other authors explicitly granted access to it.
+	Visibility string
+	Grants     []string
+
+	// Previous and current versions of the story source, from oldest to newest.
+	Revisions []*Revision
+
+	blobs blob.Store // The blob store story data is loaded from.
 }
 
-func (s *Story) Compile(ctx context.Context, conf *Config) error {
-	dir, err := ioutil.TempDir(os.TempDir(), fmt.Sprintf("%s-%s-%s-*", keyPrefix, s.AuthorID, s.Name))
-	if err != nil {
-		return errors.Wrap(err, "creating temporary directory failed")
-	} else if err := os.Mkdir(path.Join(dir, "Source"), 0755); err != nil {
-		return errors.Wrap(err, "creating temporary directory failed")
+// Compile builds the story source into a runnable story file, and sets the compilation log for the
+// story regardless of the outcome. A failure to compile is reported as an error, with details on any
+// problems found available in the compilation log. Any extensions given are made available to the
+// story when compiling. Stories with no explicit format set are compiled for the Z-machine, unless
+// they exceed its limits, in which case they're compiled for Glulx.
+func (s *Story) Compile(ctx context.Context, conf *Config, extensions []*Extension) error {
+	var format = s.Format
+	if format == FormatAuto {
+		format = FormatZ8
 	}
 
-	if err := ioutil.WriteFile(path.Join(dir, "Source", "story.ni"), s.Source, 0644); err != nil {
-		return errors.Wrap(err, "writing file for story failed")
+	buf, log, err := conf.Compiler.Compile(ctx, conf.Sandbox, s.Source, extensions, format)
+	if errors.Is(err, ErrStoryTooLarge) && s.Format == FormatAuto {
+		var prev = log
+		format = FormatGlulx
+		if buf, log, err = conf.Compiler.Compile(ctx, conf.Sandbox, s.Source, extensions, format); log != nil && prev != nil {
+			log.Output = prev.Output + "\n" + log.Output
+		}
 	}
 
-	// TODO: Return verbose output.
-	err = exec.CommandContext(ctx, conf.Inform7, append(inform7Args, "--project", dir)...).Run()
-	if err != nil {
-		return errors.Wrap(err, "compilation failed")
+	if log != nil {
+		s.setLog(log)
 	}
 
-	err = exec.CommandContext(ctx, conf.Inform6, append(inform6Args, path.Join(dir, "Build", "auto.inf"), path.Join(dir, "Build", "output.z8"))...).Run()
 	if err != nil {
-		return errors.Wrap(err, "compilation failed")
+		return err
 	}
 
-	buf, err := ioutil.ReadFile(path.Join(dir, "Build", "output.z8"))
-	if err != nil {
-		return errors.Wrap(err, "compilation failed")
+	s.Build, s.BuildFormat, s.UpdatedAt = buf, format, time.Now().UTC()
+	return nil
+}
+
+// SetLog sets the compilation log for the story, and records the outcome of compilation against the
+// current revision.
+func (s *Story) setLog(log *CompileLog) {
+	// Stories added before revisions were kept have their current source stored as a revision, so
+	// that the outcome of compilation can be recorded against it.
+	if s.Current() == nil && len(s.Source) > 0 {
+		s.addRevision(nil, "")
+	}
+
+	s.Log = log
+	if r := s.Current(); r != nil {
+		r.Compiled, r.Success, r.Problems = true, log.Success, len(log.Problems)
+	}
+}
+
+// SetFormat sets the story file format targeted when compiling the story.
+func (s *Story) SetFormat(format string) error {
+	if format = strings.ToLower(format); format == "auto" {
+		format = FormatAuto
+	} else if _, ok := storyFormats[format]; !ok {
+		return errors.New("story format '" + format + "' is unknown")
 	}
 
-	s.Build, s.UpdatedAt = buf, time.Now().UTC()
-	return os.RemoveAll(dir)
+	s.Format = format
+	return nil
 }
 
+// WithSource sets the source for the story, storing the source given as a new revision.
 func (s *Story) WithSource(src []byte) *Story {
+	var prev = s.Source
 	s.Source = src
+	s.addRevision(prev, "")
 	return s
 }
 
@@ -0,0 +1,65 @@
+package inform
+
+import (
+	// Standard library
+	"regexp"
+	"strings"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+)
+
+// StyleAwareAdapter is an optional interface that adapters can implement, if they support showing
+// styled text, e.g. with the formatting directives understood by clients for a chat protocol. Styled
+// story output is sent without styles for other adapters.
+type StyleAwareAdapter interface {
+	RenderStyles(spans []styling.Span) string
+}
+
+// Styles are marked in story output as an escape character, followed by the style name in square
+// brackets, and apply to all text up to the next mark. An empty style name returns to normal text.
+var styleMarkPattern = regexp.MustCompile(`\x1b\[([a-z0-9]*)\]`)
+
+// StyleMark returns the mark switching story output to the style given.
+func styleMark(style string) string {
+	if style == styling.Normal {
+		style = ""
+	}
+
+	return "\x1b[" + style + "]"
+}
+
+// HasStyles returns whether or not the story output given contains any style marks.
+func hasStyles(out string) bool {
+	return strings.Contains(out, "\x1b[")
+}
+
+// StripStyles returns the story output given with any style marks removed.
+func stripStyles(out string) string {
+	if !hasStyles(out) {
+		return out
+	}
+
+	return styleMarkPattern.ReplaceAllString(out, "")
+}
+
+// ParseSpans returns the story output given as a list of styled spans, as delimited by style marks.
+// Empty spans are omitted.
+func parseSpans(out string) []styling.Span {
+	var spans []styling.Span
+	var style, start = styling.Normal, 0
+	for _, m := range styleMarkPattern.FindAllStringSubmatchIndex(out, -1) {
+		if m[0] > start {
+			spans = append(spans, styling.Span{Style: style, Text: out[start:m[0]]})
+		}
+		if style, start = out[m[2]:m[3]], m[1]; style == "" {
+			style = styling.Normal
+		}
+	}
+
+	if start < len(out) {
+		spans = append(spans, styling.Span{Style: style, Text: out[start:]})
+	}
+
+	return spans
+}
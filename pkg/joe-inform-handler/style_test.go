@@ -0,0 +1,97 @@
+package inform
+
+import (
+	// Standard library
+	"reflect"
+	"strings"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+)
+
+func TestParseSpans(t *testing.T) {
+	var tests = []struct {
+		name string
+		out  string
+		want []styling.Span
+	}{
+		{"empty", "", nil},
+		{"unstyled", "A small room.", []styling.Span{{Style: styling.Normal, Text: "A small room."}}},
+		{"styled", "\x1b[header]Kitchen\x1b[]\nA \x1b[emphasized]small\x1b[] room.", []styling.Span{
+			{Style: styling.Header, Text: "Kitchen"},
+			{Style: styling.Normal, Text: "\nA "},
+			{Style: styling.Emphasized, Text: "small"},
+			{Style: styling.Normal, Text: " room."},
+		}},
+		{"leading style", "\x1b[alert]Careful!", []styling.Span{{Style: styling.Alert, Text: "Careful!"}}},
+		{"empty spans", "\x1b[header]\x1b[note]Note\x1b[]", []styling.Span{{Style: styling.Note, Text: "Note"}}},
+		{"explicit normal", "\x1b[normal]Text", []styling.Span{{Style: styling.Normal, Text: "Text"}}},
+		{"unknown mark", "\x1b[Header]Text", []styling.Span{{Style: styling.Normal, Text: "\x1b[Header]Text"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSpans(tt.out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSpans(%q) = %+v, want %+v", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripStyles(t *testing.T) {
+	var tests = []struct {
+		out, want string
+	}{
+		{"", ""},
+		{"A small room.", "A small room."},
+		{"\x1b[header]Kitchen\x1b[]\nA \x1b[emphasized]small\x1b[] room.", "Kitchen\nA small room."},
+	}
+
+	for _, tt := range tests {
+		if got := stripStyles(tt.out); got != tt.want {
+			t.Errorf("stripStyles(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+// RenderMarks renders styled text with style names in brackets, for checking the spans passed to
+// adapters.
+func renderMarks(spans []styling.Span) string {
+	var buf strings.Builder
+	for _, s := range spans {
+		if s.Style == styling.Normal {
+			buf.WriteString(s.Text)
+		} else {
+			buf.WriteString("[" + s.Style + ":" + s.Text + "]")
+		}
+	}
+
+	return buf.String()
+}
+
+func TestFormatOutput(t *testing.T) {
+	var tests = []struct {
+		name   string
+		style  string
+		render func([]styling.Span) string
+		out    string
+		want   string
+	}{
+		{"plain", OutputPlain, renderMarks, "\x1b[header]Kitchen\x1b[]\nA small room.\n", "Kitchen\nA small room.\n"},
+		{"monospace", OutputMonospace, renderMarks, "\n\x1b[header]Kitchen\x1b[]\nA small room.\n", "```\nKitchen\nA small room.\n```"},
+		{"styled", OutputStyled, renderMarks, "\x1b[header]Kitchen\x1b[]\nA small room.", "[header:Kitchen]\nA small room."},
+		{"styled headings", OutputStyled, renderMarks, "Kitchen\nA small room.\n\nYou see a Box.", "[header:Kitchen]\nA small room.\n\nYou see a Box."},
+		{"styled fallback", OutputStyled, styling.Text, "\x1b[header]Kitchen\x1b[]\nA small room.", "Kitchen\nA small room."},
+		{"unknown", "bogus", renderMarks, "\x1b[header]Kitchen\x1b[]", "Kitchen"},
+		{"blank", OutputMonospace, renderMarks, "\x1b[header]\x1b[]\n", "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatOutput(tt.style, tt.render, tt.out); got != tt.want {
+				t.Errorf("formatOutput(%q, %q) = %q, want %q", tt.style, tt.out, got, tt.want)
+			}
+		})
+	}
+}
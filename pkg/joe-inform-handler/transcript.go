@@ -0,0 +1,457 @@
+package inform
+
+import (
+	// Standard library
+	"bytes"
+	htmltemplate "html/template"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"github.com/pkg/errors"
+)
+
+// The maximum number of commands recorded in a single transcript, after which recording stops.
+const maxTranscriptEntries = 1000
+
+// The maximum length for transcripts shown, in bytes, past which only the earliest commands recorded
+// are shown.
+const maxTranscriptLength = 32 * 1024
+
+// Transcript export formats supported.
+const (
+	TranscriptText     = "text"
+	TranscriptMarkdown = "markdown"
+	TranscriptHTML     = "html"
+)
+
+// Transcript represents a record of commands given to a story during a session, along with the
+// responses produced, as recorded with 'script' and stopped with 'unscript'. Transcripts are stored
+// as small index records, apart from their entries, which are stored separately for each command
+// and only loaded when needed.
+type Transcript struct {
+	Number    int       // The transcript number, increasing with every transcript recorded for a story.
+	AuthorID  string    // The author ID, corresponds to Author.ID.
+	Story     string    // The story name, corresponds to Story.Name.
+	CreatedAt time.Time // The UTC timestamp recording started on.
+	UpdatedAt time.Time // The UTC timestamp the last command was recorded on.
+	Turns     int       // The number of commands recorded.
+
+	Entries []*TranscriptEntry `json:"-"` // The entries recorded, as loaded by loadTranscriptEntries.
+}
+
+// TranscriptEntry represents a single command given to a story, along with the response produced.
+type TranscriptEntry struct {
+	Command   string
+	Response  string
+	CreatedAt time.Time
+}
+
+// Add counts the command and response given as the next entry for the transcript, and returns the
+// entry, or an error if the transcript is full.
+func (t *Transcript) add(cmd, response string) (*TranscriptEntry, error) {
+	if t.Turns >= maxTranscriptEntries {
+		return nil, errors.Errorf("transcript is limited to %d commands", maxTranscriptEntries)
+	}
+
+	t.UpdatedAt = time.Now().UTC()
+	t.Turns++
+
+	return &TranscriptEntry{Command: cmd, Response: strings.TrimSpace(response), CreatedAt: t.UpdatedAt}, nil
+}
+
+// Export returns the transcript in the format given, defaulting to plain text.
+func (t *Transcript) Export(format string) (string, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch strings.ToLower(format) {
+	case "", TranscriptText, "txt":
+		err = transcriptTextTemplate.Execute(&buf, t)
+	case TranscriptMarkdown, "md":
+		err = transcriptMarkdownTemplate.Execute(&buf, t)
+	case TranscriptHTML:
+		err = transcriptHTMLTemplate.Execute(&buf, t)
+	default:
+		return "", errors.New("transcript format '" + format + "' is unknown")
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "exporting transcript failed")
+	}
+
+	return buf.String(), nil
+}
+
+var transcriptTextTemplate = template.Must(template.New("transcript-text").Parse(`
+Transcript {{.Number}} for story '{{.Story}}', recorded on {{.CreatedAt.Format "Mon, 02 Jan 2006 15:04 MST"}}.
+{{range .Entries}}
+> {{.Command}}
+{{.Response}}
+{{end}}`))
+
+// Responses are placed in code blocks fenced with more backticks than found in the response itself,
+// so that code blocks aren't closed early by responses containing backticks.
+var transcriptMarkdownTemplate = template.Must(template.New("transcript-markdown").Funcs(template.FuncMap{
+	"fence": markdownFence,
+}).Parse(`
+# Transcript {{.Number}} for story '{{.Story}}'
+
+Recorded on {{.CreatedAt.Format "Mon, 02 Jan 2006 15:04 MST"}}, with {{.Turns}} command(s).
+{{range .Entries}}
+**> {{.Command}}**
+
+{{fence .Response}}
+{{.Response}}
+{{fence .Response}}
+{{end}}`))
+
+// MarkdownFence returns the fence used for Markdown code blocks containing the text given, which is
+// made up of at least three backticks, and at least one more than the longest run of backticks in
+// the text.
+func markdownFence(text string) string {
+	var longest, run int
+	for _, r := range text {
+		if r != '`' {
+			run = 0
+		} else if run++; run > longest {
+			longest = run
+		}
+	}
+
+	if longest < 3 {
+		return "```"
+	}
+
+	return strings.Repeat("`", longest+1)
+}
+
+var transcriptHTMLTemplate = htmltemplate.Must(htmltemplate.New("transcript-html").Parse(`
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Transcript {{.Number}} for story '{{.Story}}'</title>
+</head>
+<body>
+<h1>Transcript {{.Number}} for story '{{.Story}}'</h1>
+<p>Recorded on {{.CreatedAt.Format "Mon, 02 Jan 2006 15:04 MST"}}, with {{.Turns}} command(s).</p>
+{{- range .Entries}}
+<p><strong>&gt; {{.Command}}</strong></p>
+<pre>{{.Response}}</pre>
+{{- end}}
+</body>
+</html>`))
+
+// TranscriptKey returns the key used for storing the transcript with the given number for a story.
+func transcriptKey(authorID, story string, num int) string {
+	return transcriptPrefix(authorID, story) + strconv.Itoa(num)
+}
+
+// TranscriptPrefix returns the prefix for keys used in storing transcripts for a story.
+func transcriptPrefix(authorID, story string) string {
+	return keyPrefix + ".transcript." + keyPart(authorID) + "." + keyPart(story) + "."
+}
+
+// TranscriptEntryKey returns the key used for storing the entry for the given turn, as numbered from
+// one, in the transcript with the given number for a story.
+func transcriptEntryKey(authorID, story string, num, turn int) string {
+	return keyPrefix + ".transcript-entry." + keyPart(authorID) + "." + keyPart(story) + "." + strconv.Itoa(num) + "." + strconv.Itoa(turn)
+}
+
+// NewTranscript returns an empty transcript for the given author and story, numbered after any
+// transcripts already stored.
+func newTranscript(store *joe.Storage, authorID, story string) (*Transcript, error) {
+	list, err := listTranscripts(store, authorID, story)
+	if err != nil {
+		return nil, err
+	}
+
+	var num = 1
+	if len(list) > 0 {
+		num = list[len(list)-1].Number + 1
+	}
+
+	return &Transcript{
+		Number:    num,
+		AuthorID:  authorID,
+		Story:     story,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// StoreTranscript persists the index record for the given transcript to the store, replacing any
+// previous version of it. Entries are stored separately, with storeTranscriptEntry.
+func storeTranscript(store *joe.Storage, t *Transcript) error {
+	return store.Set(transcriptKey(t.AuthorID, t.Story, t.Number), t)
+}
+
+// StoreTranscriptEntry persists the entry given as the latest turn for the transcript given.
+func storeTranscriptEntry(store *joe.Storage, t *Transcript, e *TranscriptEntry) error {
+	return store.Set(transcriptEntryKey(t.AuthorID, t.Story, t.Number, t.Turns), e)
+}
+
+// LoadTranscriptEntries loads all entries recorded for the transcript given, skipping any entries not
+// found, e.g. where the bot was stopped while recording.
+func loadTranscriptEntries(store *joe.Storage, t *Transcript) error {
+	t.Entries = make([]*TranscriptEntry, 0, t.Turns)
+	for turn := 1; turn <= t.Turns; turn++ {
+		var e = &TranscriptEntry{}
+		if ok, err := store.Get(transcriptEntryKey(t.AuthorID, t.Story, t.Number, turn), e); err != nil {
+			return errors.Wrap(err, "loading transcript failed")
+		} else if ok {
+			t.Entries = append(t.Entries, e)
+		}
+	}
+
+	return nil
+}
+
+// LoadTranscript returns the transcript with the given number for the given author and story, or the
+// latest transcript stored, if the number given is zero.
+func loadTranscript(store *joe.Storage, authorID, story string, num int) (*Transcript, error) {
+	if num == 0 {
+		list, err := listTranscripts(store, authorID, story)
+		if err != nil {
+			return nil, err
+		} else if len(list) == 0 {
+			return nil, errors.New("no transcripts recorded for story '" + story + "'")
+		}
+		num = list[len(list)-1].Number
+	}
+
+	var t = &Transcript{}
+	if ok, err := store.Get(transcriptKey(authorID, story, num), t); err != nil {
+		return nil, errors.Wrap(err, "loading transcript failed")
+	} else if !ok || t.AuthorID != authorID || t.Story != story {
+		return nil, errors.Errorf("no transcript %d found for story '%s'", num, story)
+	}
+
+	return t, nil
+}
+
+// ListTranscripts returns all transcripts stored for the given author and story, ordered by number.
+// Only index records are loaded, as entries aren't needed for listing.
+func listTranscripts(store *joe.Storage, authorID, story string) ([]*Transcript, error) {
+	keys, err := store.Keys()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing transcripts failed")
+	}
+
+	var list []*Transcript
+	var prefix = transcriptPrefix(authorID, story)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		var t = &Transcript{}
+		if ok, err := store.Get(k, t); err != nil {
+			return nil, errors.Wrap(err, "listing transcripts failed")
+		} else if !ok || t.AuthorID != authorID || t.Story != story {
+			continue
+		}
+
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Number < list[j].Number
+	})
+
+	return list, nil
+}
+
+// RemoveTranscripts removes all transcripts stored for the given author and story.
+func removeTranscripts(store *joe.Storage, authorID, story string) error {
+	list, err := listTranscripts(store, authorID, story)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range list {
+		for turn := 1; turn <= t.Turns; turn++ {
+			if _, err := store.Delete(transcriptEntryKey(authorID, story, t.Number, turn)); err != nil {
+				return errors.Wrap(err, "removing transcript failed")
+			}
+		}
+		if _, err := store.Delete(transcriptKey(authorID, story, t.Number)); err != nil {
+			return errors.Wrap(err, "removing transcript failed")
+		}
+	}
+
+	return nil
+}
+
+// RemoveStoryTranscripts removes transcripts stored by any author for the given story, as is the
+// case for stories shared by other authors, which are recorded under their full reference.
+func removeStoryTranscripts(store *joe.Storage, story string) error {
+	keys, err := store.Keys()
+	if err != nil {
+		return errors.Wrap(err, "removing transcripts failed")
+	}
+
+	var authors = make(map[string]bool)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, keyPrefix+".transcript.") {
+			continue
+		}
+
+		var t = &Transcript{}
+		if ok, err := store.Get(k, t); err != nil {
+			return errors.Wrap(err, "removing transcripts failed")
+		} else if ok && t.Story == story {
+			authors[t.AuthorID] = true
+		}
+	}
+
+	for authorID := range authors {
+		if err := removeTranscripts(store, authorID, story); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TranscriptList represents the data passed to the transcript list template.
+type transcriptList struct {
+	Story       string
+	Transcripts []*Transcript
+}
+
+// ShowTranscript sends the transcript for the story given, as selected by the arguments given, to the
+// channel given. Arguments are an optional transcript number, defaulting to the latest transcript,
+// and an optional export format, defaulting to plain text.
+func (n *Inform) ShowTranscript(channel string, author *Author, story *Story, args []string) error {
+	var num int
+	if len(args) > 0 {
+		if v, err := strconv.Atoi(args[0]); err == nil && v > 0 {
+			num, args = v, args[1:]
+		}
+	}
+
+	var format string
+	if len(args) > 0 {
+		format = args[0]
+	}
+
+	t, err := loadTranscript(n.bot.Store, author.ID, saveStoryName(story, author.ID), num)
+	if err != nil {
+		n.Say(channel, messageInvalidTranscript, err)
+		return nil
+	} else if err = loadTranscriptEntries(n.bot.Store, t); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	// Times are shown in the time zone set for the author, but stored in UTC.
+	t.CreatedAt = t.CreatedAt.In(author.Options.Location())
+
+	out, shown, err := exportTranscript(t, format, maxTranscriptLength)
+	if err != nil {
+		n.Say(channel, messageInvalidTranscript, err)
+		return nil
+	}
+
+	n.bot.Say(channel, out)
+	if shown < len(t.Entries) {
+		n.Say(channel, messageTruncatedTranscript, shown, len(t.Entries))
+	}
+
+	return nil
+}
+
+// ExportTranscript returns the transcript given in the format given, limited to the number of entries
+// that fit within the length given, along with the number of entries exported. The first entry is
+// always exported, regardless of its length.
+func exportTranscript(t *Transcript, format string, limit int) (string, int, error) {
+	out, err := t.Export(format)
+	if err != nil || len(out) <= limit {
+		return out, len(t.Entries), err
+	}
+
+	// Find the largest number of entries that fit, as exported, within the limit given.
+	var entries = t.Entries
+	defer func() { t.Entries = entries }()
+
+	var shown = sort.Search(len(entries), func(i int) bool {
+		t.Entries = entries[:i+1]
+		out, err := t.Export(format)
+		return err != nil || len(out) > limit
+	})
+
+	if shown == 0 {
+		shown = 1
+	}
+
+	t.Entries = entries[:shown]
+	out, err = t.Export(format)
+
+	return out, shown, err
+}
+
+// StartTranscript starts recording commands given to the session, and their responses, into a new
+// transcript, stored against the session owner.
+func (n *Inform) StartTranscript(channel string, sess *Session) error {
+	if sess.transcript != nil {
+		n.Say(channel, messageInvalidTranscript, errors.Errorf("transcript %d is already being recorded", sess.transcript.Number))
+		return nil
+	}
+
+	t, err := newTranscript(n.bot.Store, sess.owner, sess.saveStory())
+	if err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	} else if err = storeTranscript(n.bot.Store, t); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	}
+
+	sess.transcript = t
+	n.Say(channel, messageStartedTranscript, t.Number, sess.story.Name)
+
+	return n.Checkpoint(sess)
+}
+
+// StopTranscript stops recording the transcript for the session.
+func (n *Inform) StopTranscript(channel string, sess *Session) error {
+	if sess.transcript == nil {
+		n.Say(channel, messageInvalidTranscript, "no transcript is being recorded")
+		return nil
+	}
+
+	var t = sess.transcript
+	sess.transcript = nil
+
+	n.Say(channel, messageStoppedTranscript, t.Number, t.Turns, sess.saveStory())
+	return n.Checkpoint(sess)
+}
+
+// RecordTranscript adds the command and response given to any transcript being recorded for the
+// session, stopping recording if the transcript is full.
+func (n *Inform) recordTranscript(channel string, sess *Session, cmd, response string) error {
+	var t = sess.transcript
+	if t == nil {
+		return nil
+	}
+
+	e, err := t.add(cmd, response)
+	if err != nil {
+		sess.transcript = nil
+		n.Say(channel, messageInvalidTranscript, errors.Wrap(err, "recording stopped"))
+		return nil
+	}
+
+	// Only the entry for the command given is added, along with the updated index record.
+	if err = storeTranscriptEntry(n.bot.Store, t, e); err != nil {
+		return err
+	}
+
+	return storeTranscript(n.bot.Store, t)
+}
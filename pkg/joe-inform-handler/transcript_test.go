@@ -0,0 +1,107 @@
+package inform
+
+import (
+	// Standard library
+	"encoding/json"
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-bolt-memory"
+
+	// Third-party packages
+	"github.com/go-joe/joe"
+	"go.uber.org/zap"
+)
+
+func TestTranscriptKey(t *testing.T) {
+	// Author IDs and story names containing separators don't produce matching keys.
+	if a, b := transcriptKey("a@x.com", "y.z", 1), transcriptKey("a@x.com.y", "z", 1); a == b {
+		t.Errorf("transcriptKey() = %q for different authors and stories", a)
+	} else if a, b := transcriptEntryKey("a@x.com", "y.z", 1, 1), transcriptEntryKey("a@x.com.y", "z", 1, 1); a == b {
+		t.Errorf("transcriptEntryKey() = %q for different authors and stories", a)
+	}
+}
+
+func TestLoadTranscript(t *testing.T) {
+	var store = joe.NewStorage(zap.NewNop())
+	var tr = &Transcript{Number: 1, AuthorID: "a@x.com", Story: "y.z", Turns: 1}
+	if err := storeTranscript(store, tr); err != nil {
+		t.Fatalf("storeTranscript() error = %v", err)
+	}
+
+	if got, err := loadTranscript(store, "a@x.com", "y.z", 0); err != nil || got.Number != 1 {
+		t.Errorf("loadTranscript() = %+v, %v, want stored transcript", got, err)
+	} else if _, err := loadTranscript(store, "a@x.com.y", "z", 1); err == nil {
+		t.Errorf("loadTranscript() error = nil for other author, want error")
+	}
+
+	// Transcripts stored under keys not matching their author or story are not loaded.
+	if err := store.Set(transcriptKey("b@x.com", "y.z", 1), tr); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	} else if _, err := loadTranscript(store, "b@x.com", "y.z", 1); err == nil {
+		t.Errorf("loadTranscript() error = nil for transcript stored by other author, want error")
+	}
+}
+
+func TestRemoveStoryTranscripts(t *testing.T) {
+	var store = joe.NewStorage(zap.NewNop())
+	for _, tr := range []*Transcript{
+		{Number: 1, AuthorID: "b@x.com", Story: "a@x.com/y", Turns: 1},
+		{Number: 1, AuthorID: "c@x.com", Story: "a@x.com/z"},
+	} {
+		if err := storeTranscript(store, tr); err != nil {
+			t.Fatalf("storeTranscript() error = %v", err)
+		}
+	}
+
+	if err := store.Set(transcriptEntryKey("b@x.com", "a@x.com/y", 1, 1), &TranscriptEntry{}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	} else if err := removeStoryTranscripts(store, "a@x.com/y"); err != nil {
+		t.Fatalf("removeStoryTranscripts() error = %v", err)
+	} else if keys, err := store.Keys(); err != nil || len(keys) != 1 || keys[0] != transcriptKey("c@x.com", "a@x.com/z", 1) {
+		t.Errorf("Keys() = %q, %v, want transcript for other story only", keys, err)
+	}
+}
+
+func TestMigrateTranscriptKeys(t *testing.T) {
+	// Transcripts recorded before entries were stored separately are migrated to escaped keys too.
+	var records = map[string][]byte{
+		keyPrefix + ".transcript.a@x.com.y.z.1":         []byte(`{"Number":1,"AuthorID":"a@x.com","Story":"y.z","Turns":2}`),
+		keyPrefix + ".transcript-entry.a@x.com.y.z.1.1": []byte(`{"Command":"look"}`),
+		keyPrefix + ".transcript-entry.a@x.com.y.z.1.2": []byte(`{"Command":"wait"}`),
+		keyPrefix + ".transcript.b@x.com.w.2":           []byte(`{"Number":2,"AuthorID":"b@x.com","Story":"w","Entries":[{"Command":"jump"}]}`),
+	}
+
+	s, err := bolt.NewStore(t.TempDir()+"/store.db", bolt.WithMigrations(Migrations...))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	defer s.Close()
+	if err := s.Import(records); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	var want = map[string]string{
+		transcriptKey("a@x.com", "y.z", 1):         "",
+		transcriptEntryKey("a@x.com", "y.z", 1, 1): "look",
+		transcriptEntryKey("a@x.com", "y.z", 1, 2): "wait",
+		transcriptKey("b@x.com", "w", 2):           "",
+		transcriptEntryKey("b@x.com", "w", 2, 1):   "jump",
+	}
+
+	if keys, err := s.Keys(); err != nil || len(keys) != len(want) {
+		t.Errorf("Keys() = %q, %v, want %d keys", keys, err, len(want))
+	}
+
+	for key, command := range want {
+		var entry TranscriptEntry
+		if value, ok, err := s.Get(key); err != nil || !ok {
+			t.Errorf("Get(%q) = %v, %v, want record", key, ok, err)
+		} else if command == "" {
+			continue
+		} else if err = json.Unmarshal(value, &entry); err != nil || entry.Command != command {
+			t.Errorf("Get(%q) = %+v, %v, want command %q", key, entry, err, command)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package inform
+
+import (
+	// Standard library
+	"context"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-attachment"
+)
+
+// Default limits for story sources sent as attachments, or fetched from URLs.
+const (
+	defaultMaxSourceSize = 4 << 20 // 4MiB
+	defaultUploadTimeout = 10 * time.Minute
+)
+
+// Upload represents a file waiting to be sent as an attachment, either the source file for a story,
+// as requested with 'story add <name>', or an extension, as requested with 'extension add'.
+type upload struct {
+	story     string    // The name of the story to add, for story uploads.
+	extension bool      // Whether or not the upload is for an extension.
+	shared    bool      // Whether or not the extension is to be shared with all authors.
+	expires   time.Time // The time after which the upload is no longer expected.
+}
+
+// ExpectUpload records that the author given is about to send the file described, replacing any
+// upload previously expected.
+func (n *Inform) expectUpload(authorID string, u *upload, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	u.expires = now.Add(n.config.UploadTimeout)
+	n.uploads[authorID] = u
+}
+
+// TakeUpload returns and removes the upload expected for the author given, if any, and if it has not
+// yet expired.
+func (n *Inform) takeUpload(authorID string, now time.Time) *upload {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var u = n.uploads[authorID]
+	if delete(n.uploads, authorID); u == nil || now.After(u.expires) {
+		return nil
+	}
+
+	return u
+}
+
+// FetchUpload fetches the file described from the attachment given, and adds it for the author
+// given, either as the source for a story, or as an extension. Callers are expected to hold the data
+// lock, which is released while the file is fetched, so that slow hosts hold up neither compilation
+// nor other changes; the author is loaded again once the file is fetched, as it may have changed in
+// the meantime.
+func (n *Inform) FetchUpload(ctx context.Context, channel string, author *Author, u *upload, file attachment.Attachment) error {
+	n.dataMu.Unlock()
+	source, err := file.Fetch(ctx, n.config.MaxSourceSize)
+	n.dataMu.Lock()
+
+	if err != nil && u.extension {
+		n.Say(channel, messageInvalidExtension, err)
+		return nil
+	} else if err != nil {
+		n.Say(channel, messageInvalidStory, err)
+		return nil
+	} else if author, err = n.loadAuthor(author.ID); err != nil {
+		n.Say(channel, messageUnknownError)
+		return err
+	} else if u.extension {
+		return n.AddExtension(channel, author, source, u.shared)
+	}
+
+	return n.AddStory(channel, author, u.story, source)
+}
@@ -0,0 +1,64 @@
+package inform
+
+import (
+	// Standard library
+	"fmt"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Default values for per-turn budgets, used where no explicit values are set in configuration.
+const (
+	defaultTurnTimeout  = 10 * time.Second
+	defaultTurnCPULimit = 5 * time.Second
+)
+
+// The interval at which resource usage is checked during a turn.
+const turnPollInterval = 10 * time.Millisecond
+
+// TurnError represents a failure to complete a turn within the configured time or CPU budget, and
+// contains the command that caused it.
+type TurnError struct {
+	Command string // The command given for the turn.
+	Reason  string // The budget exceeded.
+}
+
+func (e *TurnError) Error() string {
+	return fmt.Sprintf("command '%s' %s", e.Command, e.Reason)
+}
+
+// Await waits for the interpreter to produce a complete response, as delimited by an input prompt.
+// A TurnError is returned if the interpreter exceeds its time or CPU budget before prompting for
+// input, in which case the interpreter is expected to be stopped by the caller.
+func (s *Session) await(cmd string) ([]byte, error) {
+	var start, cpuStart = time.Now(), s.cpuTime()
+	var ticker = time.NewTicker(turnPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case resp, ok := <-s.reader.responses:
+			if !ok {
+				return nil, errors.New("interpreter stopped unexpectedly")
+			}
+			return resp, nil
+		case now := <-ticker.C:
+			if s.conf.TurnTimeout > 0 && now.Sub(start) > s.conf.TurnTimeout {
+				return s.reader.flush(), &TurnError{Command: cmd, Reason: "took too long to complete"}
+			} else if s.conf.TurnCPULimit > 0 && s.cpuTime()-cpuStart > s.conf.TurnCPULimit {
+				return s.reader.flush(), &TurnError{Command: cmd, Reason: "used too much processing time"}
+			}
+		}
+	}
+}
+
+// CPUTime returns the total CPU time used by the interpreter process, or zero if this is unknown.
+func (s *Session) cpuTime() time.Duration {
+	if s.proc == nil {
+		return 0
+	}
+
+	return s.proc.CPUTime()
+}
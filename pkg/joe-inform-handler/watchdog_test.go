@@ -0,0 +1,51 @@
+package inform
+
+import (
+	// Standard library
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// PipeProcess is a Process with output and errors written through pipes, for checking how turns end.
+type pipeProcess struct {
+	out, errs *io.PipeReader
+}
+
+func (p *pipeProcess) Write(buf []byte) (int, error) { return len(buf), nil }
+func (p *pipeProcess) Output() io.Reader             { return p.out }
+func (p *pipeProcess) Errors() io.Reader             { return p.errs }
+func (p *pipeProcess) CPUTime() time.Duration        { return 0 }
+func (p *pipeProcess) Close() error                  { p.out.Close(); p.errs.Close(); return nil }
+
+func TestAwait(t *testing.T) {
+	out, outw := io.Pipe()
+	errs, errsw := io.Pipe()
+
+	var proc = &pipeProcess{out: out, errs: errs}
+	var sess = &Session{proc: proc, conf: &Config{TurnTimeout: 200 * time.Millisecond}}
+	sess.reader = newOutputReader(proc.Output(), proc.Errors())
+	defer proc.Close()
+
+	// Turns end once a prompt is printed, with any errors printed alongside collected.
+	go func() {
+		errsw.Write([]byte("Warning\n"))
+		outw.Write([]byte("A small room.\n"))
+		outw.Write([]byte("\n>"))
+	}()
+
+	if resp, err := sess.await("look"); err != nil || string(resp) != "A small room.\n\n>" {
+		t.Errorf("await() = %q, %v, want response ending in prompt", resp, err)
+	} else if err = sess.Error(); err == nil || err.Error() != "Warning: " {
+		t.Errorf("Error() = %v, want 'Warning: '", err)
+	}
+
+	// Output not followed by a prompt is not taken as a complete response.
+	go outw.Write([]byte("Press any key."))
+
+	var turnErr *TurnError
+	if resp, err := sess.await("wait"); !errors.As(err, &turnErr) || string(resp) != "Press any key." {
+		t.Errorf("await() = %q, %v, want partial response and turn error", resp, err)
+	}
+}
@@ -0,0 +1,200 @@
+package inform
+
+import (
+	// Standard library
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/sandbox"
+	"go.deuill.org/informbot/pkg/zmachine"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// ZMachineInterpreter runs Z-machine stories in-process, using the interpreter in package zmachine,
+// and requires no external executables. Stories have no access to the host, apart from save files
+// in the session directory, and the sandbox policy given is thus not applied.
+type ZMachineInterpreter struct {
+	ScreenWidth int // The width of the screen presented to stories, in characters.
+}
+
+// Start runs the story file given in a background goroutine.
+func (z *ZMachineInterpreter) Start(ctx context.Context, _ sandbox.Policy, dir, story string) (Process, error) {
+	buf, err := ioutil.ReadFile(story)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading story file failed")
+	}
+
+	var in = newInputBuffer()
+	var out, w = io.Pipe()
+
+	m, err := zmachine.New(buf, zmachine.Config{
+		Input:       in,
+		Output:      w,
+		SaveFile:    func(name string, data []byte) error { return writeSessionFile(dir, name, data) },
+		RestoreFile: func(name string) ([]byte, error) { return readSessionFile(dir, name) },
+		SaveName:    sessionSaveFile,
+		ScreenWidth: z.ScreenWidth,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var p = &zmachineProcess{machine: m, in: in, out: out, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		if err := m.Run(); err != nil && err != zmachine.ErrStopped {
+			fmt.Fprintf(w, "\n[Fatal error: %s]\n", err)
+		}
+		w.Close()
+	}()
+
+	// Stop the story when the context given is cancelled, as for external interpreter processes.
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Close()
+		case <-p.done:
+		}
+	}()
+
+	return p, nil
+}
+
+// ZMachineProcess represents a story running under the built-in Z-machine interpreter.
+type zmachineProcess struct {
+	machine *zmachine.Machine
+	in      *inputBuffer
+	out     *io.PipeReader
+	done    chan struct{} // Closed when the story stops running.
+}
+
+func (p *zmachineProcess) Write(buf []byte) (int, error) {
+	return p.in.Write(buf)
+}
+
+func (p *zmachineProcess) Output() io.Reader {
+	return p.out
+}
+
+func (p *zmachineProcess) Errors() io.Reader {
+	return nil
+}
+
+// CPUTime returns the time spent running the story, excluding time spent waiting for input.
+func (p *zmachineProcess) CPUTime() time.Duration {
+	return p.machine.CPUTime()
+}
+
+// Status returns the status line, as kept by the interpreter for version 3 stories, or as printed
+// to the upper window by stories for later versions.
+func (p *zmachineProcess) Status() Status {
+	var st = p.machine.Status()
+	if st.Location == "" {
+		st, _ := parseStatus(st.Text)
+		return st
+	}
+
+	return Status{
+		Text:     st.Text,
+		Location: st.Location,
+		Scored:   !st.Time,
+		Score:    st.Score,
+		Counted:  !st.Time,
+		Moves:    st.Moves,
+		Time:     st.Time,
+		Hours:    st.Hours,
+		Minutes:  st.Minutes,
+	}
+}
+
+// Close stops the story, waiting for it to stop running.
+func (p *zmachineProcess) Close() error {
+	p.machine.Stop()
+	p.in.Close()
+	p.out.Close()
+	<-p.done
+	return nil
+}
+
+// InputBuffer is an io.Reader that returns data given to Write, blocking until data is available, or
+// the buffer is closed. Unlike io.Pipe, writes never block, and input can be given to stories that
+// are not currently waiting for input.
+type inputBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	closed bool
+}
+
+func (b *inputBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for len(b.buf) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+
+	if len(b.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	var n = copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+func (b *inputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	b.buf = append(b.buf, p...)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+func (b *inputBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+	return nil
+}
+
+func newInputBuffer() *inputBuffer {
+	var b = &inputBuffer{}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// WriteSessionFile writes a file with the name given to the session directory given, ignoring any
+// directory components in the name.
+func writeSessionFile(dir, name string, data []byte) error {
+	if name = filepath.Base(name); name == "." || name == ".." || name == string(filepath.Separator) {
+		return errors.New("invalid file name")
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+}
+
+// ReadSessionFile reads a file with the name given from the session directory given, ignoring any
+// directory components in the name.
+func readSessionFile(dir, name string) ([]byte, error) {
+	if name = filepath.Base(name); name == "." || name == ".." || name == string(filepath.Separator) {
+		return nil, errors.New("invalid file name")
+	}
+
+	return ioutil.ReadFile(filepath.Join(dir, name))
+}
@@ -0,0 +1,77 @@
+// Package styling implements a generic representation of styled text, as passed from Joe handlers to
+// adapters.
+//
+// Text is given as a list of spans, each shown in a single style. Adapters supporting styled text
+// render spans into text formatted for their chat protocol, while text for other adapters is shown
+// without styles, as returned by the Text function.
+package styling
+
+import (
+	// Standard library
+	"strings"
+)
+
+// Styles for text, as named in the Glk specification.
+const (
+	Normal       = "normal"
+	Emphasized   = "emphasized"
+	Preformatted = "preformatted"
+	Header       = "header"
+	Subheader    = "subheader"
+	Alert        = "alert"
+	Note         = "note"
+	BlockQuote   = "blockquote"
+	Input        = "input"
+	User1        = "user1"
+	User2        = "user2"
+)
+
+// Span represents a run of text in a single style.
+type Span struct {
+	Style string // The style the text is shown in, one of the style constants.
+	Text  string // The text shown, which may span multiple lines.
+}
+
+// Text returns the text for the spans given, without any styles applied.
+func Text(spans []Span) string {
+	var buf strings.Builder
+	for _, s := range spans {
+		buf.WriteString(s.Text)
+	}
+
+	return buf.String()
+}
+
+// Lines returns the spans given as a list of lines, each holding the spans shown on that line. Empty
+// spans are omitted, and blank lines have no spans.
+func Lines(spans []Span) [][]Span {
+	var lines = [][]Span{nil}
+	for _, s := range spans {
+		for i, text := range strings.Split(s.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+			}
+			if text != "" {
+				lines[len(lines)-1] = append(lines[len(lines)-1], Span{Style: s.Style, Text: text})
+			}
+		}
+	}
+
+	return lines
+}
+
+// LineStyle returns the style shared by all non-blank spans in the line given, or an empty string if
+// spans are styled differently, or the line is blank.
+func LineStyle(line []Span) string {
+	var style string
+	for _, s := range line {
+		if strings.TrimSpace(s.Text) == "" {
+			continue
+		} else if style != "" && style != s.Style {
+			return ""
+		}
+		style = s.Style
+	}
+
+	return style
+}
@@ -0,0 +1,63 @@
+package styling
+
+import (
+	// Standard library
+	"reflect"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	var spans = []Span{{Style: Header, Text: "Kitchen"}, {Style: Normal, Text: "\nA "}, {Style: Emphasized, Text: "small"}}
+	if got, want := Text(spans), "Kitchen\nA small"; got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	} else if got := Text(nil); got != "" {
+		t.Errorf("Text(nil) = %q, want empty", got)
+	}
+}
+
+func TestLines(t *testing.T) {
+	var tests = []struct {
+		name  string
+		spans []Span
+		want  [][]Span
+	}{
+		{"empty", nil, [][]Span{nil}},
+		{"single line", []Span{{Style: Header, Text: "Kitchen"}}, [][]Span{{{Style: Header, Text: "Kitchen"}}}},
+		{"split spans", []Span{{Style: Header, Text: "Kitchen\n"}, {Style: Normal, Text: "A "}, {Style: Emphasized, Text: "small\n\nroom"}}, [][]Span{
+			{{Style: Header, Text: "Kitchen"}},
+			{{Style: Normal, Text: "A "}, {Style: Emphasized, Text: "small"}},
+			nil,
+			{{Style: Emphasized, Text: "room"}},
+		}},
+		{"trailing new-line", []Span{{Style: Normal, Text: "Text\n"}}, [][]Span{{{Style: Normal, Text: "Text"}}, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.spans); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineStyle(t *testing.T) {
+	var tests = []struct {
+		name string
+		line []Span
+		want string
+	}{
+		{"blank", nil, ""},
+		{"single style", []Span{{Style: Preformatted, Text: "a"}, {Style: Preformatted, Text: "b"}}, Preformatted},
+		{"blank spans ignored", []Span{{Style: Normal, Text: "  "}, {Style: BlockQuote, Text: "Quote"}}, BlockQuote},
+		{"mixed styles", []Span{{Style: Preformatted, Text: "a"}, {Style: Normal, Text: "b"}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LineStyle(tt.line); got != tt.want {
+				t.Errorf("LineStyle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,7 +8,14 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"net/url"
+	"path"
 	"strings"
+	"sync"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-attachment"
+	"go.deuill.org/informbot/pkg/joe-styling"
 
 	// Third-party packages
 	"github.com/go-joe/joe"
@@ -53,10 +60,16 @@ type Client struct {
 	brain   *joe.Brain    // The mediator between this adapter and other handlers.
 	session *xmpp.Session // The active XMPP session.
 	logger  *zap.Logger   // The logger instance to use, defaults to a global logger used by Joe.
+
+	rooms     map[string]bool    // The bare JIDs for all MUCs joined.
+	occupants map[string]jid.JID // The real bare JIDs for MUC occupants, against their occupant JIDs.
+	roomsMu   sync.RWMutex       // The lock protecting concurrent access to rooms and occupants.
 }
 
 // Send wraps the given text in a message stanza and sets the recipient to the given channel, which
-// is expected to be a JID (bare for direct messages). A error is returned if the channel JID does
+// is expected to be a JID. Channels referring to joined MUCs are sent group-chat messages, either
+// addressed to the room as a whole (for bare JIDs), or mentioning a specific occupant (for full
+// JIDs); all other channels are sent direct messages. A error is returned if the channel JID does
 // not parse, or if the message fails to send for any reason.
 func (c *Client) Send(msg, channel string) error {
 	jid, err := jid.Parse(channel)
@@ -64,11 +77,11 @@ func (c *Client) Send(msg, channel string) error {
 		return errors.Wrap(err, "parsing JID failed")
 	}
 
-	// Determine whether this is a direct or group-chat message from the resource part of the JID,
-	// which is only set if the message was originally sent as part of a group-chat.
 	var kind = stanza.ChatMessage
-	if jid.Resourcepart() != "" {
-		msg = jid.Resourcepart() + ", " + msg
+	if c.isRoom(jid) {
+		if jid.Resourcepart() != "" {
+			msg = jid.Resourcepart() + ", " + msg
+		}
 		jid, kind = jid.Bare(), stanza.GroupChatMessage
 	}
 
@@ -94,11 +107,100 @@ func (c *Client) Send(msg, channel string) error {
 	)
 }
 
+// SetStatus sends directed presence to the given channel, with the given text set as the presence
+// status, or with no status set, if the text is empty. Channels referring to joined MUCs have the
+// status set for the client's own occupant, and are thus shown to all occupants.
+func (c *Client) SetStatus(channel, status string) error {
+	jid, err := jid.Parse(channel)
+	if err != nil {
+		return errors.Wrap(err, "parsing JID failed")
+	}
+
+	if c.isRoom(jid) {
+		if jid, err = jid.Bare().WithResource(c.session.LocalAddr().Localpart()); err != nil {
+			return errors.Wrap(err, "setting JID for MUC failed")
+		}
+	}
+
+	var payload xml.TokenReader
+	if status != "" {
+		payload = xmlstream.Wrap(
+			xmlstream.Token(xml.CharData(status)),
+			xml.StartElement{Name: xml.Name{Local: "status"}},
+		)
+	}
+
+	c.logger.Debug("Setting status", zap.String("jid", jid.String()))
+
+	return c.session.Send(context.Background(), stanza.Presence{
+		ID:   randomID(),
+		Type: stanza.AvailablePresence,
+		To:   jid,
+	}.Wrap(payload))
+}
+
+// RenderStyles returns the styled text given, formatted with the directives defined in XEP-0393
+// (Message Styling), as understood by many XMPP clients. Headings and alerts are shown in bold,
+// emphasized text in italics, pre-formatted text in code blocks, and block quotes as quotes.
+func (c *Client) RenderStyles(spans []styling.Span) string {
+	var buf strings.Builder
+	var lines = styling.Lines(spans)
+	for i := 0; i < len(lines); i++ {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		switch styling.LineStyle(lines[i]) {
+		case styling.Preformatted:
+			// Consecutive lines of pre-formatted text are shown in a single block, as the
+			// directives used only apply to whole lines.
+			buf.WriteString("```")
+			for ; i < len(lines) && styling.LineStyle(lines[i]) == styling.Preformatted; i++ {
+				buf.WriteString("\n" + styling.Text(lines[i]))
+			}
+			buf.WriteString("\n```")
+			i--
+		case styling.BlockQuote:
+			buf.WriteString("> " + strings.TrimSpace(styling.Text(lines[i])))
+		default:
+			for _, s := range lines[i] {
+				buf.WriteString(styleSpan(s))
+			}
+		}
+	}
+
+	return buf.String()
+}
+
+// StyleSpan returns the text for the span given, wrapped in the XEP-0393 directive for its style.
+// Directives are placed around the text itself, as they may not be followed or preceded by spaces.
+func styleSpan(s styling.Span) string {
+	var directive string
+	switch s.Style {
+	case styling.Header, styling.Subheader, styling.Alert:
+		directive = "*"
+	case styling.Emphasized, styling.Note:
+		directive = "_"
+	case styling.Preformatted:
+		directive = "`"
+	default:
+		return s.Text
+	}
+
+	var text = strings.TrimSpace(s.Text)
+	if text == "" {
+		return s.Text
+	}
+
+	var i = strings.Index(s.Text, text)
+	return s.Text[:i] + directive + text + directive + s.Text[i+len(text):]
+}
+
 // GroupInfo represents information needed for joining a MUC, either automatically or as part of an
 // invite (direct or mediated).
 type GroupInfo struct {
 	Channel  jid.JID `xml:"-"`
-	Password string  `xml:"password`
+	Password string  `xml:"password"`
 	Invite   struct {
 		From jid.JID `xml:"from,attr"`
 	} `xml:"invite"`
@@ -112,7 +214,54 @@ type MessageStanza struct {
 	Body string `xml:"body"`
 
 	// Additional, optional fields.
-	Group GroupInfo `xml:"x"`
+	Group GroupInfo  `xml:"http://jabber.org/protocol/muc#user x"`
+	Files []FileInfo `xml:"jabber:x:oob x"`
+}
+
+// FileInfo represents a file shared out-of-band (XEP-0066), commonly alongside files uploaded via
+// HTTP File Upload (XEP-0363).
+type FileInfo struct {
+	URL         string `xml:"url"`
+	Description string `xml:"desc"`
+}
+
+// Nick returns the nickname the sender is known by in the MUC the message was sent in, or an empty
+// string for messages not sent in MUCs.
+func (m *MessageStanza) Nick() string {
+	if m.Type != stanza.GroupChatMessage {
+		return ""
+	}
+
+	return m.From.Resourcepart()
+}
+
+// Attachments returns any files shared in the message, either out-of-band, or as a message body
+// containing only an HTTP(S) URL, as sent by clients that share uploaded files without out-of-band
+// data.
+func (m *MessageStanza) Attachments() []attachment.Attachment {
+	var result []attachment.Attachment
+	for _, f := range m.Files {
+		if f.URL != "" {
+			result = append(result, attachment.Attachment{URL: f.URL, Description: f.Description})
+		}
+	}
+
+	if len(result) == 0 && isFileURL(m.Body) {
+		result = append(result, attachment.Attachment{URL: m.Body})
+	}
+
+	return result
+}
+
+// IsFileURL returns whether or not the text given consists of a single HTTP(S) URL with a non-empty
+// path, as used for sharing files.
+func isFileURL(text string) bool {
+	u, err := url.Parse(text)
+	if err != nil || strings.ContainsAny(text, " \t\n") || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+
+	return u.Host != "" && path.Base(u.Path) != "/" && path.Base(u.Path) != "."
 }
 
 // HandleInvite responds to the given invite (direct or mediated) with an 'available' presence,
@@ -155,16 +304,38 @@ func (c *Client) HandleInvite(w xmlstream.TokenWriter, info *GroupInfo) error {
 		return errors.Wrap(err, "setting presence for MUC failed")
 	}
 
+	c.roomsMu.Lock()
+	c.rooms[info.Channel.Bare().String()] = true
+	c.roomsMu.Unlock()
+
 	return nil
 }
 
+// IsRoom returns whether or not the given JID refers to a MUC joined, or an occupant thereof.
+func (c *Client) isRoom(j jid.JID) bool {
+	c.roomsMu.RLock()
+	defer c.roomsMu.RUnlock()
+	return c.rooms[j.Bare().String()]
+}
+
+// Occupant returns the real bare JID for the MUC occupant given, as exposed by rooms that are not
+// anonymous, or a zero JID if the real JID is not known.
+func (c *Client) occupant(j jid.JID) jid.JID {
+	c.roomsMu.RLock()
+	defer c.roomsMu.RUnlock()
+	return c.occupants[j.String()]
+}
+
 // HandleMessage parses the given MessageStanza, validating its contents and responding either as a
 // direct message, or as a group-chat mention, depending on the intent. HandleMessage will also handle
 // invites to group-chats, joining these automatically and with no confirmation needed.
 //
 // By default, only messages prepended with the local part of the client JID will be responded to in
-// group-chats; this is to avoid handling messages where this is not wanted. Such mentions will be,
-// in turn, responded to with a mention for the sending user.
+// group-chats; this is to avoid handling messages where this is not wanted. Group-chat messages are
+// emitted with the room's bare JID as the channel, so that responses are sent to the room as a
+// whole, and with the occupant's real bare JID as the author, where the room exposes it. Messages
+// sent by occupants whose real JID is not known are emitted with no author, as nicknames can be
+// taken by anyone; the nickname is available from the message stanza instead.
 //
 // Currently, only mediated invites (XEP-0045) are handled, and rooms are not re-joined if the client
 // closes its connection to the server.
@@ -174,18 +345,23 @@ func (c *Client) HandleMessage(w xmlstream.TokenWriter, msg *MessageStanza) erro
 
 	switch msg.Type {
 	case stanza.GroupChatMessage:
-		// Don't handle messages that aren't intended for us.
+		// Don't handle messages that aren't intended for us, or that were sent by us.
 		n := strings.ToLower(c.session.LocalAddr().Localpart())
 		if len(msg.Body) <= len(n) || strings.ToLower(msg.Body[:len(n)]) != n {
 			return nil
+		} else if strings.ToLower(msg.From.Resourcepart()) == n {
+			return nil
 		}
 
-		channel = msg.From.String()
+		authorID = ""
+		if real := c.occupant(msg.From); !real.Equal(jid.JID{}) {
+			authorID = real.Bare().String()
+		}
 		msg.Body = strings.Trim(msg.Body[len(n):], " ,:")
 		fallthrough
 	case stanza.ChatMessage:
-		// Do not attempt to handle empty or invalid messages.
-		if msg.Body == "" {
+		// Do not attempt to handle empty or invalid messages, unless files were shared.
+		if msg.Body == "" && len(msg.Files) == 0 {
 			return nil
 		}
 
@@ -212,14 +388,36 @@ func (c *Client) HandleMessage(w xmlstream.TokenWriter, msg *MessageStanza) erro
 type PresenceStanza struct {
 	// Base, common fields.
 	stanza.Presence
+
+	// Additional, optional fields.
+	Group OccupantInfo `xml:"http://jabber.org/protocol/muc#user x"`
+}
+
+// OccupantInfo represents information on MUC occupants, as sent along with their presence. The real
+// JID for occupants is only given in rooms that are not anonymous.
+type OccupantInfo struct {
+	Item struct {
+		JID jid.JID `xml:"jid,attr"`
+	} `xml:"item"`
 }
 
 // HandlePresence parses the given PresenceStanza and responds (usually to the affirmative),
 // depending on the presence type, e.g. for subscription requests, HandlePresence will automatically
-// subscribe and respond. Any errors returned in parsing on responding will be returned.
+// subscribe and respond. Presence for MUC occupants is used in keeping track of their real JIDs,
+// where these are known. Any errors returned in parsing on responding will be returned.
 func (c *Client) HandlePresence(w xmlstream.TokenWriter, p *PresenceStanza) error {
 	var err error
 
+	if c.isRoom(p.From) && p.From.Resourcepart() != "" {
+		c.roomsMu.Lock()
+		if p.Type == stanza.UnavailablePresence || p.Group.Item.JID.Equal(jid.JID{}) {
+			delete(c.occupants, p.From.String())
+		} else {
+			c.occupants[p.From.String()] = p.Group.Item.JID.Bare()
+		}
+		c.roomsMu.Unlock()
+	}
+
 	// Handle presence stanza based on type.
 	switch p.Type {
 	case stanza.SubscribePresence:
@@ -334,7 +532,12 @@ func Adapter(ctx context.Context, conf Config) joe.Module {
 			return errors.Wrap(err, "establishing session failed")
 		}
 
-		var c = &Client{session: sess, logger: conf.Logger}
+		var c = &Client{
+			session:   sess,
+			logger:    conf.Logger,
+			rooms:     make(map[string]bool),
+			occupants: make(map[string]jid.JID),
+		}
 		if c.logger == nil {
 			c.logger = joeConf.Logger(id.Network())
 		}
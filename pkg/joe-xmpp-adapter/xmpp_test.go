@@ -0,0 +1,80 @@
+package xmpp
+
+import (
+	// Standard library
+	"testing"
+
+	// Internal packages
+	"go.deuill.org/informbot/pkg/joe-styling"
+)
+
+func TestRenderStyles(t *testing.T) {
+	var tests = []struct {
+		name  string
+		spans []styling.Span
+		want  string
+	}{
+		{"empty", nil, ""},
+		{"unstyled", []styling.Span{{Style: styling.Normal, Text: "A small room.\nNothing here."}}, "A small room.\nNothing here."},
+		{"headings", []styling.Span{
+			{Style: styling.Header, Text: "Kitchen"},
+			{Style: styling.Normal, Text: "\nA small room.\n"},
+			{Style: styling.Subheader, Text: "Exits"},
+		}, "*Kitchen*\nA small room.\n*Exits*"},
+		{"emphasis and alerts", []styling.Span{
+			{Style: styling.Normal, Text: "A "},
+			{Style: styling.Emphasized, Text: "small"},
+			{Style: styling.Normal, Text: " room. "},
+			{Style: styling.Alert, Text: "Careful!"},
+			{Style: styling.Normal, Text: " "},
+			{Style: styling.Note, Text: "(noted)"},
+		}, "A _small_ room. *Careful!* _(noted)_"},
+		{"surrounding white-space", []styling.Span{
+			{Style: styling.Normal, Text: "A"},
+			{Style: styling.Emphasized, Text: "  small "},
+			{Style: styling.Normal, Text: "room"},
+		}, "A  _small_ room"},
+		{"blank styled span", []styling.Span{
+			{Style: styling.Normal, Text: "A"},
+			{Style: styling.Header, Text: "   "},
+			{Style: styling.Normal, Text: "room"},
+		}, "A   room"},
+		{"inline pre-formatted", []styling.Span{
+			{Style: styling.Normal, Text: "Type "},
+			{Style: styling.Preformatted, Text: "look"},
+			{Style: styling.Normal, Text: " to look."},
+		}, "Type `look` to look."},
+		{"code block", []styling.Span{
+			{Style: styling.Normal, Text: "A map:\n"},
+			{Style: styling.Preformatted, Text: "+--+\n|  |\n+--+"},
+			{Style: styling.Normal, Text: "\nYou are here."},
+		}, "A map:\n```\n+--+\n|  |\n+--+\n```\nYou are here."},
+		{"code block with blank line", []styling.Span{
+			{Style: styling.Preformatted, Text: "one\n"},
+			{Style: styling.Normal, Text: "\n"},
+			{Style: styling.Preformatted, Text: "two"},
+		}, "```\none\n```\n\n```\ntwo\n```"},
+		{"code block at end", []styling.Span{
+			{Style: styling.Normal, Text: "Map:\n"},
+			{Style: styling.Preformatted, Text: "  #  \n ### "},
+		}, "Map:\n```\n  #  \n ### \n```"},
+		{"quote", []styling.Span{
+			{Style: styling.Normal, Text: "It reads:\n"},
+			{Style: styling.BlockQuote, Text: "  Beware the dog.  \n  And the cat."},
+			{Style: styling.Normal, Text: "\nHow odd."},
+		}, "It reads:\n> Beware the dog.\n> And the cat.\nHow odd."},
+		{"mixed line", []styling.Span{
+			{Style: styling.Preformatted, Text: "code"},
+			{Style: styling.Normal, Text: " and text"},
+		}, "`code` and text"},
+	}
+
+	var c = &Client{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.RenderStyles(tt.spans); got != tt.want {
+				t.Errorf("RenderStyles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
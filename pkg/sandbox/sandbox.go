@@ -0,0 +1,67 @@
+// Package sandbox implements restricted execution of external processes, such as compilers and
+// interpreters operating on untrusted input.
+//
+// Processes are run in their own set of Linux namespaces, with resource limits applied, a read-only
+// view of the file-system (apart from a single working directory), and no network access. Temporary
+// directories, which hold working directories for other processes, and any paths hidden in policy
+// are replaced with empty directories, and processes are only shown their own process tree under
+// /proc. This is implemented by re-executing the current binary as a helper that sets up the sandbox
+// before executing the target process, and thus requires that Init is called first thing in the
+// program's main function, before any other work is done.
+package sandbox
+
+import (
+	// Standard library
+	"time"
+)
+
+// Default values for resource limits, used where no explicit values are set in policy.
+const (
+	defaultMemoryLimit   = 1 << 30 // 1GiB
+	defaultCPULimit      = 5 * time.Minute
+	defaultFileSizeLimit = 64 << 20 // 64MiB
+)
+
+// The environment variable used for passing policy to the sandbox helper process.
+const policyEnv = "INFORMBOT_SANDBOX_POLICY"
+
+// Policy represents the restrictions applied to sandboxed processes. Resource limits left unset are
+// assigned default values, and negative values disable specific limits altogether.
+type Policy struct {
+	Disabled bool // Whether or not sandboxing is disabled entirely.
+
+	// Resource limits applied to sandboxed processes.
+	MemoryLimit   int64         // The maximum size of process virtual memory, in bytes.
+	CPULimit      time.Duration // The maximum amount of CPU time used by the process.
+	FileSizeLimit int64         // The maximum size of files created by the process, in bytes.
+
+	// Other restrictions applied to sandboxed processes.
+	AllowNetwork bool     // Whether or not network access is permitted.
+	Env          []string // Additional environment variables set, in 'KEY=value' form.
+	Hidden       []string // Paths to files or directories hidden from processes, e.g. data stores.
+}
+
+// WithDefaults returns a copy of the policy, with default values assigned to any unset limits.
+func (p Policy) withDefaults() Policy {
+	if p.MemoryLimit == 0 {
+		p.MemoryLimit = defaultMemoryLimit
+	}
+	if p.CPULimit == 0 {
+		p.CPULimit = defaultCPULimit
+	}
+	if p.FileSizeLimit == 0 {
+		p.FileSizeLimit = defaultFileSizeLimit
+	}
+
+	return p
+}
+
+// Request represents the information passed to the sandbox helper process, and used in setting up
+// the sandbox before executing the target process.
+type request struct {
+	Policy Policy   // The policy to apply.
+	Dir    string   // The working directory, which remains writable.
+	Hidden []string // The absolute paths hidden, including temporary directories.
+	Path   string   // The path to the target executable.
+	Args   []string // The arguments for the target executable, including its name.
+}
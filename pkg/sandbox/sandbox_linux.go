@@ -0,0 +1,260 @@
+//go:build linux
+
+package sandbox
+
+import (
+	// Standard library
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// The path to the currently running executable, used for re-executing as the sandbox helper.
+const selfPath = "/proc/self/exe"
+
+// Temporary directories hidden from sandboxed processes, in addition to the directory returned by
+// os.TempDir, as these may hold working directories for other processes.
+var tempDirs = []string{"/tmp", "/var/tmp", "/dev/shm"}
+
+// Mount options that are retained when re-mounting existing mount points as read-only; these cannot
+// be cleared from within a user namespace.
+var mountFlags = map[string]uintptr{
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"relatime":    syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// Command returns a command for running the named executable with the arguments given, under the
+// restrictions set in policy. The directory given is used as the working directory for the command,
+// and is the only part of the file-system the command is able to write to. If sandboxing is disabled
+// in policy, the command is run directly, and with no restrictions.
+func (p Policy) Command(ctx context.Context, dir, name string, args ...string) (*exec.Cmd, error) {
+	if p.Disabled {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		return cmd, nil
+	}
+
+	target, err := exec.LookPath(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "executable not found")
+	} else if dir, err = filepath.Abs(dir); err != nil {
+		return nil, errors.Wrap(err, "resolving working directory failed")
+	}
+
+	// Temporary directories are resolved here, as the helper process has its own set as the working
+	// directory.
+	var hidden = append([]string{os.TempDir()}, tempDirs...)
+	for _, h := range p.Hidden {
+		if h, err = filepath.Abs(h); err != nil {
+			return nil, errors.Wrap(err, "resolving hidden path failed")
+		}
+		hidden = append(hidden, h)
+	}
+
+	req, err := json.Marshal(request{
+		Policy: p.withDefaults(),
+		Dir:    dir,
+		Hidden: hidden,
+		Path:   target,
+		Args:   append([]string{name}, args...),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding sandbox policy failed")
+	}
+
+	var cloneFlags uintptr = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if !p.AllowNetwork {
+		cloneFlags |= syscall.CLONE_NEWNET
+	}
+
+	cmd := exec.CommandContext(ctx, selfPath)
+	cmd.Args = []string{name}
+	cmd.Dir = dir
+	cmd.Env = append([]string{
+		policyEnv + "=" + string(req),
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+	}, p.Env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 cloneFlags,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+
+	return cmd, nil
+}
+
+// Init checks whether the current process was started as a sandbox helper and, if so, sets up the
+// sandbox and executes the target process in place of the current process. Init does not return in
+// that case, and exits the process on failure. Init must be called before any other work is done in
+// the program's main function.
+func Init() {
+	if os.Getenv(policyEnv) == "" {
+		return
+	}
+
+	if err := initSandbox(os.Getenv(policyEnv)); err != nil {
+		fmt.Fprintln(os.Stderr, "sandbox: "+err.Error())
+		os.Exit(126)
+	}
+}
+
+// InitSandbox applies the restrictions given in the encoded request to the current process, and
+// executes the target process, returning only if any of these steps fails.
+func initSandbox(data string) error {
+	var req request
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return errors.Wrap(err, "decoding policy failed")
+	} else if err := setupMounts(req.Dir, req.Hidden); err != nil {
+		return errors.Wrap(err, "setting up file-system failed")
+	} else if err := setupLimits(req.Policy); err != nil {
+		return errors.Wrap(err, "setting up resource limits failed")
+	} else if err := os.Chdir(req.Dir); err != nil {
+		return errors.Wrap(err, "changing working directory failed")
+	}
+
+	var env []string
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, policyEnv+"=") {
+			env = append(env, e)
+		}
+	}
+
+	return syscall.Exec(req.Path, req.Args, env)
+}
+
+// SetupMounts makes all existing mount points read-only in the current mount namespace, apart from
+// the directory given, which is bind-mounted over itself and remains writable. Hidden directories are
+// covered with empty file-systems, and hidden files with an empty file, before the working directory
+// is bound in place, as it may itself be placed under a hidden directory. A new instance of /proc is
+// mounted, showing only processes in the current PID namespace.
+func setupMounts(dir string, hidden []string) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return errors.Wrap(err, "making mounts private failed")
+	}
+
+	// Keep a reference to the working directory, which remains accessible once hidden.
+	wd, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "opening working directory failed")
+	}
+
+	defer wd.Close()
+	for _, h := range hidden {
+		var err error
+		if fi, e := os.Stat(h); e != nil {
+			continue
+		} else if fi.IsDir() {
+			err = syscall.Mount("tmpfs", h, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755,size=1m")
+		} else {
+			err = syscall.Mount("/dev/null", h, "", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return errors.Wrapf(err, "hiding '%s' failed", h)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "creating working directory failed")
+	} else if err := syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", wd.Fd()), dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return errors.Wrap(err, "binding working directory failed")
+	} else if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return errors.Wrap(err, "mounting /proc failed")
+	}
+
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return errors.Wrap(err, "reading mount points failed")
+	}
+
+	defer f.Close()
+	var scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Fields are in the format described in proc(5), where the fifth and sixth fields are the
+		// mount point and per-mount options respectively.
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		var target = unescapeMountPath(fields[4])
+		if target == dir || strings.HasPrefix(target, dir+"/") {
+			continue
+		}
+
+		var flags uintptr = syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY
+		for _, opt := range strings.Split(fields[5], ",") {
+			flags |= mountFlags[opt]
+		}
+
+		// Kernel file-systems may contain mount points that cannot be re-mounted from within a user
+		// namespace, but which are otherwise not writable by unprivileged users anyway.
+		err := syscall.Mount("", target, "", flags, "")
+		if err != nil && !strings.HasPrefix(target, "/proc/") && !strings.HasPrefix(target, "/sys/") {
+			return errors.Wrapf(err, "making '%s' read-only failed", target)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// SetupLimits applies resource limits set in policy to the current process.
+func setupLimits(p Policy) error {
+	var limits = []struct {
+		resource int
+		value    int64
+	}{
+		{syscall.RLIMIT_AS, p.MemoryLimit},
+		{syscall.RLIMIT_CPU, int64(p.CPULimit.Seconds())},
+		{syscall.RLIMIT_FSIZE, p.FileSizeLimit},
+	}
+
+	for _, l := range limits {
+		if l.value < 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: uint64(l.value), Max: uint64(l.value)}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnescapeMountPath returns the mount path given with octal escapes (as used in /proc/self/mountinfo
+// for white-space and other special characters) replaced with their literal values.
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			var c byte
+			if _, err := fmt.Sscanf(s[i+1:i+4], "%03o", &c); err == nil {
+				b.WriteByte(c)
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	// Standard library
+	"context"
+	"os/exec"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Command returns a command for running the named executable with the arguments given. Sandboxing
+// is only supported on Linux, and an error is returned unless sandboxing is disabled in policy.
+func (p Policy) Command(ctx context.Context, dir, name string, args ...string) (*exec.Cmd, error) {
+	if !p.Disabled {
+		return nil, errors.New("sandboxing is not supported on this platform")
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// Init is a no-op on platforms where sandboxing is not supported.
+func Init() {}
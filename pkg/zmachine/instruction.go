@@ -0,0 +1,667 @@
+package zmachine
+
+import (
+	// Standard library
+	"strconv"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Instruction forms, as determined by the operand count of each instruction.
+const (
+	kind0OP = iota
+	kind1OP
+	kind2OP
+	kindVAR
+	kindEXT
+)
+
+// Operand types, as encoded in instructions.
+const (
+	operandLarge    = 0
+	operandSmall    = 1
+	operandVariable = 2
+	operandOmitted  = 3
+)
+
+// Step decodes and executes the instruction at the program counter.
+func (m *Machine) step() {
+	var start = m.pc
+	var op = m.fetchByte()
+	var kind, num byte
+	var args = m.args[:0]
+
+	switch {
+	case op == 0xBE && m.version >= 5:
+		kind, num = kindEXT, m.fetchByte()
+		args = m.operands(args, uint16(m.fetchByte())<<8|0xFF)
+	case op&0xC0 == 0xC0:
+		if kind, num = kind2OP, op&0x1F; op&0x20 != 0 {
+			kind = kindVAR
+		}
+
+		// The 'call_vs2' and 'call_vn2' instructions take up to eight operands.
+		var types = uint16(m.fetchByte())<<8 | 0xFF
+		if kind == kindVAR && (num == 0x0C || num == 0x1A) {
+			types = types&0xFF00 | uint16(m.fetchByte())
+		}
+
+		args = m.operands(args, types)
+	case op&0xC0 == 0x80:
+		if kind, num = kind1OP, op&0x0F; (op>>4)&0x03 == operandOmitted {
+			kind = kind0OP
+		} else {
+			args = append(args, m.operand((op>>4)&0x03))
+		}
+	default:
+		var first, second byte = operandSmall, operandSmall
+		if op&0x40 != 0 {
+			first = operandVariable
+		}
+		if op&0x20 != 0 {
+			second = operandVariable
+		}
+
+		kind, num = kind2OP, op&0x1F
+		args = append(args, m.operand(first), m.operand(second))
+	}
+
+	if !m.execute(kind, num, args) {
+		panic(errors.Errorf("unknown %s opcode %d at address %#x", kindName(kind), num, start))
+	}
+}
+
+// Operands reads operands of the types given, packed two bits per operand and starting from the
+// most significant bits, until the first omitted operand.
+func (m *Machine) operands(args []uint16, types uint16) []uint16 {
+	for i := 14; i >= 0; i -= 2 {
+		var t = byte(types>>uint(i)) & 0x03
+		if t == operandOmitted {
+			break
+		}
+		args = append(args, m.operand(t))
+	}
+
+	return args
+}
+
+// Operand reads a single operand of the type given.
+func (m *Machine) operand(t byte) uint16 {
+	switch t {
+	case operandLarge:
+		return m.fetchWord()
+	case operandSmall:
+		return uint16(m.fetchByte())
+	default:
+		return m.readVar(m.fetchByte())
+	}
+}
+
+// Execute runs the instruction given, returning false if the instruction is unknown.
+func (m *Machine) execute(kind, num byte, args []uint16) bool {
+	// Operands are commonly accessed by position, with missing operands set to zero.
+	var a, b, c, d uint16
+	switch len(args) {
+	default:
+		d = args[3]
+		fallthrough
+	case 3:
+		c = args[2]
+		fallthrough
+	case 2:
+		b = args[1]
+		fallthrough
+	case 1:
+		a = args[0]
+	case 0:
+	}
+
+	switch kind {
+	case kind2OP:
+		switch num {
+		case 0x01: // je
+			var ok bool
+			for _, v := range args[1:] {
+				ok = ok || a == v
+			}
+			m.branch(ok)
+		case 0x02: // jl
+			m.branch(int16(a) < int16(b))
+		case 0x03: // jg
+			m.branch(int16(a) > int16(b))
+		case 0x04: // dec_chk
+			var v = int16(m.readVarInPlace(byte(a))) - 1
+			m.writeVarInPlace(byte(a), uint16(v))
+			m.branch(v < int16(b))
+		case 0x05: // inc_chk
+			var v = int16(m.readVarInPlace(byte(a))) + 1
+			m.writeVarInPlace(byte(a), uint16(v))
+			m.branch(v > int16(b))
+		case 0x06: // jin
+			m.branch(m.parent(a) == b)
+		case 0x07: // test
+			m.branch(a&b == b)
+		case 0x08: // or
+			m.store(a | b)
+		case 0x09: // and
+			m.store(a & b)
+		case 0x0A: // test_attr
+			m.branch(m.attr(a, b))
+		case 0x0B: // set_attr
+			m.setAttr(a, b, true)
+		case 0x0C: // clear_attr
+			m.setAttr(a, b, false)
+		case 0x0D: // store
+			m.writeVarInPlace(byte(a), b)
+		case 0x0E: // insert_obj
+			m.insertObject(a, b)
+		case 0x0F: // loadw
+			m.store(m.wordAt(uint32(a) + 2*uint32(b)))
+		case 0x10: // loadb
+			m.store(uint16(m.byteAt(uint32(a) + uint32(b))))
+		case 0x11: // get_prop
+			m.store(m.prop(a, b))
+		case 0x12: // get_prop_addr
+			addr, _ := m.findProp(a, b)
+			m.store(uint16(addr))
+		case 0x13: // get_next_prop
+			m.store(m.nextProp(a, b))
+		case 0x14: // add
+			m.store(uint16(int16(a) + int16(b)))
+		case 0x15: // sub
+			m.store(uint16(int16(a) - int16(b)))
+		case 0x16: // mul
+			m.store(uint16(int16(a) * int16(b)))
+		case 0x17: // div
+			if b == 0 {
+				panic(errors.New("division by zero"))
+			}
+			m.store(uint16(int16(a) / int16(b)))
+		case 0x18: // mod
+			if b == 0 {
+				panic(errors.New("division by zero"))
+			}
+			m.store(uint16(int16(a) % int16(b)))
+		case 0x19: // call_2s
+			m.call(a, args[1:], int(m.fetchByte()))
+		case 0x1A: // call_2n
+			m.call(a, args[1:], -1)
+		case 0x1B: // set_colour
+		case 0x1C: // throw
+			if int(b) < 2 || int(b) > len(m.frames) {
+				panic(errors.New("invalid stack frame for throw"))
+			}
+			m.frames = m.frames[:b]
+			m.ret(a)
+		default:
+			return false
+		}
+	case kind1OP:
+		switch num {
+		case 0x00: // jz
+			m.branch(a == 0)
+		case 0x01: // get_sibling
+			var v = m.sibling(a)
+			m.store(v)
+			m.branch(v != 0)
+		case 0x02: // get_child
+			var v = m.child(a)
+			m.store(v)
+			m.branch(v != 0)
+		case 0x03: // get_parent
+			m.store(m.parent(a))
+		case 0x04: // get_prop_len
+			m.store(m.propLen(uint32(a)))
+		case 0x05: // inc
+			m.writeVarInPlace(byte(a), m.readVarInPlace(byte(a))+1)
+		case 0x06: // dec
+			m.writeVarInPlace(byte(a), m.readVarInPlace(byte(a))-1)
+		case 0x07: // print_addr
+			s, _ := m.decode(uint32(a), false)
+			m.print(s)
+		case 0x08: // call_1s
+			m.call(a, nil, int(m.fetchByte()))
+		case 0x09: // remove_obj
+			m.removeObject(a)
+		case 0x0A: // print_obj
+			m.print(m.shortName(a))
+		case 0x0B: // ret
+			m.ret(a)
+		case 0x0C: // jump
+			m.pc = uint32(int32(m.pc) + int32(int16(a)) - 2)
+		case 0x0D: // print_paddr
+			s, _ := m.decode(m.unpack(a, true), false)
+			m.print(s)
+		case 0x0E: // load
+			m.store(m.readVarInPlace(byte(a)))
+		case 0x0F: // not, call_1n
+			if m.version <= 4 {
+				m.store(^a)
+			} else {
+				m.call(a, nil, -1)
+			}
+		default:
+			return false
+		}
+	case kind0OP:
+		switch num {
+		case 0x00: // rtrue
+			m.ret(1)
+		case 0x01: // rfalse
+			m.ret(0)
+		case 0x02: // print
+			s, end := m.decode(m.pc, false)
+			m.print(s)
+			m.pc = end
+		case 0x03: // print_ret
+			s, end := m.decode(m.pc, false)
+			m.print(s + "\n")
+			m.pc = end
+			m.ret(1)
+		case 0x04: // nop
+		case 0x05: // save
+			if m.version >= 5 {
+				return false
+			} else if ok := m.save(); m.version <= 3 {
+				m.branch(ok)
+			} else {
+				m.store(boolValue(ok))
+			}
+		case 0x06: // restore
+			if m.version >= 5 {
+				return false
+			} else if m.restore() {
+				break
+			} else if m.version <= 3 {
+				m.branch(false)
+			} else {
+				m.store(0)
+			}
+		case 0x07: // restart
+			m.out.Flush()
+			m.reset()
+		case 0x08: // ret_popped
+			m.ret(m.pop())
+		case 0x09: // pop, catch
+			if m.version <= 4 {
+				m.pop()
+			} else {
+				m.store(uint16(len(m.frames)))
+			}
+		case 0x0A: // quit
+			m.finished = true
+		case 0x0B: // new_line
+			m.print("\n")
+		case 0x0C: // show_status
+			if m.version <= 3 {
+				m.updateStatus()
+			}
+		case 0x0D: // verify
+			m.branch(m.verify())
+		case 0x0F: // piracy
+			m.branch(true)
+		default:
+			return false
+		}
+	case kindVAR:
+		switch num {
+		case 0x00: // call, call_vs
+			m.call(a, args[1:], int(m.fetchByte()))
+		case 0x01: // storew
+			m.setWord(uint32(a)+2*uint32(b), c)
+		case 0x02: // storeb
+			m.setByte(uint32(a)+uint32(b), byte(c))
+		case 0x03: // put_prop
+			m.setProp(a, b, c)
+		case 0x04: // sread, aread
+			if m.version <= 3 {
+				m.updateStatus()
+			}
+			if term := m.read(uint32(a), uint32(b)); m.version >= 5 {
+				m.store(uint16(term))
+			}
+		case 0x05: // print_char
+			m.print(string(m.zsciiRune(a)))
+		case 0x06: // print_num
+			m.print(strconv.Itoa(int(int16(a))))
+		case 0x07: // random
+			m.store(m.random(int16(a)))
+		case 0x08: // push
+			m.push(a)
+		case 0x09: // pull
+			var v = m.pop()
+			m.writeVarInPlace(byte(a), v)
+		case 0x0A: // split_window
+			m.splitWindow(int(a))
+		case 0x0B: // set_window
+			m.setWindow(int(a))
+		case 0x0C: // call_vs2
+			m.call(a, args[1:], int(m.fetchByte()))
+		case 0x0D: // erase_window
+			m.eraseWindow(int(int16(a)))
+		case 0x0E: // erase_line
+			m.eraseLine(a)
+		case 0x0F: // set_cursor
+			m.setCursor(int(int16(a)), int(int16(b)))
+		case 0x10: // get_cursor
+			row, col := m.cursor()
+			m.setWord(uint32(a), uint16(row))
+			m.setWord(uint32(a)+2, uint16(col))
+		case 0x11: // set_text_style
+		case 0x12: // buffer_mode
+		case 0x13: // output_stream
+			m.outputStream(int16(a), uint32(b))
+		case 0x14: // input_stream
+		case 0x15: // sound_effect
+		case 0x16: // read_char
+			m.store(uint16(m.readChar()))
+		case 0x17: // scan_table
+			var form uint16 = 0x82
+			if len(args) > 3 {
+				form = d
+			}
+			var addr = m.scanTable(a, uint32(b), c, form)
+			m.store(uint16(addr))
+			m.branch(addr != 0)
+		case 0x18: // not
+			m.store(^a)
+		case 0x19: // call_vn
+			m.call(a, args[1:], -1)
+		case 0x1A: // call_vn2
+			m.call(a, args[1:], -1)
+		case 0x1B: // tokenise
+			m.tokenise(uint32(a), uint32(b), uint32(c), d != 0)
+		case 0x1C: // encode_text
+			var words = m.encode(m.mem[uint32(a)+uint32(c) : uint32(a)+uint32(c)+uint32(b)])
+			for i, w := range words {
+				m.setWord(uint32(d)+2*uint32(i), w)
+			}
+		case 0x1D: // copy_table
+			m.copyTable(uint32(a), uint32(b), int16(c))
+		case 0x1E: // print_table
+			m.printTable(uint32(a), int(b), int(c), int(d), len(args))
+		case 0x1F: // check_arg_count
+			m.branch(int(a) <= m.frames[len(m.frames)-1].argc)
+		default:
+			return false
+		}
+	case kindEXT:
+		switch num {
+		case 0x00: // save
+			if len(args) > 0 {
+				m.store(m.saveTable(uint32(a), uint32(b), uint32(c), len(args) > 2))
+			} else {
+				m.store(boolValue(m.save()))
+			}
+		case 0x01: // restore
+			if len(args) > 0 {
+				m.store(m.restoreTable(uint32(a), uint32(b), uint32(c), len(args) > 2))
+			} else if !m.restore() {
+				m.store(0)
+			}
+		case 0x02: // log_shift
+			if places := int16(b); places >= 0 {
+				m.store(a << uint(places))
+			} else {
+				m.store(a >> uint(-places))
+			}
+		case 0x03: // art_shift
+			if places := int16(b); places >= 0 {
+				m.store(a << uint(places))
+			} else {
+				m.store(uint16(int16(a) >> uint(-places)))
+			}
+		case 0x04: // set_font
+			m.store(m.setFont(a))
+		case 0x09: // save_undo
+			m.saveUndo()
+		case 0x0A: // restore_undo
+			if !m.restoreUndo() {
+				m.store(0)
+			}
+		case 0x0B: // print_unicode
+			m.print(string(rune(a)))
+		case 0x0C: // check_unicode
+			if a >= 0x20 && a != 0x7F {
+				m.store(3)
+			} else {
+				m.store(0)
+			}
+		case 0x0D: // set_true_colour
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Call starts executing the routine at the packed address given, with the arguments given. The
+// return value is stored in the variable given, or discarded if the variable is negative.
+func (m *Machine) call(routine uint16, args []uint16, store int) {
+	if routine == 0 {
+		if store >= 0 {
+			m.writeVar(byte(store), 0)
+		}
+		return
+	} else if len(m.frames) >= maxFrames {
+		panic(errors.New("call stack overflow"))
+	}
+
+	var addr = m.unpack(routine, false)
+	var locals = make([]uint16, m.byteAt(addr))
+	if addr++; len(locals) > 15 {
+		panic(errors.Errorf("routine at address %#x has too many locals", addr-1))
+	}
+
+	// Initial values for locals are only given in earlier versions.
+	if m.version <= 4 {
+		for i := range locals {
+			locals[i] = m.wordAt(addr)
+			addr += 2
+		}
+	}
+
+	copy(locals, args)
+	m.frames = append(m.frames, frame{ret: m.pc, store: store, locals: locals, base: len(m.stack), argc: len(args)})
+	m.pc = addr
+}
+
+// Ret returns from the current routine with the value given.
+func (m *Machine) ret(v uint16) {
+	if len(m.frames) <= 1 {
+		panic(errors.New("return from main routine"))
+	}
+
+	var f = m.frames[len(m.frames)-1]
+	m.frames, m.stack, m.pc = m.frames[:len(m.frames)-1], m.stack[:f.base], f.ret
+	if f.store >= 0 {
+		m.writeVar(byte(f.store), v)
+	}
+}
+
+// Store writes the value given to the variable referenced by the next byte in the instruction.
+func (m *Machine) store(v uint16) {
+	m.writeVar(m.fetchByte(), v)
+}
+
+// Branch reads branch data from the instruction and branches if the condition given matches the
+// condition expected, either returning from the current routine or jumping to a new address.
+func (m *Machine) branch(cond bool) {
+	var b = m.fetchByte()
+	var offset = int32(b & 0x3F)
+	if b&0x40 == 0 {
+		// Offsets are 14-bit signed integers, where the second byte contains the low bits.
+		offset = int32(int16((uint16(b&0x3F)<<8|uint16(m.fetchByte()))<<2) >> 2)
+	}
+
+	if cond != (b&0x80 != 0) {
+		return
+	}
+
+	switch offset {
+	case 0:
+		m.ret(0)
+	case 1:
+		m.ret(1)
+	default:
+		m.pc = uint32(int32(m.pc) + offset - 2)
+	}
+}
+
+// ReadVar returns the value for the variable given, where variable 0 pops the top of the stack,
+// variables 1 to 15 are locals, and all others are globals.
+func (m *Machine) readVar(v byte) uint16 {
+	switch {
+	case v == 0:
+		return m.pop()
+	case v < 16:
+		return *m.local(v)
+	default:
+		return m.wordAt(m.globals + 2*uint32(v-16))
+	}
+}
+
+// WriteVar sets the value for the variable given, where variable 0 pushes to the stack.
+func (m *Machine) writeVar(v byte, val uint16) {
+	switch {
+	case v == 0:
+		m.push(val)
+	case v < 16:
+		*m.local(v) = val
+	default:
+		m.setWord(m.globals+2*uint32(v-16), val)
+	}
+}
+
+// ReadVarInPlace returns the value for the variable given, as referenced indirectly by instructions
+// such as 'load' or 'inc', where variable 0 reads the top of the stack without popping it.
+func (m *Machine) readVarInPlace(v byte) uint16 {
+	if v == 0 {
+		var val = m.pop()
+		m.push(val)
+		return val
+	}
+
+	return m.readVar(v)
+}
+
+// WriteVarInPlace sets the value for the variable given, as referenced indirectly by instructions
+// such as 'store' or 'inc', where variable 0 replaces the top of the stack.
+func (m *Machine) writeVarInPlace(v byte, val uint16) {
+	if v == 0 {
+		m.pop()
+	}
+
+	m.writeVar(v, val)
+}
+
+func (m *Machine) local(v byte) *uint16 {
+	var f = &m.frames[len(m.frames)-1]
+	if int(v) > len(f.locals) {
+		panic(errors.Errorf("reference to missing local variable %d", v))
+	}
+
+	return &f.locals[v-1]
+}
+
+func (m *Machine) push(v uint16) {
+	if len(m.stack) >= maxStackSize {
+		panic(errors.New("stack overflow"))
+	}
+	m.stack = append(m.stack, v)
+}
+
+func (m *Machine) pop() uint16 {
+	if len(m.stack) <= m.frames[len(m.frames)-1].base {
+		panic(errors.New("stack underflow"))
+	}
+
+	var v = m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+// Random returns a random number between 1 and the range given, if positive. Otherwise, the random
+// number generator is seeded, predictably for negative ranges, and zero is returned.
+func (m *Machine) random(n int16) uint16 {
+	switch {
+	case n > 0:
+		return uint16(m.rand.Intn(int(n)) + 1)
+	case n < 0:
+		m.rand.Seed(int64(-n))
+	default:
+		m.rand.Seed(time.Now().UnixNano())
+	}
+
+	return 0
+}
+
+// Verify returns whether or not the story file checksum matches the one given in its header.
+func (m *Machine) verify() bool {
+	var sum uint16
+	for _, b := range m.story[hdrSize:m.fileLength()] {
+		sum += uint16(b)
+	}
+
+	return sum == m.wordAt(hdrChecksum)
+}
+
+// ScanTable returns the address of the first entry in the table given matching the value given, or
+// zero if no entry was found.
+func (m *Machine) scanTable(v uint16, table uint32, length, form uint16) uint32 {
+	var size = uint32(form & 0x7F)
+	for i := uint32(0); i < uint32(length); i++ {
+		var addr = table + i*size
+		if form&0x80 != 0 && m.wordAt(addr) == v {
+			return addr
+		} else if form&0x80 == 0 && uint16(m.byteAt(addr)) == v {
+			return addr
+		}
+	}
+
+	return 0
+}
+
+// CopyTable copies bytes between the tables given, or zeroes the first table if the second is zero.
+// Negative sizes force copying forwards, even where the tables overlap.
+func (m *Machine) copyTable(first, second uint32, size int16) {
+	switch {
+	case second == 0:
+		for i := uint32(0); i < uint32(abs(size)); i++ {
+			m.setByte(first+i, 0)
+		}
+	case size < 0:
+		for i := uint32(0); i < uint32(-int32(size)); i++ {
+			m.setByte(second+i, m.byteAt(first+i))
+		}
+	default:
+		var buf = make([]byte, size)
+		for i := range buf {
+			buf[i] = m.byteAt(first + uint32(i))
+		}
+		for i, b := range buf {
+			m.setByte(second+uint32(i), b)
+		}
+	}
+}
+
+func abs(n int16) int32 {
+	if n < 0 {
+		return -int32(n)
+	}
+	return int32(n)
+}
+
+func boolValue(b bool) uint16 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func kindName(kind byte) string {
+	return [...]string{"0OP", "1OP", "2OP", "VAR", "EXT"}[kind]
+}
@@ -0,0 +1,232 @@
+package zmachine
+
+import (
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// ObjectAddr returns the address of the object table entry for the object given.
+func (m *Machine) objectAddr(obj uint16) uint32 {
+	if m.version <= 3 {
+		return m.objects + 31*2 + uint32(obj-1)*9
+	}
+	return m.objects + 63*2 + uint32(obj-1)*14
+}
+
+// Relation returns the object related to the object given, where relations are numbered as parent,
+// sibling and child. Object zero is treated as having no relations.
+func (m *Machine) relation(obj uint16, n uint32) uint16 {
+	if obj == 0 {
+		return 0
+	} else if m.version <= 3 {
+		return uint16(m.byteAt(m.objectAddr(obj) + 4 + n))
+	}
+	return m.wordAt(m.objectAddr(obj) + 6 + 2*n)
+}
+
+// SetRelation sets the object related to the object given, as numbered for relation.
+func (m *Machine) setRelation(obj uint16, n uint32, v uint16) {
+	if obj == 0 {
+		return
+	} else if m.version <= 3 {
+		m.setByte(m.objectAddr(obj)+4+n, byte(v))
+	} else {
+		m.setWord(m.objectAddr(obj)+6+2*n, v)
+	}
+}
+
+func (m *Machine) parent(obj uint16) uint16  { return m.relation(obj, 0) }
+func (m *Machine) sibling(obj uint16) uint16 { return m.relation(obj, 1) }
+func (m *Machine) child(obj uint16) uint16   { return m.relation(obj, 2) }
+
+// Attr returns whether or not the attribute given is set for the object given.
+func (m *Machine) attr(obj, attr uint16) bool {
+	if obj == 0 || !m.validAttr(attr) {
+		return false
+	}
+
+	return m.byteAt(m.objectAddr(obj)+uint32(attr/8))&(0x80>>(attr%8)) != 0
+}
+
+// SetAttr sets or clears the attribute given for the object given.
+func (m *Machine) setAttr(obj, attr uint16, set bool) {
+	if obj == 0 || !m.validAttr(attr) {
+		return
+	}
+
+	var addr = m.objectAddr(obj) + uint32(attr/8)
+	if set {
+		m.setByte(addr, m.byteAt(addr)|0x80>>(attr%8))
+	} else {
+		m.setByte(addr, m.byteAt(addr)&^(0x80>>(attr%8)))
+	}
+}
+
+func (m *Machine) validAttr(attr uint16) bool {
+	return (m.version <= 3 && attr < 32) || (m.version > 3 && attr < 48)
+}
+
+// RemoveObject detaches the object given from its parent, along with any of its children.
+func (m *Machine) removeObject(obj uint16) {
+	var parent = m.parent(obj)
+	if parent == 0 {
+		return
+	}
+
+	if m.child(parent) == obj {
+		m.setRelation(parent, 2, m.sibling(obj))
+	} else {
+		for prev := m.child(parent); prev != 0; prev = m.sibling(prev) {
+			if m.sibling(prev) == obj {
+				m.setRelation(prev, 1, m.sibling(obj))
+				break
+			}
+		}
+	}
+
+	m.setRelation(obj, 0, 0)
+	m.setRelation(obj, 1, 0)
+}
+
+// InsertObject moves the object given to become the first child of the destination object.
+func (m *Machine) insertObject(obj, dest uint16) {
+	if obj == 0 || dest == 0 {
+		return
+	}
+
+	m.removeObject(obj)
+	m.setRelation(obj, 0, dest)
+	m.setRelation(obj, 1, m.child(dest))
+	m.setRelation(dest, 2, obj)
+}
+
+// PropTable returns the address of the property table for the object given.
+func (m *Machine) propTable(obj uint16) uint32 {
+	if m.version <= 3 {
+		return uint32(m.wordAt(m.objectAddr(obj) + 7))
+	}
+	return uint32(m.wordAt(m.objectAddr(obj) + 12))
+}
+
+// ShortName returns the short name for the object given.
+func (m *Machine) shortName(obj uint16) string {
+	if obj == 0 {
+		return ""
+	}
+
+	var table = m.propTable(obj)
+	if m.byteAt(table) == 0 {
+		return ""
+	}
+
+	s, _ := m.decode(table+1, false)
+	return s
+}
+
+// PropHeader returns the property number and data size for the property header at the address given,
+// along with the address for the property data.
+func (m *Machine) propHeader(addr uint32) (num uint16, size uint16, data uint32) {
+	var b = m.byteAt(addr)
+	if m.version <= 3 {
+		return uint16(b & 0x1F), uint16(b>>5) + 1, addr + 1
+	} else if b&0x80 == 0 {
+		return uint16(b & 0x3F), uint16(b>>6&0x01) + 1, addr + 1
+	} else if size = uint16(m.byteAt(addr+1) & 0x3F); size == 0 {
+		size = 64
+	}
+
+	return uint16(b & 0x3F), size, addr + 2
+}
+
+// FirstProp returns the address of the first property header for the object given.
+func (m *Machine) firstProp(obj uint16) uint32 {
+	var table = m.propTable(obj)
+	return table + 1 + 2*uint32(m.byteAt(table))
+}
+
+// FindProp returns the data address and size for the property given on the object given, or zero
+// if the object does not have the property.
+func (m *Machine) findProp(obj, prop uint16) (uint32, uint16) {
+	if obj == 0 {
+		return 0, 0
+	}
+
+	for addr := m.firstProp(obj); m.byteAt(addr) != 0; {
+		num, size, data := m.propHeader(addr)
+		if num == prop {
+			return data, size
+		} else if num < prop {
+			break
+		}
+		addr = data + uint32(size)
+	}
+
+	return 0, 0
+}
+
+// Prop returns the value for the property given on the object given, or the default value for the
+// property if not set on the object.
+func (m *Machine) prop(obj, prop uint16) uint16 {
+	addr, size := m.findProp(obj, prop)
+	switch {
+	case addr == 0:
+		return m.wordAt(m.objects + 2*uint32(prop-1))
+	case size == 1:
+		return uint16(m.byteAt(addr))
+	default:
+		return m.wordAt(addr)
+	}
+}
+
+// SetProp sets the value for the property given on the object given.
+func (m *Machine) setProp(obj, prop, v uint16) {
+	addr, size := m.findProp(obj, prop)
+	switch {
+	case addr == 0:
+		panic(errors.Errorf("object %d has no property %d", obj, prop))
+	case size == 1:
+		m.setByte(addr, byte(v))
+	default:
+		m.setWord(addr, v)
+	}
+}
+
+// NextProp returns the number of the property following the property given on the object given, or
+// the first property if the property given is zero.
+func (m *Machine) nextProp(obj, prop uint16) uint16 {
+	if obj == 0 {
+		return 0
+	}
+
+	var addr = m.firstProp(obj)
+	if prop != 0 {
+		data, size := m.findProp(obj, prop)
+		if data == 0 {
+			panic(errors.Errorf("object %d has no property %d", obj, prop))
+		}
+		addr = data + uint32(size)
+	}
+
+	num, _, _ := m.propHeader(addr)
+	return num
+}
+
+// PropLen returns the size of the property data at the address given.
+func (m *Machine) propLen(addr uint32) uint16 {
+	if addr == 0 {
+		return 0
+	}
+
+	// Property data is preceded by a single-byte header, or the second byte of a two-byte header.
+	var b = m.byteAt(addr - 1)
+	switch {
+	case m.version <= 3:
+		return uint16(b>>5) + 1
+	case b&0x80 == 0:
+		return uint16(b>>6&0x01) + 1
+	case b&0x3F == 0:
+		return 64
+	default:
+		return uint16(b & 0x3F)
+	}
+}
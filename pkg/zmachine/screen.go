@@ -0,0 +1,269 @@
+package zmachine
+
+import (
+	// Standard library
+	"fmt"
+	"regexp"
+	"strings"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// Runs of spaces in the upper window, as collapsed for the status line.
+var statusSpacePattern = regexp.MustCompile(` {2,}`)
+
+// The maximum number of nested memory streams, as opened with 'output_stream 3'.
+const maxMemoryStreams = 16
+
+// Status represents the status line for a story. Stories compiled for version 3 of the Z-machine
+// have their status line constructed by the interpreter, and have all fields set, while stories
+// compiled for later versions print their status line directly, and only have Text set.
+type Status struct {
+	Text string // The status line as displayed, with lines separated by new-lines.
+
+	Location string // The name of the current location.
+	Time     bool   // Whether or not the story shows the time, rather than score and moves.
+	Score    int    // The current score, if shown.
+	Moves    int    // The current number of moves, if shown.
+	Hours    int    // The current hour of the day, if time is shown.
+	Minutes  int    // The current minute of the hour, if time is shown.
+}
+
+// Screen represents the state of output windows and streams.
+type screen struct {
+	width   int  // The width of the screen, in characters.
+	enabled bool // Whether or not output to the screen is enabled.
+
+	window int      // The window selected for output, where 0 is the main window.
+	upper  [][]rune // The contents of the upper window, by line.
+	row    int      // The cursor position in the upper window, zero-based.
+	col    int
+
+	memory []memoryStream // Nested memory streams, where the last stream receives all output.
+	font   uint16         // The current font.
+	status Status         // The status line, as set for version 3 stories.
+}
+
+// MemoryStream represents output redirected to a table in memory.
+type memoryStream struct {
+	table uint32 // The address of the table, where the first word contains the length of output.
+	size  uint16 // The number of characters written to the table.
+}
+
+// Print writes the text given to the currently active output stream or window.
+func (m *Machine) print(s string) {
+	var sc = &m.screen
+	if n := len(sc.memory); n > 0 {
+		var mem = &sc.memory[n-1]
+		for _, r := range s {
+			m.setByte(mem.table+2+uint32(mem.size), m.runeZSCII(r))
+			mem.size++
+		}
+		return
+	} else if !sc.enabled {
+		return
+	} else if sc.window == 0 {
+		m.out.WriteString(s)
+		return
+	}
+
+	for _, r := range s {
+		if r == '\n' {
+			sc.row, sc.col = sc.row+1, 0
+		} else if sc.row < len(sc.upper) && sc.col < sc.width {
+			sc.upper[sc.row][sc.col] = r
+			sc.col++
+		}
+	}
+}
+
+// SplitWindow sets the height of the upper window to the number of lines given.
+func (m *Machine) splitWindow(lines int) {
+	var sc = &m.screen
+	if lines > 255 {
+		lines = 255
+	}
+
+	// The upper window is cleared when split in version 3 stories.
+	if m.version <= 3 {
+		sc.upper = nil
+	}
+
+	for len(sc.upper) > lines {
+		sc.upper = sc.upper[:len(sc.upper)-1]
+	}
+	for len(sc.upper) < lines {
+		sc.upper = append(sc.upper, blankLine(sc.width))
+	}
+
+	if sc.row >= lines {
+		sc.row, sc.col = 0, 0
+	}
+	if lines == 0 {
+		sc.window = 0
+	}
+}
+
+// SetWindow selects the window given for output, where selecting the upper window resets the
+// cursor to its top-left corner.
+func (m *Machine) setWindow(window int) {
+	if m.screen.window = window; window == 1 {
+		m.screen.row, m.screen.col = 0, 0
+	}
+}
+
+// EraseWindow clears the window given, where -1 unsplits the screen and -2 clears all windows.
+func (m *Machine) eraseWindow(window int) {
+	var sc = &m.screen
+	switch window {
+	case -1:
+		sc.upper, sc.window = nil, 0
+	case -2, 1:
+		for i := range sc.upper {
+			sc.upper[i] = blankLine(sc.width)
+		}
+		sc.row, sc.col = 0, 0
+	}
+}
+
+// EraseLine clears the current line in the upper window, from the cursor onwards.
+func (m *Machine) eraseLine(v uint16) {
+	var sc = &m.screen
+	if v != 1 || sc.window != 1 || sc.row >= len(sc.upper) {
+		return
+	}
+
+	for i := sc.col; i < sc.width; i++ {
+		sc.upper[sc.row][i] = ' '
+	}
+}
+
+// SetCursor moves the cursor in the upper window to the one-based position given.
+func (m *Machine) setCursor(row, col int) {
+	if m.screen.window != 1 || row < 1 || col < 1 {
+		return
+	}
+
+	m.screen.row, m.screen.col = row-1, col-1
+}
+
+// Cursor returns the one-based position of the cursor in the current window.
+func (m *Machine) cursor() (int, int) {
+	if m.screen.window != 1 {
+		return 1, 1
+	}
+
+	return m.screen.row + 1, m.screen.col + 1
+}
+
+// SetFont selects the font given, returning the previously selected font, or zero if the font given
+// is not available. Only the normal and fixed-pitch fonts are available, and are treated the same.
+func (m *Machine) setFont(font uint16) uint16 {
+	var prev = m.screen.font
+	if prev == 0 {
+		prev = 1
+	}
+
+	switch font {
+	case 0:
+		return prev
+	case 1, 4:
+		m.screen.font = font
+		return prev
+	default:
+		return 0
+	}
+}
+
+// OutputStream selects or deselects the output stream given, where memory streams redirect output
+// to the table given.
+func (m *Machine) outputStream(stream int16, table uint32) {
+	var sc = &m.screen
+	switch stream {
+	case 1, -1:
+		sc.enabled = stream > 0
+	case 2, -2:
+		// Transcripts are not supported, but the header is updated as required.
+		m.setByte(hdrFlags2+1, m.byteAt(hdrFlags2+1)&^0x01|byte(boolValue(stream > 0)))
+	case 3:
+		if len(sc.memory) >= maxMemoryStreams {
+			panic(errors.New("too many nested memory streams"))
+		}
+		sc.memory = append(sc.memory, memoryStream{table: table})
+	case -3:
+		if n := len(sc.memory); n > 0 {
+			m.setWord(sc.memory[n-1].table, sc.memory[n-1].size)
+			sc.memory = sc.memory[:n-1]
+		}
+	}
+}
+
+// PrintTable prints a rectangle of ZSCII text from the table given, with the width and height given,
+// skipping a number of characters between each line.
+func (m *Machine) printTable(table uint32, width, height, skip, argc int) {
+	if argc < 3 {
+		height = 1
+	}
+
+	var b strings.Builder
+	for row := 0; row < height; row++ {
+		if row > 0 {
+			b.WriteByte('\n')
+		}
+		for col := 0; col < width; col++ {
+			if r := m.zsciiRune(uint16(m.byteAt(table))); r != 0 {
+				b.WriteRune(r)
+			}
+			table++
+		}
+		table += uint32(skip)
+	}
+
+	m.print(b.String())
+}
+
+// UpdateStatus sets the status line for version 3 stories, as derived from the current location
+// and score, or time of day.
+func (m *Machine) updateStatus() {
+	var st = Status{
+		Location: m.shortName(m.readVar(16)),
+		Time:     m.version == 3 && m.byteAt(hdrFlags1)&0x02 != 0,
+	}
+
+	var first, second = m.readVar(17), m.readVar(18)
+	if st.Time {
+		st.Hours, st.Minutes = int(first), int(second)
+		st.Text = fmt.Sprintf("%s  Time: %d:%02d", st.Location, st.Hours, st.Minutes)
+	} else {
+		st.Score, st.Moves = int(int16(first)), int(second)
+		st.Text = fmt.Sprintf("%s  Score: %d  Moves: %d", st.Location, st.Score, st.Moves)
+	}
+
+	m.screen.status = st
+}
+
+// CurrentStatus returns the status line, as set for version 3 stories, or as printed to the upper
+// window for later versions.
+func (m *Machine) currentStatus() Status {
+	if m.version <= 3 {
+		return m.screen.status
+	}
+
+	var lines []string
+	for _, l := range m.screen.upper {
+		if s := strings.TrimSpace(string(l)); s != "" {
+			lines = append(lines, statusSpacePattern.ReplaceAllString(s, "  "))
+		}
+	}
+
+	return Status{Text: strings.Join(lines, "\n")}
+}
+
+func blankLine(width int) []rune {
+	var l = make([]rune, width)
+	for i := range l {
+		l[i] = ' '
+	}
+	return l
+}
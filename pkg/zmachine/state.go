@@ -0,0 +1,366 @@
+package zmachine
+
+import (
+	// Standard library
+	"bytes"
+	"encoding/binary"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// State represents a snapshot of the machine state, as saved with 'save' and 'save_undo'.
+type state struct {
+	mem    []byte   // A copy of dynamic memory.
+	stack  []uint16 // A copy of the evaluation stack.
+	frames []frame  // A copy of the call stack.
+	pc     uint32   // The address of the store or branch data for the instruction that saved the state.
+}
+
+// Snapshot returns the current machine state, with the program counter given.
+func (m *Machine) snapshot(pc uint32) *state {
+	var s = &state{
+		mem:    append([]byte(nil), m.mem[:m.staticBase]...),
+		stack:  append([]uint16(nil), m.stack...),
+		frames: make([]frame, len(m.frames)),
+		pc:     pc,
+	}
+
+	for i, f := range m.frames {
+		f.locals = append([]uint16(nil), f.locals...)
+		s.frames[i] = f
+	}
+
+	return s
+}
+
+// Apply sets the machine state to the state given.
+func (m *Machine) apply(s *state) {
+	// Flags for transcripting and fixed-pitch fonts are retained across restores.
+	var flags2 = m.mem[hdrFlags2+1] & 0x03
+	copy(m.mem, s.mem)
+	m.mem[hdrFlags2+1] = m.mem[hdrFlags2+1]&^0x03 | flags2
+
+	m.stack, m.frames, m.pc = s.stack, s.frames, s.pc
+	m.setHeader()
+}
+
+// SaveUndo saves the current state for use with 'restore_undo', and stores the result.
+func (m *Machine) saveUndo() {
+	if len(m.undo) >= maxUndo {
+		m.undo = m.undo[1:]
+	}
+
+	m.undo = append(m.undo, m.snapshot(m.pc))
+	m.store(1)
+}
+
+// RestoreUndo restores the last state saved with 'save_undo', returning false if no state has been
+// saved. Execution continues from the 'save_undo' instruction, which stores a value of 2.
+func (m *Machine) restoreUndo() bool {
+	if len(m.undo) == 0 {
+		return false
+	}
+
+	m.apply(m.undo[len(m.undo)-1])
+	m.undo = m.undo[:len(m.undo)-1]
+	m.store(2)
+	return true
+}
+
+// Save prompts for a file name and writes the current state to a save file, returning whether or
+// not saving succeeded.
+func (m *Machine) save() bool {
+	if m.conf.SaveFile == nil {
+		return false
+	}
+
+	var name = m.promptFile()
+	return m.conf.SaveFile(name, m.encodeState(m.snapshot(m.pc))) == nil
+}
+
+// Restore prompts for a file name and restores state from the save file, returning false if
+// restoring failed. Execution continues from the 'save' instruction that produced the save file,
+// which either branches or stores a value of 2.
+func (m *Machine) restore() bool {
+	if m.conf.RestoreFile == nil {
+		return false
+	}
+
+	data, err := m.conf.RestoreFile(m.promptFile())
+	if err != nil {
+		return false
+	}
+
+	s, err := m.decodeState(data)
+	if err != nil {
+		m.print("[" + err.Error() + "]\n")
+		return false
+	}
+
+	if m.apply(s); m.version <= 3 {
+		m.branch(true)
+	} else {
+		m.store(2)
+	}
+
+	return true
+}
+
+// SaveTable writes the table given to an auxiliary file, with the name given in memory, or a default
+// name, returning 1 if saving succeeded, or 0 otherwise.
+func (m *Machine) saveTable(table, size, name uint32, named bool) uint16 {
+	if m.conf.SaveFile == nil {
+		return 0
+	}
+
+	var data = make([]byte, size)
+	for i := range data {
+		data[i] = m.byteAt(table + uint32(i))
+	}
+
+	return boolValue(m.conf.SaveFile(m.auxName(name, named), data) == nil)
+}
+
+// RestoreTable reads an auxiliary file into the table given, returning the number of bytes read.
+func (m *Machine) restoreTable(table, size, name uint32, named bool) uint16 {
+	if m.conf.RestoreFile == nil {
+		return 0
+	}
+
+	data, err := m.conf.RestoreFile(m.auxName(name, named))
+	if err != nil {
+		return 0
+	} else if uint32(len(data)) > size {
+		data = data[:size]
+	}
+
+	for i, b := range data {
+		m.setByte(table+uint32(i), b)
+	}
+
+	return uint16(len(data))
+}
+
+// AuxName returns the file name for auxiliary files, as stored in memory as a length-prefixed string,
+// or a default name if none is given.
+func (m *Machine) auxName(name uint32, named bool) string {
+	if !named || name == 0 {
+		return "auxiliary.aux"
+	}
+
+	var buf = make([]byte, m.byteAt(name))
+	for i := range buf {
+		buf[i] = m.byteAt(name + 1 + uint32(i))
+	}
+
+	return string(buf)
+}
+
+// PromptFile asks the player for a save file name, returning the default name if none is given.
+func (m *Machine) promptFile() string {
+	m.print("Please enter a filename [" + m.conf.SaveName + "]: ")
+	if name := m.readLine(); name != "" {
+		return name
+	}
+
+	return m.conf.SaveName
+}
+
+// EncodeState returns the state given as a Quetzal save file, with memory stored as compressed
+// differences against the original story file.
+func (m *Machine) encodeState(s *state) []byte {
+	var head = make([]byte, 13)
+	copy(head[0:2], m.story[hdrRelease:hdrRelease+2])
+	copy(head[2:8], m.story[hdrSerial:hdrSerial+6])
+	copy(head[8:10], m.story[hdrChecksum:hdrChecksum+2])
+	putUint24(head[10:], s.pc)
+
+	// Differences are run-length encoded, where runs of unchanged bytes are stored as a zero byte,
+	// followed by the length of the run, minus one.
+	var mem []byte
+	for i := 0; i < len(s.mem); i++ {
+		if b := s.mem[i] ^ m.story[i]; b != 0 {
+			mem = append(mem, b)
+			continue
+		}
+
+		var n = 0
+		for i+1 < len(s.mem) && s.mem[i+1] == m.story[i+1] && n < 0xFF {
+			i, n = i+1, n+1
+		}
+		mem = append(mem, 0, byte(n))
+	}
+
+	var stks []byte
+	for i, f := range s.frames {
+		var top = len(s.stack)
+		if i+1 < len(s.frames) {
+			top = s.frames[i+1].base
+		}
+
+		var rec = make([]byte, 8, 8+2*(len(f.locals)+top-f.base))
+		var flags, store = byte(len(f.locals)), byte(0)
+		if f.store < 0 {
+			flags |= 0x10
+		} else {
+			store = byte(f.store)
+		}
+
+		putUint24(rec[0:], f.ret)
+		rec[3], rec[4], rec[5] = flags, store, byte(1<<uint(f.argc)-1)
+		binary.BigEndian.PutUint16(rec[6:], uint16(top-f.base))
+		for _, v := range f.locals {
+			rec = append(rec, byte(v>>8), byte(v))
+		}
+		for _, v := range s.stack[f.base:top] {
+			rec = append(rec, byte(v>>8), byte(v))
+		}
+
+		stks = append(stks, rec...)
+	}
+
+	var body = []byte("IFZS")
+	for _, c := range []struct {
+		id   string
+		data []byte
+	}{{"IFhd", head}, {"CMem", mem}, {"Stks", stks}} {
+		body = append(body, c.id...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(c.data)))
+		if body = append(body, c.data...); len(c.data)%2 != 0 {
+			body = append(body, 0)
+		}
+	}
+
+	return append(binary.BigEndian.AppendUint32([]byte("FORM"), uint32(len(body))), body...)
+}
+
+// DecodeState returns the state stored in the Quetzal save file given, which must have been saved
+// for the same story.
+func (m *Machine) decodeState(data []byte) (*state, error) {
+	if len(data) < 12 || string(data[0:4]) != "FORM" || string(data[8:12]) != "IFZS" {
+		return nil, errors.New("save file is not in Quetzal format")
+	}
+
+	var s = &state{}
+	var seen = make(map[string]bool)
+	for rest := data[12:]; len(rest) >= 8; {
+		var id, size = string(rest[0:4]), binary.BigEndian.Uint32(rest[4:8])
+		if uint32(len(rest)-8) < size {
+			return nil, errors.New("save file is truncated")
+		}
+
+		var chunk = rest[8 : 8+size]
+		if rest = rest[8+size:]; size%2 != 0 && len(rest) > 0 {
+			rest = rest[1:]
+		}
+
+		var err error
+		switch id {
+		case "IFhd":
+			if len(chunk) < 13 || !bytes.Equal(chunk[0:2], m.story[hdrRelease:hdrRelease+2]) ||
+				!bytes.Equal(chunk[2:8], m.story[hdrSerial:hdrSerial+6]) ||
+				!bytes.Equal(chunk[8:10], m.story[hdrChecksum:hdrChecksum+2]) {
+				return nil, errors.New("save file is for a different story")
+			}
+			s.pc = uint32(chunk[10])<<16 | uint32(chunk[11])<<8 | uint32(chunk[12])
+		case "CMem":
+			s.mem, err = m.decodeMemory(chunk, true)
+		case "UMem":
+			s.mem, err = m.decodeMemory(chunk, false)
+		case "Stks":
+			s.stack, s.frames, err = decodeStacks(chunk)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		seen[id] = true
+	}
+
+	if !seen["IFhd"] || s.mem == nil || s.frames == nil {
+		return nil, errors.New("save file is incomplete")
+	}
+
+	return s, nil
+}
+
+// DecodeMemory returns dynamic memory as stored in the save file chunk given, which is either
+// compressed, or stored verbatim.
+func (m *Machine) decodeMemory(chunk []byte, compressed bool) ([]byte, error) {
+	var mem = append([]byte(nil), m.story[:m.staticBase]...)
+	if !compressed {
+		if len(chunk) != len(mem) {
+			return nil, errors.New("save file has invalid memory size")
+		}
+		return append(mem[:0], chunk...), nil
+	}
+
+	for i, p := 0, 0; i < len(chunk); i++ {
+		if p >= len(mem) {
+			return nil, errors.New("save file has invalid memory size")
+		} else if chunk[i] != 0 {
+			mem[p] ^= chunk[i]
+			p++
+		} else if i++; i < len(chunk) {
+			p += int(chunk[i]) + 1
+		}
+	}
+
+	return mem, nil
+}
+
+// DecodeStacks returns the evaluation and call stacks stored in the save file chunk given.
+func decodeStacks(chunk []byte) ([]uint16, []frame, error) {
+	var stack = []uint16{}
+	var frames []frame
+
+	for len(chunk) > 0 {
+		if len(chunk) < 8 {
+			return nil, nil, errors.New("save file has invalid stack")
+		}
+
+		var flags, store, args = chunk[3], int(chunk[4]), chunk[5]
+		var f = frame{
+			ret:    uint32(chunk[0])<<16 | uint32(chunk[1])<<8 | uint32(chunk[2]),
+			store:  store,
+			locals: make([]uint16, flags&0x0F),
+			base:   len(stack),
+		}
+
+		if flags&0x10 != 0 {
+			f.store = -1
+		}
+		for args&(1<<uint(f.argc)) != 0 && f.argc < 7 {
+			f.argc++
+		}
+
+		var count = int(binary.BigEndian.Uint16(chunk[6:8]))
+		if chunk = chunk[8:]; len(chunk) < 2*(len(f.locals)+count) {
+			return nil, nil, errors.New("save file has invalid stack")
+		}
+
+		for i := range f.locals {
+			f.locals[i], chunk = binary.BigEndian.Uint16(chunk), chunk[2:]
+		}
+		for i := 0; i < count; i++ {
+			stack, chunk = append(stack, binary.BigEndian.Uint16(chunk)), chunk[2:]
+		}
+
+		frames = append(frames, f)
+	}
+
+	if len(frames) == 0 || len(frames) > maxFrames || len(stack) > maxStackSize {
+		return nil, nil, errors.New("save file has invalid stack")
+	}
+
+	frames[0].store = -1
+	return stack, frames, nil
+}
+
+func putUint24(buf []byte, v uint32) {
+	buf[0], buf[1], buf[2] = byte(v>>16), byte(v>>8), byte(v)
+}
@@ -0,0 +1,334 @@
+package zmachine
+
+import (
+	// Standard library
+	"strings"
+	"unicode"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// The default alphabets used for decoding Z-characters, where the first two characters in the third
+// alphabet represent the escape sequence for ZSCII characters and a new-line, respectively.
+var defaultAlphabet = [3]string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"  0123456789.,!?_#'\"/\\-:()",
+}
+
+// The default mapping of ZSCII characters 155 and over to Unicode characters.
+var defaultUnicode = []rune("äöüÄÖÜß»«ëïÿËÏáéíóúýÁÉÍÓÚÝàèìòùÀÈÌÒÙâêîôûÂÊÎÔÛåÅøØãñõÃÑÕæÆçÇþðÞÐ£œŒ¡¿")
+
+// The ZSCII character for new-lines and the end of input.
+const zsciiNewline = 13
+
+// SetAlphabet sets the alphabets used for text, from the story header if set, or the defaults.
+func (m *Machine) setAlphabet() {
+	var table uint32
+	if m.version >= 5 {
+		table = uint32(m.wordAt(hdrAlphabet))
+	}
+
+	for i := range m.alphabet {
+		for j := range m.alphabet[i] {
+			if table != 0 {
+				m.alphabet[i][j] = m.byteAt(table + uint32(26*i+j))
+			} else {
+				m.alphabet[i][j] = defaultAlphabet[i][j]
+			}
+		}
+	}
+}
+
+// Decode returns the text for the Z-encoded string at the address given, along with the address
+// following the end of the string.
+func (m *Machine) decode(addr uint32, abbrev bool) (string, uint32) {
+	var b strings.Builder
+	var alphabet, pending, escape int
+	var high byte
+
+	for done := false; !done; addr += 2 {
+		var w = m.wordAt(addr)
+		done = w&0x8000 != 0
+
+		for _, z := range [...]byte{byte(w>>10) & 0x1F, byte(w>>5) & 0x1F, byte(w) & 0x1F} {
+			switch {
+			case pending > 0:
+				if abbrev {
+					panic(errors.New("nested abbreviation in string"))
+				}
+				var entry = m.abbreviations + 2*uint32(32*(pending-1)+int(z))
+				s, _ := m.decode(2*uint32(m.wordAt(entry)), true)
+				b.WriteString(s)
+				pending, alphabet = 0, 0
+			case escape == 1:
+				high, escape = z, 2
+			case escape == 2:
+				if r := m.zsciiRune(uint16(high)<<5 | uint16(z)); r != 0 {
+					b.WriteRune(r)
+				}
+				escape, alphabet = 0, 0
+			case z == 0:
+				b.WriteByte(' ')
+				alphabet = 0
+			case z <= 3:
+				pending = int(z)
+			case z == 4:
+				alphabet = 1
+			case z == 5:
+				alphabet = 2
+			case alphabet == 2 && z == 6:
+				escape = 1
+			case alphabet == 2 && z == 7:
+				b.WriteByte('\n')
+				alphabet = 0
+			default:
+				if r := m.zsciiRune(uint16(m.alphabet[alphabet][z-6])); r != 0 {
+					b.WriteRune(r)
+				}
+				alphabet = 0
+			}
+		}
+	}
+
+	return b.String(), addr
+}
+
+// Encode returns the dictionary representation for the ZSCII text given, as used for looking up
+// words in dictionaries.
+func (m *Machine) encode(text []byte) []uint16 {
+	var size = 6
+	if m.version >= 4 {
+		size = 9
+	}
+
+	var zchars = make([]byte, 0, size+3)
+	for _, c := range text {
+		if len(zchars) >= size {
+			break
+		} else if i := strings.IndexByte(string(m.alphabet[0][:]), c); i >= 0 {
+			zchars = append(zchars, byte(i+6))
+		} else if i := strings.IndexByte(string(m.alphabet[1][:]), c); i >= 0 {
+			zchars = append(zchars, 4, byte(i+6))
+		} else if i := strings.IndexByte(string(m.alphabet[2][2:]), c); i >= 0 {
+			zchars = append(zchars, 5, byte(i+8))
+		} else {
+			zchars = append(zchars, 5, 6, c>>5, c&0x1F)
+		}
+	}
+
+	for len(zchars) < size {
+		zchars = append(zchars, 5)
+	}
+
+	var words = make([]uint16, size/3)
+	for i := range words {
+		words[i] = uint16(zchars[3*i])<<10 | uint16(zchars[3*i+1])<<5 | uint16(zchars[3*i+2])
+	}
+
+	words[len(words)-1] |= 0x8000
+	return words
+}
+
+// UnicodeTable returns the table mapping ZSCII characters 155 and over to Unicode characters.
+func (m *Machine) unicodeTable() []rune {
+	if m.version < 5 || m.wordAt(hdrExtension) == 0 {
+		return defaultUnicode
+	}
+
+	var ext = uint32(m.wordAt(hdrExtension))
+	if m.wordAt(ext) < 3 || m.wordAt(ext+6) == 0 {
+		return defaultUnicode
+	}
+
+	var table = uint32(m.wordAt(ext + 6))
+	var runes = make([]rune, m.byteAt(table))
+	for i := range runes {
+		runes[i] = rune(m.wordAt(table + 1 + 2*uint32(i)))
+	}
+
+	return runes
+}
+
+// ZSCIIRune returns the Unicode character for the ZSCII character given, or zero if the character
+// is not printable.
+func (m *Machine) zsciiRune(c uint16) rune {
+	switch {
+	case c == zsciiNewline:
+		return '\n'
+	case c >= 32 && c <= 126:
+		return rune(c)
+	case c >= 155 && c <= 251:
+		if table := m.unicodeTable(); int(c-155) < len(table) {
+			return table[c-155]
+		}
+		return '?'
+	default:
+		return 0
+	}
+}
+
+// RuneZSCII returns the ZSCII character for the Unicode character given, or '?' if the character
+// has no equivalent.
+func (m *Machine) runeZSCII(r rune) byte {
+	switch {
+	case r == '\n':
+		return zsciiNewline
+	case r >= 32 && r <= 126:
+		return byte(r)
+	}
+
+	for i, u := range m.unicodeTable() {
+		if u == r && i+155 <= 251 {
+			return byte(i + 155)
+		}
+	}
+
+	return '?'
+}
+
+// Read reads a line of input into the text buffer given, and tokenises it into the parse buffer
+// given, if any. The character terminating input is returned.
+func (m *Machine) read(text, parse uint32) byte {
+	var line = m.readLine()
+	var max, offset, start = int(m.byteAt(text)), uint32(1), 0
+
+	// Earlier versions terminate input with a zero byte, while later versions store its length, and
+	// may have existing input in the buffer.
+	if m.version <= 4 {
+		max--
+	} else if offset, start = 2, int(m.byteAt(text+1)); start > max {
+		start = 0
+	}
+
+	var n = start
+	for _, r := range strings.ToLower(line) {
+		if n >= max {
+			break
+		} else if c := m.runeZSCII(r); c != zsciiNewline {
+			m.setByte(text+offset+uint32(n), c)
+			n++
+		}
+	}
+
+	if m.version <= 4 {
+		m.setByte(text+offset+uint32(n), 0)
+	} else {
+		m.setByte(text+1, byte(n))
+	}
+
+	if parse != 0 {
+		m.tokenise(text, parse, 0, false)
+	}
+
+	return zsciiNewline
+}
+
+// ReadChar reads a single character of input, where lines of input are read in full, and empty
+// lines are taken as a new-line.
+func (m *Machine) readChar() byte {
+	for _, r := range m.readLine() {
+		return m.runeZSCII(r)
+	}
+
+	return zsciiNewline
+}
+
+// ReadLine reads a line of input, updating the status line and flushing any pending output before
+// waiting for input.
+func (m *Machine) readLine() string {
+	m.out.Flush()
+	m.pause()
+	line, err := m.in.ReadString('\n')
+	m.resume()
+
+	if err != nil && line == "" {
+		panic(errInputClosed)
+	}
+
+	return strings.TrimRightFunc(line, unicode.IsSpace)
+}
+
+// Tokenise splits the text in the text buffer given into words, looking up each word in the
+// dictionary given (or the default dictionary, if zero), and stores the results in the parse buffer
+// given. Unknown words are left unchanged in the parse buffer if the flag given is set.
+func (m *Machine) tokenise(text, parse, dict uint32, flag bool) {
+	if dict == 0 {
+		dict = m.dictionary
+	}
+
+	var chars []byte
+	var offset uint32 = 1
+	if m.version >= 5 {
+		offset = 2
+		for i := uint32(0); i < uint32(m.byteAt(text+1)); i++ {
+			chars = append(chars, m.byteAt(text+offset+i))
+		}
+	} else {
+		for i := uint32(0); m.byteAt(text+offset+i) != 0; i++ {
+			chars = append(chars, m.byteAt(text+offset+i))
+		}
+	}
+
+	var seps = make([]byte, m.byteAt(dict))
+	for i := range seps {
+		seps[i] = m.byteAt(dict + 1 + uint32(i))
+	}
+
+	var max, count = int(m.byteAt(parse)), 0
+	for i := 0; i < len(chars) && count < max; {
+		if chars[i] == ' ' {
+			i++
+			continue
+		}
+
+		// Separators are words in their own right, while other words end at spaces or separators.
+		var start = i
+		if i++; strings.IndexByte(string(seps), chars[start]) < 0 {
+			for i < len(chars) && chars[i] != ' ' && strings.IndexByte(string(seps), chars[i]) < 0 {
+				i++
+			}
+		}
+
+		var word, entry = m.lookup(dict, chars[start:i]), parse + 2 + 4*uint32(count)
+		if word != 0 || !flag {
+			m.setWord(entry, word)
+			m.setByte(entry+2, byte(i-start))
+			m.setByte(entry+3, byte(uint32(start)+offset))
+		}
+
+		count++
+	}
+
+	m.setByte(parse+1, byte(count))
+}
+
+// Lookup returns the address of the entry for the word given in the dictionary given, or zero if
+// the word was not found.
+func (m *Machine) lookup(dict uint32, word []byte) uint16 {
+	var key = m.encode(word)
+	var seps = uint32(m.byteAt(dict))
+	var size, count = uint32(m.byteAt(dict + 1 + seps)), int16(m.wordAt(dict + 2 + seps))
+	var entries = dict + 4 + seps
+
+	// Dictionaries with a negative number of entries are unsorted, but are searched in the same way.
+	if count < 0 {
+		count = -count
+	}
+
+	for i := uint32(0); i < uint32(count); i++ {
+		var addr, match = entries + i*size, true
+		for j, w := range key {
+			if m.wordAt(addr+2*uint32(j)) != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			return uint16(addr)
+		}
+	}
+
+	return 0
+}
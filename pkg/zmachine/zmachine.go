@@ -0,0 +1,381 @@
+// Package zmachine implements an interpreter for Z-machine story files, as produced by the Inform
+// compilers, covering versions 3, 4, 5, 7 and 8 of the Z-machine standard.
+//
+// Stories are run against line-based input and plain-text output, much like a "dumb" terminal, with
+// text written to the upper window (typically containing the status line) kept apart from the main
+// output, and made available via Status. The story's memory and CPU time used are available between
+// turns, and save files are written in the Quetzal format shared with other interpreters.
+package zmachine
+
+import (
+	// Standard library
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	// Third-party packages
+	"github.com/pkg/errors"
+)
+
+// ErrStopped is returned by Run when the machine is stopped by a call to Stop.
+var ErrStopped = errors.New("machine stopped")
+
+// Internal error used for stopping execution when input is exhausted.
+var errInputClosed = errors.New("input closed")
+
+// Offsets for fields in the story file header.
+const (
+	hdrVersion         = 0x00
+	hdrFlags1          = 0x01
+	hdrRelease         = 0x02
+	hdrInitialPC       = 0x06
+	hdrDictionary      = 0x08
+	hdrObjects         = 0x0A
+	hdrGlobals         = 0x0C
+	hdrStaticBase      = 0x0E
+	hdrFlags2          = 0x10
+	hdrSerial          = 0x12
+	hdrAbbreviations   = 0x18
+	hdrFileLength      = 0x1A
+	hdrChecksum        = 0x1C
+	hdrInterpreter     = 0x1E
+	hdrScreenHeight    = 0x20
+	hdrScreenWidth     = 0x21
+	hdrScreenWidthU    = 0x22
+	hdrScreenHeightU   = 0x24
+	hdrFontWidth       = 0x26
+	hdrFontHeight      = 0x27
+	hdrRoutinesOffset  = 0x28
+	hdrStringsOffset   = 0x2A
+	hdrStandard        = 0x32
+	hdrAlphabet        = 0x34
+	hdrExtension       = 0x36
+	hdrSize            = 0x40
+	maxStorySize       = 512 << 10
+	defaultScreenWidth = 80
+)
+
+// Limits on the size of the evaluation and call stacks, past which execution is stopped.
+const (
+	maxStackSize = 1 << 16
+	maxFrames    = 1 << 12
+	maxUndo      = 8
+)
+
+// The number of instructions executed between checks for calls to Stop.
+const stopCheckInterval = 1 << 10
+
+// Config represents configuration for a Machine.
+type Config struct {
+	Input  io.Reader // The source of line-based input for the story.
+	Output io.Writer // The destination for text printed in the main window.
+
+	// Functions called for writing and reading save files, by the file name given by the player.
+	// Saving and restoring games is not available if these are unset.
+	SaveFile    func(name string, data []byte) error
+	RestoreFile func(name string) ([]byte, error)
+
+	SaveName    string // The file name suggested when prompting for save files.
+	ScreenWidth int    // The width of the screen, in characters, defaulting to 80.
+}
+
+// Machine represents a running Z-machine story.
+type Machine struct {
+	conf  Config
+	story []byte // The original story file, as used for restarting and saving.
+
+	mem     []byte // The story memory, as modified by the running story.
+	version byte   // The Z-machine version the story is compiled for.
+	pc      uint32 // The address of the next instruction executed.
+
+	stack  []uint16 // The evaluation stack, shared between all routines.
+	frames []frame  // The routine call stack, where the first frame represents the main routine.
+	undo   []*state // States saved with 'save_undo', most recent last.
+	args   [8]uint16
+
+	// Addresses for tables referenced in the story header.
+	staticBase    uint32
+	globals       uint32
+	objects       uint32
+	dictionary    uint32
+	abbreviations uint32
+	alphabet      [3][26]byte
+
+	in     *bufio.Reader
+	out    *bufio.Writer
+	screen screen
+	rand   *rand.Rand
+
+	finished bool   // Whether or not the story has quit.
+	stopped  int32  // Set to non-zero when the machine is to be stopped.
+	steps    uint64 // The number of instructions executed.
+
+	mu      sync.Mutex    // The lock protecting fields below.
+	status  Status        // The status line, as of the last request for input.
+	memory  []byte        // The dynamic memory, as of the last request for input.
+	busy    time.Duration // The time spent running, excluding time spent waiting for input.
+	resumed time.Time     // The time the story last resumed running.
+	running bool          // Whether or not the story is currently running.
+}
+
+// Frame represents a routine call, and the state needed for returning from it.
+type frame struct {
+	ret    uint32   // The address execution continues from once the routine returns.
+	store  int      // The variable the return value is stored in, or -1 if discarded.
+	locals []uint16 // The local variables for the routine.
+	base   int      // The size of the evaluation stack when the routine was called.
+	argc   int      // The number of arguments given to the routine.
+}
+
+// Run executes the story until it quits, its input is exhausted, or the machine is stopped, in which
+// case ErrStopped is returned. Any other error returned represents a fatal error in the story.
+func (m *Machine) Run() (err error) {
+	m.resume()
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+			if err != ErrStopped && err != errInputClosed {
+				err = errors.Wrapf(err, "fatal error at address %#x", m.pc)
+			}
+		}
+
+		if err == errInputClosed {
+			err = nil
+		}
+
+		m.out.Flush()
+		m.pause()
+	}()
+
+	for !m.finished {
+		if m.steps++; m.steps%stopCheckInterval == 0 && atomic.LoadInt32(&m.stopped) != 0 {
+			return ErrStopped
+		}
+		m.step()
+	}
+
+	return nil
+}
+
+// Stop requests that the machine stop running. Machines waiting for input are only stopped once
+// their input is closed.
+func (m *Machine) Stop() {
+	atomic.StoreInt32(&m.stopped, 1)
+}
+
+// Version returns the Z-machine version the story is compiled for.
+func (m *Machine) Version() int {
+	return int(m.version)
+}
+
+// Memory returns a copy of the dynamic memory for the story, as of the last request for input.
+func (m *Machine) Memory() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.memory...)
+}
+
+// Status returns the status line as of the last request for input.
+func (m *Machine) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// CPUTime returns the total time spent running the story, excluding time spent waiting for input.
+func (m *Machine) CPUTime() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.running {
+		return m.busy + time.Since(m.resumed)
+	}
+	return m.busy
+}
+
+// Resume marks the story as running, and is paired with calls to pause.
+func (m *Machine) resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.running, m.resumed = true, time.Now()
+}
+
+// Pause marks the story as idle, e.g. when waiting for input, and makes the current status line and
+// memory available to callers.
+func (m *Machine) pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.busy, m.running = m.busy+time.Since(m.resumed), false
+	m.status, m.memory = m.currentStatus(), append(m.memory[:0], m.mem[:m.staticBase]...)
+}
+
+// Reset sets the machine to its initial state, as for starting or restarting the story.
+func (m *Machine) reset() {
+	// Flags for transcripting and fixed-pitch fonts are retained across restarts.
+	var flags2 = m.mem[hdrFlags2+1] & 0x03
+	copy(m.mem, m.story)
+	m.mem[hdrFlags2+1] = m.mem[hdrFlags2+1]&^0x03 | flags2
+
+	m.stack, m.undo = m.stack[:0], nil
+	m.frames = []frame{{store: -1}}
+	m.pc = uint32(m.wordAt(hdrInitialPC))
+	m.screen = screen{width: m.conf.ScreenWidth, enabled: true}
+	m.setHeader()
+}
+
+// SetHeader sets fields in the story header describing interpreter capabilities.
+func (m *Machine) setHeader() {
+	if m.version <= 3 {
+		// Status line and screen splitting available, variable-pitch font not default.
+		m.mem[hdrFlags1] = m.mem[hdrFlags1]&^(0x10|0x40) | 0x20
+	} else {
+		// Bold, italic and fixed-pitch fonts available, colours, pictures, sounds and timed input
+		// not available.
+		m.mem[hdrFlags1] = m.mem[hdrFlags1]&^(0x01|0x02|0x20|0x80) | 0x04 | 0x08 | 0x10
+	}
+
+	// Pictures, colours, mouse, sound effects and menus not available.
+	m.mem[hdrFlags2] &^= 0x01
+	m.mem[hdrFlags2+1] &^= 0x08 | 0x20 | 0x40 | 0x80
+
+	m.mem[hdrInterpreter], m.mem[hdrInterpreter+1] = 6, 'Z'
+	m.mem[hdrScreenHeight], m.mem[hdrScreenWidth] = 255, byte(m.conf.ScreenWidth)
+	if m.version >= 5 {
+		m.setWord(hdrScreenWidthU, uint16(m.conf.ScreenWidth))
+		m.setWord(hdrScreenHeightU, 255)
+		m.mem[hdrFontWidth], m.mem[hdrFontHeight] = 1, 1
+	}
+
+	m.mem[hdrStandard], m.mem[hdrStandard+1] = 1, 1
+}
+
+// FetchByte returns the byte at the program counter, and advances the program counter past it.
+func (m *Machine) fetchByte() byte {
+	var b = m.byteAt(m.pc)
+	m.pc++
+	return b
+}
+
+// FetchWord returns the word at the program counter, and advances the program counter past it.
+func (m *Machine) fetchWord() uint16 {
+	var w = m.wordAt(m.pc)
+	m.pc += 2
+	return w
+}
+
+func (m *Machine) byteAt(addr uint32) byte {
+	if addr >= uint32(len(m.mem)) {
+		panic(errors.Errorf("read from invalid address %#x", addr))
+	}
+	return m.mem[addr]
+}
+
+func (m *Machine) wordAt(addr uint32) uint16 {
+	return uint16(m.byteAt(addr))<<8 | uint16(m.byteAt(addr+1))
+}
+
+func (m *Machine) setByte(addr uint32, b byte) {
+	if addr >= m.staticBase && m.staticBase != 0 {
+		panic(errors.Errorf("write to non-dynamic address %#x", addr))
+	}
+	m.mem[addr] = b
+}
+
+func (m *Machine) setWord(addr uint32, w uint16) {
+	m.setByte(addr, byte(w>>8))
+	m.setByte(addr+1, byte(w))
+}
+
+// Unpack returns the byte address for the packed address given, which refers to either a routine or
+// a string.
+func (m *Machine) unpack(addr uint16, str bool) uint32 {
+	switch m.version {
+	case 3:
+		return 2 * uint32(addr)
+	case 4, 5:
+		return 4 * uint32(addr)
+	case 7:
+		if str {
+			return 4*uint32(addr) + 8*uint32(m.wordAt(hdrStringsOffset))
+		}
+		return 4*uint32(addr) + 8*uint32(m.wordAt(hdrRoutinesOffset))
+	default:
+		return 8 * uint32(addr)
+	}
+}
+
+// FileLength returns the length of the story file, as set in its header.
+func (m *Machine) fileLength() uint32 {
+	var n = uint32(m.wordAt(hdrFileLength))
+	switch m.version {
+	case 3:
+		n *= 2
+	case 4, 5:
+		n *= 4
+	default:
+		n *= 8
+	}
+
+	if n == 0 || n > uint32(len(m.story)) {
+		n = uint32(len(m.story))
+	}
+
+	return n
+}
+
+// New returns a Machine for the story file given, ready to be run.
+func New(story []byte, conf Config) (*Machine, error) {
+	if len(story) < hdrSize {
+		return nil, errors.New("story file is too short")
+	} else if len(story) > maxStorySize {
+		return nil, errors.New("story file is too long")
+	} else if conf.Input == nil || conf.Output == nil {
+		return nil, errors.New("input and output are required")
+	}
+
+	switch story[hdrVersion] {
+	case 3, 4, 5, 7, 8:
+	default:
+		return nil, errors.Errorf("story file version %d is not supported", story[hdrVersion])
+	}
+
+	if conf.ScreenWidth <= 0 || conf.ScreenWidth > 255 {
+		conf.ScreenWidth = defaultScreenWidth
+	}
+	if conf.SaveName == "" {
+		conf.SaveName = "story.qzl"
+	}
+
+	var m = &Machine{
+		conf:    conf,
+		story:   append([]byte(nil), story...),
+		mem:     make([]byte, len(story)),
+		version: story[hdrVersion],
+		in:      bufio.NewReader(conf.Input),
+		out:     bufio.NewWriter(conf.Output),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	copy(m.mem, story)
+	m.staticBase = uint32(m.wordAt(hdrStaticBase))
+	if m.staticBase < hdrSize || m.staticBase > uint32(len(story)) {
+		return nil, errors.New("story file has invalid static memory address")
+	}
+
+	m.globals = uint32(m.wordAt(hdrGlobals))
+	m.objects = uint32(m.wordAt(hdrObjects))
+	m.dictionary = uint32(m.wordAt(hdrDictionary))
+	m.abbreviations = uint32(m.wordAt(hdrAbbreviations))
+	m.setAlphabet()
+	m.reset()
+
+	return m, nil
+}
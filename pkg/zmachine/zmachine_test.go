@@ -0,0 +1,548 @@
+package zmachine
+
+import (
+	// Standard library
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Addresses for tables in stories assembled by newStory, all placed in dynamic memory apart from the
+// dictionary, strings and code.
+const (
+	testAbbreviations = 0x040
+	testGlobals       = 0x100
+	testObjects       = 0x2E0
+	testStaticBase    = 0x400
+	testDictionary    = 0x400
+	testStrings       = 0x420
+	testCode          = 0x500
+	testRoutines      = 0x600
+	testStorySize     = 0x800
+)
+
+// Z-encoded words for short names and dictionary words used in tests, as padded for dictionaries.
+var (
+	testWordsRoom = []uint16{0x5E94, 0x48A5, 0x94A5}
+	testWordsLamp = []uint16{0x44D2, 0x54A5, 0x94A5}
+	testWordsBox  = []uint16{0x1E9D, 0x14A5, 0x94A5}
+	testWordsThe  = []uint16{0x65AA, 0x14A5, 0x94A5}
+)
+
+// NewStory returns a minimal version 5 story file, with the code given placed at the initial program
+// counter, and any other data given placed at the addresses given.
+func newStory(code []byte, data map[uint32][]byte) []byte {
+	var story = make([]byte, testStorySize)
+	story[hdrVersion] = 5
+	binary.BigEndian.PutUint16(story[hdrRelease:], 1)
+	copy(story[hdrSerial:], "261017")
+	binary.BigEndian.PutUint16(story[hdrInitialPC:], testCode)
+	binary.BigEndian.PutUint16(story[hdrDictionary:], testDictionary)
+	binary.BigEndian.PutUint16(story[hdrObjects:], testObjects)
+	binary.BigEndian.PutUint16(story[hdrGlobals:], testGlobals)
+	binary.BigEndian.PutUint16(story[hdrStaticBase:], testStaticBase)
+	binary.BigEndian.PutUint16(story[hdrAbbreviations:], testAbbreviations)
+	binary.BigEndian.PutUint16(story[hdrFileLength:], testStorySize/4)
+
+	// The dictionary has no word separators, no entries, and entries of 9 bytes.
+	copy(story[testDictionary:], []byte{0, 9, 0, 0})
+
+	copy(story[testCode:], code)
+	for addr, b := range data {
+		copy(story[addr:], b)
+	}
+
+	return story
+}
+
+// Words returns the words given as bytes, for placing in story files.
+func words(w ...uint16) []byte {
+	var buf []byte
+	for _, v := range w {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+
+	return buf
+}
+
+// NewTestMachine returns a machine for the story given, reading the input given, and writing output
+// to the buffer returned.
+func newTestMachine(t *testing.T, story []byte, input string) (*Machine, *bytes.Buffer) {
+	var out bytes.Buffer
+	m, err := New(story, Config{Input: strings.NewReader(input), Output: &out})
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	}
+
+	return m, &out
+}
+
+func TestInstructions(t *testing.T) {
+	// A routine at testRoutines, taking one local, and returning its value plus one.
+	var routine = map[uint32][]byte{
+		testRoutines: {
+			0x01,                   // 1 local
+			0x54, 0x01, 0x01, 0x00, // add L01 1 -> sp
+			0xB8, // ret_popped
+		},
+	}
+
+	var tests = []struct {
+		name string
+		code []byte
+		data map[uint32][]byte
+		want string
+	}{
+		{
+			name: "long form with small constants",
+			code: []byte{
+				0x14, 0x02, 0x03, 0x00, // add 2 3 -> sp
+				0xE6, 0xBF, 0x00, // print_num sp
+				0xBA, // quit
+			},
+			want: "5",
+		},
+		{
+			name: "signed arithmetic",
+			code: []byte{
+				0x15, 0x02, 0x03, 0x10, // sub 2 3 -> g00
+				0xE6, 0xBF, 0x10, // print_num g00
+				0xBA, // quit
+			},
+			want: "-1",
+		},
+		{
+			name: "variable form with large constant",
+			code: []byte{
+				0xD4, 0x1F, 0x03, 0xE8, 0x07, 0x00, // add 1000 7 -> sp
+				0xE6, 0xBF, 0x00, // print_num sp
+				0xBA, // quit
+			},
+			want: "1007",
+		},
+		{
+			name: "short branch taken",
+			code: []byte{
+				0x01, 0x01, 0x01, 0xC5, // je 1 1 ?+5
+				0xE6, 0x7F, 0x01, // print_num 1
+				0xE6, 0x7F, 0x02, // print_num 2
+				0xBA, // quit
+			},
+			want: "2",
+		},
+		{
+			name: "short branch not taken",
+			code: []byte{
+				0x01, 0x01, 0x02, 0xC5, // je 1 2 ?+5
+				0xE6, 0x7F, 0x01, // print_num 1
+				0xE6, 0x7F, 0x02, // print_num 2
+				0xBA, // quit
+			},
+			want: "12",
+		},
+		{
+			name: "branch on false",
+			code: []byte{
+				0x01, 0x01, 0x02, 0x45, // je 1 2 ?~+5
+				0xE6, 0x7F, 0x01, // print_num 1
+				0xE6, 0x7F, 0x02, // print_num 2
+				0xBA, // quit
+			},
+			want: "2",
+		},
+		{
+			name: "long branch forwards",
+			code: []byte{
+				0x01, 0x01, 0x01, 0x80, 0x05, // je 1 1 ?+5
+				0xE6, 0x7F, 0x01, // print_num 1
+				0xE6, 0x7F, 0x02, // print_num 2
+				0xBA, // quit
+			},
+			want: "2",
+		},
+		{
+			name: "long branch backwards",
+			code: []byte{
+				0x0D, 0x10, 0x03, // store g00 3
+				0xE6, 0xBF, 0x10, // print_num g00
+				0x04, 0x10, 0x01, 0x3F, 0xFA, // dec_chk g00 1 ?~-6
+				0xBA, // quit
+			},
+			want: "321",
+		},
+		{
+			name: "jump",
+			code: []byte{
+				0x8C, 0x00, 0x05, // jump +5
+				0xE6, 0x7F, 0x01, // print_num 1
+				0xE6, 0x7F, 0x02, // print_num 2
+				0xBA, // quit
+			},
+			want: "2",
+		},
+		{
+			name: "call and return",
+			code: []byte{
+				0xE0, 0x1F, 0x01, 0x80, 0x07, 0x00, // call_vs routine 7 -> sp
+				0xE6, 0xBF, 0x00, // print_num sp
+				0xBA, // quit
+			},
+			data: routine,
+			want: "8",
+		},
+		{
+			name: "return from branch",
+			code: []byte{
+				0xE0, 0x3F, 0x01, 0x84, 0x00, // call_vs routine -> sp
+				0xE6, 0xBF, 0x00, // print_num sp
+				0xBA, // quit
+			},
+			data: map[uint32][]byte{
+				testRoutines + 0x10: {
+					0x00,                   // No locals
+					0x01, 0x01, 0x01, 0xC1, // je 1 1 ?rtrue
+					0xB1, // rfalse
+				},
+			},
+			want: "1",
+		},
+		{
+			name: "print literal",
+			code: append([]byte{
+				0xB2, // print
+			}, append(words(0x3551, 0xC685), // "hello"
+				0xBB, // new_line
+				0xBA, // quit
+			)...),
+			want: "hello\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, out := newTestMachine(t, newStory(tt.code, tt.data), "")
+			if err := m.Run(); err != nil {
+				t.Fatalf("Run() returned error: %s", err)
+			} else if out.String() != tt.want {
+				t.Errorf("Run() output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownInstruction(t *testing.T) {
+	m, _ := newTestMachine(t, newStory([]byte{0xB5}, nil), "") // save, removed in version 5
+	if err := m.Run(); err == nil || !strings.Contains(err.Error(), "unknown 0OP opcode 5") {
+		t.Errorf("Run() error = %v, want unknown opcode error", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var tests = []struct {
+		text string
+		want []uint16
+	}{
+		{"room", testWordsRoom},
+		{"lamp", testWordsLamp},
+		{"box", testWordsBox},
+		{"the", testWordsThe},
+		{"a.", []uint16{0x18B2, 0x14A5, 0x94A5}},
+		{"@", []uint16{0x14C2, 0x00A5, 0x94A5}},
+		{"truncated", []uint16{0x66FA, 0x4D06, 0xE549}},
+		{"truncatedword", []uint16{0x66FA, 0x4D06, 0xE549}},
+	}
+
+	m, _ := newTestMachine(t, newStory(nil, nil), "")
+	for _, tt := range tests {
+		if got := m.encode([]byte(tt.text)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("encode(%q) = %#04x, want %#04x", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	var tests = []struct {
+		name  string
+		words []uint16
+		want  string
+	}{
+		{"lower-case", testWordsRoom, "room"},
+		{"punctuation", []uint16{0x18B2, 0x14A5, 0x94A5}, "a."},
+		{"upper-case and space", []uint16{0x10C0, 0x6685 | 0x8000}, "A to"},
+		{"ZSCII escape", []uint16{0x14C2, 0x00A5, 0x94A5}, "@"},
+		{"new-line", []uint16{0x14E5 | 0x8000}, "\n"},
+		{"abbreviation", []uint16{0x0400, 0x20D9 | 0x8000}, "the cat"},
+	}
+
+	// The first abbreviation is set to 'the'.
+	var data = map[uint32][]byte{
+		testAbbreviations: words(testStrings / 2),
+		testStrings:       words(testWordsThe...),
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data[testStrings+0x10] = words(tt.words...)
+			m, _ := newTestMachine(t, newStory(nil, data), "")
+			if got, end := m.decode(testStrings+0x10, false); got != tt.want {
+				t.Errorf("decode() = %q, want %q", got, tt.want)
+			} else if want := uint32(testStrings + 0x10 + 2*len(tt.words)); end != want {
+				t.Errorf("decode() end = %#x, want %#x", end, want)
+			}
+		})
+	}
+}
+
+// TestObjectData returns an object table holding a room (object 1), containing a lamp (object 2) and
+// a box (object 3), with the lamp having attribute 3 set.
+func testObjectData() map[uint32][]byte {
+	var defaults = make([]byte, 126)
+	binary.BigEndian.PutUint16(defaults[2*(4-1):], 0x99) // Property 4 defaults to 0x99.
+
+	var object = func(attrs byte, parent, sibling, child, props uint16) []byte {
+		return append([]byte{attrs, 0, 0, 0, 0, 0}, words(parent, sibling, child, props)...)
+	}
+
+	var objects = testObjects + uint32(len(defaults))
+	var props = objects + 3*14
+	return map[uint32][]byte{
+		testObjects:  defaults,
+		objects:      object(0x00, 0, 0, 2, uint16(props)),
+		objects + 14: object(0x10, 1, 3, 0, uint16(props+0x10)),
+		objects + 28: object(0x00, 1, 0, 0, uint16(props+0x20)),
+
+		// Properties 5 (a word) and 3 (a byte) for the room, and property 10 (three bytes, with a
+		// two-byte header) for the lamp.
+		props:        append(append([]byte{3}, words(testWordsRoom...)...), 0x45, 0x12, 0x34, 0x03, 0x07, 0x00),
+		props + 0x10: append(append([]byte{3}, words(testWordsLamp...)...), 0x8A, 0x83, 0x01, 0x02, 0x03, 0x00),
+		props + 0x20: append(append([]byte{3}, words(testWordsBox...)...), 0x00),
+	}
+}
+
+func TestObjectTree(t *testing.T) {
+	// Relations are given as parent, sibling, and child, for each object.
+	var tests = []struct {
+		name   string
+		change func(m *Machine)
+		want   [3][3]uint16
+	}{
+		{"initial", func(m *Machine) {}, [3][3]uint16{{0, 0, 2}, {1, 3, 0}, {1, 0, 0}}},
+		{"remove first child", func(m *Machine) { m.removeObject(2) }, [3][3]uint16{{0, 0, 3}, {0, 0, 0}, {1, 0, 0}}},
+		{"remove last child", func(m *Machine) { m.removeObject(3) }, [3][3]uint16{{0, 0, 2}, {1, 0, 0}, {0, 0, 0}}},
+		{"insert into sibling", func(m *Machine) { m.insertObject(3, 2) }, [3][3]uint16{{0, 0, 2}, {1, 0, 3}, {2, 0, 0}}},
+		{"insert into same parent", func(m *Machine) { m.insertObject(3, 1) }, [3][3]uint16{{0, 0, 3}, {1, 0, 0}, {1, 2, 0}}},
+		{"remove orphan", func(m *Machine) { m.removeObject(1) }, [3][3]uint16{{0, 0, 2}, {1, 3, 0}, {1, 0, 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestMachine(t, newStory(nil, testObjectData()), "")
+			tt.change(m)
+
+			var got [3][3]uint16
+			for i := range got {
+				var obj = uint16(i + 1)
+				got[i] = [3]uint16{m.parent(obj), m.sibling(obj), m.child(obj)}
+			}
+			if got != tt.want {
+				t.Errorf("relations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectAttributes(t *testing.T) {
+	m, _ := newTestMachine(t, newStory(nil, testObjectData()), "")
+	if !m.attr(2, 3) || m.attr(1, 3) || m.attr(2, 4) {
+		t.Fatalf("attr() does not match initial attributes")
+	}
+
+	m.setAttr(1, 47, true)
+	m.setAttr(2, 3, false)
+	if !m.attr(1, 47) || m.attr(2, 3) {
+		t.Errorf("attr() does not match attributes set")
+	}
+}
+
+func TestObjectProperties(t *testing.T) {
+	m, _ := newTestMachine(t, newStory(nil, testObjectData()), "")
+
+	var tests = []struct {
+		obj, prop uint16
+		want      uint16
+	}{
+		{1, 5, 0x1234},
+		{1, 3, 0x07},
+		{1, 4, 0x99},
+		{3, 4, 0x99},
+	}
+
+	for _, tt := range tests {
+		if got := m.prop(tt.obj, tt.prop); got != tt.want {
+			t.Errorf("prop(%d, %d) = %#x, want %#x", tt.obj, tt.prop, got, tt.want)
+		}
+	}
+
+	if addr, size := m.findProp(2, 10); size != 3 || m.propLen(addr) != 3 {
+		t.Errorf("findProp(2, 10) size = %d, propLen = %d, want 3", size, m.propLen(addr))
+	} else if addr, _ := m.findProp(1, 4); addr != 0 {
+		t.Errorf("findProp(1, 4) = %#x, want 0", addr)
+	}
+
+	var next []uint16
+	for p := m.nextProp(1, 0); p != 0; p = m.nextProp(1, p) {
+		next = append(next, p)
+	}
+	if !reflect.DeepEqual(next, []uint16{5, 3}) {
+		t.Errorf("nextProp() = %v, want [5 3]", next)
+	}
+
+	if m.setProp(1, 3, 0x1FF); m.prop(1, 3) != 0xFF {
+		t.Errorf("prop(1, 3) = %#x after setProp, want 0xff", m.prop(1, 3))
+	}
+
+	for obj, want := range []string{"", "room", "lamp", "box"} {
+		if got := m.shortName(uint16(obj)); got != want {
+			t.Errorf("shortName(%d) = %q, want %q", obj, got, want)
+		}
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	var code = []byte{
+		0x0D, 0x10, 0x2A, // store g00 42
+		0xBE, 0x00, 0xFF, 0x00, // save -> sp
+		0x41, 0x00, 0x02, 0xCA, // je sp 2 ?+10
+		0x0D, 0x10, 0x07, // store g00 7
+		0xBE, 0x01, 0xFF, 0x00, // restore -> sp
+		0xBA,             // quit
+		0xE6, 0xBF, 0x10, // print_num g00
+		0xBA, // quit
+	}
+
+	var files = make(map[string][]byte)
+	var story = newStory(code, nil)
+
+	var out bytes.Buffer
+	m, err := New(story, Config{
+		Input:       strings.NewReader("game\ngame\n"),
+		Output:      &out,
+		SaveFile:    func(name string, data []byte) error { files[name] = data; return nil },
+		RestoreFile: func(name string) ([]byte, error) { return files[name], nil },
+	})
+	if err != nil {
+		t.Fatalf("New() returned error: %s", err)
+	} else if err = m.Run(); err != nil {
+		t.Fatalf("Run() returned error: %s", err)
+	} else if !strings.HasSuffix(out.String(), ": 42") {
+		t.Fatalf("Run() output = %q, want restored value of 42", out.String())
+	}
+
+	var data = files["game"]
+	if len(data) < 12 || string(data[0:4]) != "FORM" || string(data[8:12]) != "IFZS" {
+		t.Fatalf("save file is not in Quetzal format: %q", data)
+	}
+
+	// Saved state decodes to the same state it was encoded from.
+	s, err := m.decodeState(data)
+	if err != nil {
+		t.Fatalf("decodeState() returned error: %s", err)
+	} else if got := m.encodeState(s); !bytes.Equal(got, data) {
+		t.Errorf("encodeState() does not match original save file")
+	} else if s.pc != testCode+6 || binary.BigEndian.Uint16(s.mem[testGlobals:]) != 42 {
+		t.Errorf("decodeState() pc = %#x, g00 = %d, want %#x, 42", s.pc, binary.BigEndian.Uint16(s.mem[testGlobals:]), testCode+6)
+	}
+
+	// Save files for other stories, or otherwise invalid, are rejected.
+	var other = newStory(code, map[uint32][]byte{hdrSerial: []byte("000000")})
+	o, _ := newTestMachine(t, other, "")
+
+	var invalid = []struct {
+		name string
+		data []byte
+	}{
+		{"different story", data},
+		{"truncated", data[:len(data)-4]},
+		{"not quetzal", []byte("FORMxxxxAIFF")},
+	}
+
+	for _, tt := range invalid {
+		var machine = m
+		if tt.name == "different story" {
+			machine = o
+		}
+		if _, err := machine.decodeState(tt.data); err == nil {
+			t.Errorf("decodeState() for %s returned no error", tt.name)
+		}
+	}
+}
+
+func TestSaveRestoreStacks(t *testing.T) {
+	m, _ := newTestMachine(t, newStory(nil, nil), "")
+
+	// States with nested routine calls keep locals, stack values and argument counts for each frame.
+	var s = &state{
+		mem:   append([]byte(nil), m.mem[:m.staticBase]...),
+		stack: []uint16{1, 2, 3},
+		frames: []frame{
+			{store: -1, locals: []uint16{}, base: 0},
+			{ret: 0x512, store: 0x10, locals: []uint16{7, 8}, base: 1, argc: 2},
+			{ret: 0x605, store: -1, locals: []uint16{9}, base: 2, argc: 0},
+		},
+		pc: 0x610,
+	}
+
+	s.mem[testGlobals+1] = 0xAB
+	got, err := m.decodeState(m.encodeState(s))
+	if err != nil {
+		t.Fatalf("decodeState() returned error: %s", err)
+	} else if !reflect.DeepEqual(got, s) {
+		t.Errorf("decodeState() = %+v, want %+v", got, s)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	var code = []byte{
+		0x0D, 0x10, 0x01, // store g00 1
+		0xBE, 0x09, 0xFF, 0x00, // save_undo -> sp
+		0x41, 0x00, 0x02, 0xCA, // je sp 2 ?+10
+		0x0D, 0x10, 0x02, // store g00 2
+		0xBE, 0x0A, 0xFF, 0x00, // restore_undo -> sp
+		0xBA,             // quit
+		0xE6, 0xBF, 0x10, // print_num g00
+		0xBA, // quit
+	}
+
+	m, out := newTestMachine(t, newStory(code, nil), "")
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() returned error: %s", err)
+	} else if out.String() != "1" {
+		t.Errorf("Run() output = %q, want %q", out.String(), "1")
+	} else if len(m.undo) != 0 {
+		t.Errorf("undo states = %d after restoring, want 0", len(m.undo))
+	}
+
+	// Restoring with no state saved stores zero.
+	m, out = newTestMachine(t, newStory([]byte{
+		0xBE, 0x0A, 0xFF, 0x00, // restore_undo -> sp
+		0xE6, 0xBF, 0x00, // print_num sp
+		0xBA, // quit
+	}, nil), "")
+	if err := m.Run(); err != nil {
+		t.Fatalf("Run() returned error: %s", err)
+	} else if out.String() != "0" {
+		t.Errorf("Run() output = %q, want %q", out.String(), "0")
+	}
+
+	// Only the most recent states are kept.
+	m, _ = newTestMachine(t, newStory(nil, nil), "")
+	for i := 0; i < maxUndo+2; i++ {
+		m.pc = testCode + 0x100
+		m.saveUndo()
+	}
+	if len(m.undo) != maxUndo {
+		t.Errorf("undo states = %d, want %d", len(m.undo), maxUndo)
+	}
+}